@@ -1,20 +1,50 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/server/healthz"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	kubescheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/component-base/logs"
-	"k8s.io/klog"
 
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/aws"
 	clientset "github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/clientset/versioned"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/clientset/versioned/scheme"
 	informers "github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/informers/externalversions"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/controller"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/debug"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/metriccache"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/objects"
 	cwprov "github.com/awslabs/k8s-cloudwatch-adapter/pkg/provider"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/smoothing"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/templating"
 	basecmd "github.com/kubernetes-incubator/custom-metrics-apiserver/pkg/cmd"
 	"github.com/kubernetes-incubator/custom-metrics-apiserver/pkg/provider"
 )
@@ -22,34 +52,331 @@ import (
 // CloudWatchAdapter represents a custom metrics BaseAdapter for Amazon CloudWatch
 type CloudWatchAdapter struct {
 	basecmd.AdapterBase
+
+	// RefreshInterval is how often metric values are refreshed in the background, values are
+	// queried on every request when it is zero.
+	RefreshInterval time.Duration
+	// LeaderElect makes replicas elect a leader which records events, refreshes metric values and
+	// shares them with the other replicas.
+	LeaderElect bool
+	// LeaderElectNamespace is the namespace of the lease and the ConfigMap holding shared values.
+	LeaderElectNamespace string
+	// ConfigFile is the path of the adapter configuration file, the defaults are used when empty.
+	ConfigFile string
+	// AdapterConfig is the configuration loaded at startup.
+	AdapterConfig *config.AdapterConfig
+	// DebugEndpoint serves the last queries and values of each metric on the secure port.
+	DebugEndpoint bool
+}
+
+// configReloadInterval is how often the configuration file is checked for changes.
+const configReloadInterval = 10 * time.Second
+
+// loadConfig loads the configuration file. Flags which were set explicitly take precedence over
+// the file.
+func (a *CloudWatchAdapter) loadConfig() error {
+	cfg := config.NewDefaultConfig()
+	if a.ConfigFile != "" {
+		var err error
+		if cfg, err = config.Load(a.ConfigFile); err != nil {
+			return err
+		}
+	}
+
+	if !a.Flags().Changed("refresh-interval") {
+		a.RefreshInterval = cfg.Cache.RefreshInterval.Duration
+	}
+
+	a.AdapterConfig = cfg
+	return nil
+}
+
+// applyConfig applies the settings which can change while the adapter is running. The verbosity
+// given with --v is restored when the configuration does not set one.
+func applyConfig(cfg *config.AdapterConfig, sources *source.Registry, flagVerbosity string) {
+	verbosity := flagVerbosity
+	if cfg.Logging.Verbosity != nil {
+		verbosity = strconv.Itoa(*cfg.Logging.Verbosity)
+	}
+	if _, err := logs.GlogSetter(verbosity); err != nil {
+		logging.Error(err, "Unable to set log verbosity")
+	}
+	if err := logging.SetFormat(cfg.Logging.Format); err != nil {
+		logging.Error(err, "Unable to set log format")
+	}
+
+	// kept for compatibility with deployments enabling debug logs through the environment, applied
+	// to a copy so the loaded configuration is left as it is in the file
+	if os.Getenv("DEBUG") == "true" {
+		withDebug := *cfg
+		withDebug.AWS.Debug = true
+		cfg = &withDebug
+	}
+
+	sources.Configure(cfg)
 }
 
-func (a *CloudWatchAdapter) makeCloudWatchManager() (aws.CloudWatchManager, error) {
-	manager := aws.NewCloudWatchManager()
-	return manager, nil
+// makeMetricsSources returns the sources metric values are queried from.
+func (a *CloudWatchAdapter) makeMetricsSources(debugStore *debug.Store, reader *objects.Reader) *source.Registry {
+	// the rate limit applies to the queries of all the sources
+	rateLimiter := aws.NewRateLimiter(a.AdapterConfig)
+	manager := aws.NewCloudWatchManager(a.AdapterConfig, debugStore, rateLimiter)
+	sources := source.NewRegistry(
+		aws.NewCloudWatchSource(manager),
+		aws.NewPromQLSource(a.AdapterConfig, rateLimiter),
+		aws.NewLogsInsightsSource(a.AdapterConfig, rateLimiter),
+		aws.NewSQSSource(a.AdapterConfig, manager, rateLimiter),
+		aws.NewStreamSource(a.AdapterConfig, manager, rateLimiter))
+	// math expressions query the other sources
+	sources.Register(cwprov.NewMathSource(sources, reader))
+	if debugStore != nil {
+		// the queries of every source are kept, the CloudWatch queries with their raw results
+		sources.SetRecorder(debugStore)
+	}
+	return sources
 }
 
-func (a *CloudWatchAdapter) newController(cache *metriccache.MetricCache) (*controller.Controller, informers.SharedInformerFactory) {
+// newObjectReader returns the reader of the objects referenced by metrics, which watches them.
+func (a *CloudWatchAdapter) newObjectReader() (*objects.Reader, error) {
+	client, err := a.DynamicClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to construct dynamic client")
+	}
+
+	mapper, err := a.RESTMapper()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to construct RESTMapper")
+	}
+
+	return objects.NewReader(client, mapper, a.AdapterConfig.Controller.ResyncPeriod.Duration), nil
+}
+
+func (a *CloudWatchAdapter) newController(cache *metriccache.MetricCache, sources *source.Registry, resolver *templating.Resolver, recorder *events.Recorder) (*controller.Controller, informers.SharedInformerFactory) {
 	clientConfig, err := a.ClientConfig()
 	if err != nil {
-		klog.Fatalf("unable to construct client config: %v", err)
+		logging.Fatal(err, "Unable to construct client config")
 	}
 	adapterClientSet, err := clientset.NewForConfig(clientConfig)
 	if err != nil {
-		klog.Fatalf("unable to construct lister client to initialize provider: %v", err)
+		logging.Fatal(err, "Unable to construct lister client to initialize provider")
 	}
 
-	adapterInformerFactory := informers.NewSharedInformerFactory(adapterClientSet, time.Second*30)
+	adapterInformerFactory := informers.NewSharedInformerFactory(adapterClientSet, a.AdapterConfig.Controller.ResyncPeriod.Duration)
 	handler := controller.NewHandler(
 		adapterInformerFactory.Metrics().V1alpha1().ExternalMetrics().Lister(),
-		cache)
+		adapterInformerFactory.Metrics().V1alpha1().ClusterExternalMetrics().Lister(),
+		cache,
+		sources,
+		resolver,
+		recorder)
 
-	ctrl := controller.NewController(adapterInformerFactory.Metrics().V1alpha1().ExternalMetrics(), &handler)
+	ctrl := controller.NewController(
+		adapterInformerFactory.Metrics().V1alpha1().ExternalMetrics(),
+		adapterInformerFactory.Metrics().V1alpha1().ClusterExternalMetrics(),
+		&handler)
+	// metrics are resolved again when the objects their templates reference change
+	resolver.OnChange(ctrl.EnqueueKey)
+	// report the conflict on a metric as soon as an older one takes over its name
+	cache.OnDisplaced(ctrl.EnqueueKey)
 
 	return ctrl, adapterInformerFactory
 }
 
-func (a *CloudWatchAdapter) makeProvider(cwManager aws.CloudWatchManager, cache *metriccache.MetricCache) (provider.ExternalMetricsProvider, error) {
+// newWorkloadController returns the controller generating metrics and autoscalers for annotated
+// workloads, the metric objects are watched with the informers of the metric controller.
+func (a *CloudWatchAdapter) newWorkloadController(kubeClientSet kubernetes.Interface, kubeInformerFactory kubeinformers.SharedInformerFactory, adapterInformerFactory informers.SharedInformerFactory, recorder *events.Recorder) *controller.WorkloadController {
+	clientConfig, err := a.ClientConfig()
+	if err != nil {
+		logging.Fatal(err, "Unable to construct client config")
+	}
+	adapterClientSet, err := clientset.NewForConfig(clientConfig)
+	if err != nil {
+		logging.Fatal(err, "Unable to construct client to generate metrics")
+	}
+
+	return controller.NewWorkloadController(kubeClientSet, adapterClientSet, kubeInformerFactory, adapterInformerFactory, recorder)
+}
+
+func (a *CloudWatchAdapter) newKubeClient() kubernetes.Interface {
+	clientConfig, err := a.ClientConfig()
+	if err != nil {
+		logging.Fatal(err, "Unable to construct client config")
+	}
+	kubeClientSet, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		logging.Fatal(err, "Unable to construct Kubernetes client")
+	}
+
+	return kubeClientSet
+}
+
+func (a *CloudWatchAdapter) newEventRecorder(kubeClientSet kubernetes.Interface) *events.Recorder {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(func(format string, args ...interface{}) {
+		logging.V(2).Info(fmt.Sprintf(format, args...))
+	})
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClientSet.CoreV1().Events("")})
+
+	// events are recorded on metric objects and on the workloads autoscaling is generated for
+	eventScheme := runtime.NewScheme()
+	utilruntime.Must(kubescheme.AddToScheme(eventScheme))
+	utilruntime.Must(scheme.AddToScheme(eventScheme))
+
+	recorder := eventBroadcaster.NewRecorder(eventScheme, corev1.EventSource{Component: a.Name})
+	// the HPA polls every 15 seconds, only repeat a warning every few minutes
+	return events.NewRecorder(recorder, 5*time.Minute)
+}
+
+// leaderElection elects a leader among the replicas of the adapter, which does the work only one
+// replica should do: refreshing metric values, recording events, generating the objects of
+// annotated workloads and scaling them to zero.
+type leaderElection struct {
+	id       string
+	elector  *leaderelection.LeaderElector
+	recorder *events.Recorder
+
+	// work is run while leading, it has to be added before the election runs.
+	work []func(ctx context.Context)
+	// leading receives the context of each term of the replica as leader.
+	leading chan context.Context
+}
+
+// newLeaderElection returns the leader election of the replica. Events are only recorded once it
+// leads.
+func (a *CloudWatchAdapter) newLeaderElection(kubeClientSet kubernetes.Interface, recorder *events.Recorder) *leaderElection {
+	id, err := os.Hostname()
+	if err != nil {
+		logging.Fatal(err, "Unable to get hostname for leader election")
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: a.LeaderElectNamespace,
+			Name:      a.Name,
+		},
+		Client: kubeClientSet.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: id,
+		},
+	}
+
+	l := &leaderElection{
+		id:       id,
+		recorder: recorder,
+		leading:  make(chan context.Context),
+	}
+	l.elector, err = leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			// the elector runs this callback in a goroutine it does not wait for, hand the term over
+			// to Run which tracks the work of the leader
+			OnStartedLeading: func(ctx context.Context) {
+				select {
+				case l.leading <- ctx:
+				case <-ctx.Done():
+				}
+			},
+			OnStoppedLeading: func() {
+				logging.Info("Stopped leading", "identity", id)
+			},
+			OnNewLeader: func(identity string) {
+				logging.Info("New leader elected", "identity", identity)
+			},
+		},
+	})
+	if err != nil {
+		logging.Fatal(err, "Unable to construct leader elector")
+	}
+
+	recorder.SetEnabled(false)
+	return l
+}
+
+// Add adds work run while leading, with a context which is done once leadership is lost.
+func (l *leaderElection) Add(work func(ctx context.Context)) {
+	l.work = append(l.work, work)
+}
+
+// IsLeader returns true while the replica leads.
+func (l *leaderElection) IsLeader() bool {
+	return l.elector.IsLeader()
+}
+
+// Run runs for leadership until stopCh is closed, and returns once the work of the leader is done.
+func (l *leaderElection) Run(stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	var running sync.WaitGroup
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		for {
+			select {
+			case leaderCtx := <-l.leading:
+				l.lead(leaderCtx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// keep running for leadership after losing it, followers keep serving the shared values
+	wait.Until(func() { l.elector.Run(ctx) }, time.Second, stopCh)
+	running.Wait()
+}
+
+// lead runs the work of the leader until the context of its term is done.
+func (l *leaderElection) lead(ctx context.Context) {
+	logging.Info("Started leading", "identity", l.id)
+
+	l.recorder.SetEnabled(true)
+	defer l.recorder.SetEnabled(false)
+
+	var wg sync.WaitGroup
+	for _, work := range l.work {
+		wg.Add(1)
+		go func(work func(ctx context.Context)) {
+			defer wg.Done()
+			work(ctx)
+		}(work)
+	}
+	wg.Wait()
+}
+
+// addReadyzCheck adds a check to the readiness endpoint of the adapter, without affecting the
+// liveness endpoints.
+func (a *CloudWatchAdapter) addReadyzCheck(check healthz.HealthChecker) error {
+	config, err := a.Config()
+	if err != nil {
+		return errors.Wrap(err, "unable to construct adapter configuration")
+	}
+
+	config.GenericConfig.ReadyzChecks = append(config.GenericConfig.ReadyzChecks, check)
+	return nil
+}
+
+// addDebugHandler serves a handler on the secure port, behind the authentication and authorization
+// of the adapter. It has to be called once the provider is set.
+func (a *CloudWatchAdapter) addDebugHandler(path string, handler http.Handler) error {
+	server, err := a.Server()
+	if err != nil {
+		return errors.Wrap(err, "unable to construct adapter server")
+	}
+
+	server.GenericAPIServer.Handler.NonGoRestfulMux.Handle(path, handler)
+	return nil
+}
+
+func (a *CloudWatchAdapter) makeProvider(namespaces corelisters.NamespaceLister, metricsSource source.MetricsSource, cache *metriccache.MetricCache, valueCache *metriccache.ValueCache, smoothingState *smoothing.State, recorder *events.Recorder, debugStore *debug.Store) (provider.ExternalMetricsProvider, error) {
 	client, err := a.DynamicClient()
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to construct Kubernetes client")
@@ -60,7 +387,7 @@ func (a *CloudWatchAdapter) makeProvider(cwManager aws.CloudWatchManager, cache
 		return nil, errors.Wrap(err, "unable to construct RESTMapper")
 	}
 
-	cwProvider := cwprov.NewCloudWatchProvider(client, mapper, cwManager, cache)
+	cwProvider := cwprov.NewCloudWatchProvider(client, mapper, namespaces, metricsSource, cache, valueCache, smoothingState, recorder, debugStore)
 	return cwProvider, nil
 }
 
@@ -72,35 +399,222 @@ func main() {
 	cmd := &CloudWatchAdapter{}
 	cmd.Name = "k8s-cloudwatch-adapter"
 	cmd.Flags().AddGoFlagSet(flag.CommandLine) // make sure we get the klog flags
+	cmd.Flags().DurationVar(&cmd.RefreshInterval, "refresh-interval", 0,
+		"interval at which metric values are refreshed in the background, values are queried on every request when 0")
+	cmd.Flags().BoolVar(&cmd.LeaderElect, "leader-elect", false,
+		"elect a leader among replicas to record events, refresh metric values and share them with the other replicas")
+	cmd.Flags().StringVar(&cmd.LeaderElectNamespace, "leader-elect-namespace", podNamespace(),
+		"namespace of the leader election lease and the ConfigMap holding shared metric values")
+	cmd.Flags().StringVar(&cmd.ConfigFile, "config", "",
+		"path of the adapter configuration file, which is reloaded when it changes")
+	cmd.Flags().BoolVar(&cmd.DebugEndpoint, "debug-endpoint", false,
+		"serve the last queries and values of each metric at "+debug.Path+" on the secure port")
 	cmd.Flags().Parse(os.Args)
 
-	stopCh := make(chan struct{})
-	defer close(stopCh)
+	if err := cmd.loadConfig(); err != nil {
+		logging.Fatal(err, "Unable to load configuration")
+	}
+
+	// stop on SIGTERM or SIGINT so the work in progress can be drained
+	stopCh := server.SetupSignalHandler()
+	// cancels the requests of the background work once stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
 
 	cache := metriccache.NewMetricCache()
+	// smoothed values are kept across queries, whether they are refreshed or requested
+	smoothingState := smoothing.NewState()
+	kubeClientSet := cmd.newKubeClient()
+	recorder := cmd.newEventRecorder(kubeClientSet)
+
+	// with leader election only the leader records events, refreshes metric values and generates
+	// the objects of annotated workloads and scales them
+	var leader *leaderElection
+	if cmd.LeaderElect {
+		leader = cmd.newLeaderElection(kubeClientSet, recorder)
+	}
+
+	// background work which has to complete before exiting
+	var wg sync.WaitGroup
+
+	// the queries and values of each metric are only kept when they are served on the debug endpoint
+	var debugStore *debug.Store
+	if cmd.DebugEndpoint {
+		debugStore = debug.NewStore()
+		// what is kept for a metric is dropped once it is removed from the cache
+		cache.OnRemoved(debugStore.Forget)
+	}
+
+	// the objects referenced by metrics are read from the caches of informers
+	reader, err := cmd.newObjectReader()
+	if err != nil {
+		logging.Fatal(err, "Unable to construct object reader")
+	}
+	go reader.Run(stopCh)
+
+	// create the metric sources
+	sources := cmd.makeMetricsSources(debugStore, reader)
+	// the verbosity given with --v, restored when the configuration file stops setting one
+	flagVerbosity := flag.CommandLine.Lookup("v").Value.String()
+	applyConfig(cmd.AdapterConfig, sources, flagVerbosity)
 
 	// start and run controller components
-	ctrl, adapterInformerFactory := cmd.newController(cache)
+	// the objects referenced by templates are watched with the object reader
+	resolver := templating.NewResolver(reader)
+	ctrl, adapterInformerFactory := cmd.newController(cache, sources, resolver, recorder)
+	// the workload controllers share the informers of the workloads
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClientSet, cmd.AdapterConfig.Controller.ResyncPeriod.Duration)
+	if cmd.AdapterConfig.Controller.Workloads {
+		// the informers of the workload controller have to be set up before the factories start
+		workloads := cmd.newWorkloadController(kubeClientSet, kubeInformerFactory, adapterInformerFactory, recorder)
+		runWorkloads := func(ctx context.Context) {
+			if err := workloads.Run(cmd.AdapterConfig.Controller.Workers, ctx.Done()); err != nil {
+				logging.Error(err, "Unable to run workload controller")
+			}
+		}
+		if leader != nil {
+			// only the leader generates the objects of the workloads
+			leader.Add(runWorkloads)
+		} else {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runWorkloads(ctx)
+			}()
+		}
+	}
 	go adapterInformerFactory.Start(stopCh)
-	go ctrl.Run(2, time.Second, stopCh)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := ctrl.Run(cmd.AdapterConfig.Controller.Workers, time.Second, stopCh); err != nil {
+			logging.Fatal(err, "Unable to run controller")
+		}
+	}()
 
-	// create CloudWatch client
-	cwClient, err := cmd.makeCloudWatchManager()
-	if err != nil {
-		klog.Fatalf("unable to construct CloudWatch client: %v", err)
+	// apply changes to the configuration file without restarting
+	if cmd.ConfigFile != "" {
+		watcher := config.NewWatcher(cmd.ConfigFile, cmd.AdapterConfig, configReloadInterval)
+		watcher.OnChange(func(cfg *config.AdapterConfig) {
+			applyConfig(cfg, sources, flagVerbosity)
+		})
+		go watcher.Run(stopCh)
+	}
+
+	// refresh metric values in the background
+	var valueCache *metriccache.ValueCache
+	if cmd.RefreshInterval > 0 {
+		// by default values are served until two refreshes were missed, then queried on request again
+		maxAge := cmd.AdapterConfig.Cache.MaxAge.Duration
+		if maxAge == 0 {
+			maxAge = 2 * cmd.RefreshInterval
+		}
+		valueCache = metriccache.NewValueCache(maxAge)
+
+		var valueStore *metriccache.ValueStore
+		if leader != nil {
+			valueStore = metriccache.NewValueStore(kubeClientSet.CoreV1(), cmd.LeaderElectNamespace, cmd.Name+"-values")
+		}
+
+		refresher := cwprov.NewRefresher(sources, cache, valueCache, valueStore, smoothingState, recorder, cmd.RefreshInterval)
+		if leader != nil {
+			// only the leader refreshes values while the other replicas load them from the value store
+			leader.Add(refresher.Run)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				refresher.Follow(leader.IsLeader, stopCh)
+			}()
+		} else {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				refresher.Run(ctx)
+			}()
+		}
 	}
 
 	// construct the provider
-	cwProvider, err := cmd.makeProvider(cwClient, cache)
+	// cluster metrics match namespaces against their selector with the shared namespace informer
+	cwProvider, err := cmd.makeProvider(kubeInformerFactory.Core().V1().Namespaces().Lister(), sources, cache, valueCache, smoothingState, recorder, debugStore)
 	if err != nil {
-		klog.Fatalf("unable to construct CloudWatch metrics provider: %v", err)
+		logging.Fatal(err, "Unable to construct CloudWatch metrics provider")
 	}
 
 	cmd.WithExternalMetrics(cwProvider)
 
-	klog.Info("CloudWatch metrics adapter started")
+	if debugStore != nil {
+		if err := cmd.addDebugHandler(debug.Path, debug.NewHandler(cache, debugStore)); err != nil {
+			logging.Fatal(err, "Unable to add debug endpoint")
+		}
+	}
 
+	// scale idle workloads to zero on the values served to the HPA
+	if cmd.AdapterConfig.Controller.ScaleToZero {
+		activation := controller.NewActivationController(kubeClientSet, kubeInformerFactory, cwProvider, recorder, cmd.AdapterConfig.Controller.ActivationInterval.Duration)
+		runActivation := func(ctx context.Context) {
+			if err := activation.Run(ctx.Done()); err != nil {
+				logging.Error(err, "Unable to run activation controller")
+			}
+		}
+		if leader != nil {
+			// only the leader scales workloads, the cooldowns are kept on the workloads
+			leader.Add(runActivation)
+		} else {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runActivation(ctx)
+			}()
+		}
+	}
+	go kubeInformerFactory.Start(stopCh)
+
+	if leader != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			leader.Run(stopCh)
+		}()
+	}
+
+	// only report ready once the metric cache holds the metrics defined in the cluster
+	if err := cmd.addReadyzCheck(healthz.NamedCheck("metric-controller", func(_ *http.Request) error {
+		if !ctrl.HasSynced() {
+			return errors.New("metric controller has not synced")
+		}
+		return nil
+	})); err != nil {
+		logging.Fatal(err, "Unable to add readiness check")
+	}
+
+	logging.Info("CloudWatch metrics adapter started")
+
+	// returns once the in-flight requests completed after stopCh is closed
 	if err := cmd.Run(stopCh); err != nil {
-		klog.Fatalf("unable to run CloudWatch metrics adapter: %v", err)
+		logging.Fatal(err, "Unable to run CloudWatch metrics adapter")
 	}
+
+	logging.Info("Waiting for background work to complete")
+	wg.Wait()
+	logging.Info("CloudWatch metrics adapter stopped")
+}
+
+// podNamespace returns the namespace the adapter is running in.
+func podNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+
+	if data, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+
+	return "custom-metrics"
 }
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/aws"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/manifest"
+	cwprov "github.com/awslabs/k8s-cloudwatch-adapter/pkg/provider"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/templating"
+)
+
+// options holds the command line flags.
+type options struct {
+	execute    bool
+	configFile string
+	endpoint   string
+	region     string
+
+	metricNamespace string
+	metricName      string
+	dimensions      []string
+	namespace       string
+}
+
+const usage = `Usage: cwadapter COMMAND [flags]
+
+Commands:
+  validate FILE...  Validate ExternalMetric and ClusterExternalMetric manifests and print the
+                    query of each of them, such as a CloudWatch GetMetricData request. Use - to
+                    read from standard input.
+  discover          List the CloudWatch metrics matching filters and print an ExternalMetric
+                    manifest for each of them.
+
+Run cwadapter COMMAND --help for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	opts := options{}
+	command := os.Args[1]
+	flags := pflag.NewFlagSet("cwadapter "+command, pflag.ExitOnError)
+	flags.StringVar(&opts.configFile, "config", "",
+		"path of the adapter configuration file providing the AWS settings and ExternalMetric defaults")
+	flags.StringVar(&opts.endpoint, "endpoint", "",
+		"URL of the CloudWatch API, for example a local stub, overrides the configuration file")
+	flags.StringVar(&opts.region, "region", "",
+		"region queried when a manifest does not set one, overrides the configuration file")
+
+	var run func(opts options, cfg *config.AdapterConfig, args []string) bool
+	switch command {
+	case "validate":
+		flags.BoolVar(&opts.execute, "execute", false,
+			"send the queries and print the samples returned and the value reported to the HPA")
+		run = validate
+	case "discover":
+		flags.StringVar(&opts.metricNamespace, "metric-namespace", "",
+			"CloudWatch namespace of the metrics, for example AWS/SQS")
+		flags.StringVar(&opts.metricName, "metric-name", "",
+			"name of the metrics, all the metrics of the namespace when empty")
+		flags.StringArrayVar(&opts.dimensions, "dimension", nil,
+			"dimension the metrics must have as NAME or NAME=VALUE, may be repeated")
+		flags.StringVar(&opts.namespace, "namespace", "",
+			"Kubernetes namespace of the generated ExternalMetric objects")
+		run = discover
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	flags.Parse(os.Args[2:])
+
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !run(opts, cfg, flags.Args()) {
+		os.Exit(1)
+	}
+}
+
+// validate validates the manifests in the files and prints the request built for each metric.
+func validate(opts options, cfg *config.AdapterConfig, paths []string) bool {
+	if len(paths) == 0 {
+		fmt.Fprintf(os.Stderr, "no manifest given\n")
+		return false
+	}
+
+	sources := newMetricsSources(cfg)
+
+	ok := true
+	for _, path := range paths {
+		objects, err := readManifests(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			ok = false
+			continue
+		}
+
+		for _, obj := range objects {
+			if !dryRun(os.Stdout, path, obj, cfg, sources, opts.execute) {
+				ok = false
+			}
+		}
+	}
+
+	return ok
+}
+
+// discover prints an ExternalMetric manifest for each metric matching the filters.
+func discover(opts options, cfg *config.AdapterConfig, _ []string) bool {
+	filter := aws.MetricFilter{
+		Namespace:  opts.metricNamespace,
+		MetricName: opts.metricName,
+		Dimensions: make(map[string]string, len(opts.dimensions)),
+	}
+	for _, d := range opts.dimensions {
+		parts := strings.SplitN(d, "=", 2)
+		if len(parts) == 2 {
+			filter.Dimensions[parts[0]] = parts[1]
+		} else {
+			filter.Dimensions[parts[0]] = ""
+		}
+	}
+
+	metrics, err := aws.DiscoverMetrics(aws.NewDefaultClient(cfg), filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return false
+	}
+	if len(metrics) == 0 {
+		fmt.Fprintf(os.Stderr, "no metrics found\n")
+		return false
+	}
+
+	for i, metric := range metrics {
+		data, err := yaml.Marshal(aws.NewExternalMetric(metric, opts.namespace))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode manifest: %v\n", err)
+			return false
+		}
+
+		if i > 0 {
+			fmt.Println("---")
+		}
+		fmt.Print(string(data))
+	}
+
+	return true
+}
+
+// loadConfig loads the configuration file and applies the flags overriding it.
+func loadConfig(opts options) (*config.AdapterConfig, error) {
+	cfg := config.NewDefaultConfig()
+	if opts.configFile != "" {
+		var err error
+		if cfg, err = config.Load(opts.configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.endpoint != "" {
+		cfg.AWS.Endpoint = opts.endpoint
+	}
+	if opts.region != "" {
+		cfg.AWS.Region = opts.region
+	}
+
+	if errs := config.Validate(cfg); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	return cfg, nil
+}
+
+// newMetricsSources returns the sources the adapter queries metric values from. Math expressions
+// can't read Kubernetes objects outside of the cluster.
+func newMetricsSources(cfg *config.AdapterConfig) *source.Registry {
+	rateLimiter := aws.NewRateLimiter(cfg)
+	manager := aws.NewCloudWatchManager(cfg, nil, rateLimiter)
+	sources := source.NewRegistry(
+		aws.NewCloudWatchSource(manager),
+		aws.NewPromQLSource(cfg, rateLimiter),
+		aws.NewLogsInsightsSource(cfg, rateLimiter),
+		aws.NewSQSSource(cfg, manager, rateLimiter),
+		aws.NewStreamSource(cfg, manager, rateLimiter))
+	sources.Register(cwprov.NewMathSource(sources, nil))
+	return sources
+}
+
+func readManifests(path string) ([]runtime.Object, error) {
+	if path == "-" {
+		return manifest.Decode(os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return manifest.Decode(f)
+}
+
+// dryRun validates a metric object and prints the request built for it, and the value reported
+// to the HPA when execute is set. It returns false if the object is invalid or the query failed.
+func dryRun(out io.Writer, path string, obj runtime.Object, cfg *config.AdapterConfig, sources *source.Registry, execute bool) bool {
+	var request v1alpha1.ExternalMetric
+	var kind string
+	switch m := obj.(type) {
+	case *v1alpha1.ExternalMetric:
+		request = *m
+		kind = "ExternalMetric"
+	case *v1alpha1.ClusterExternalMetric:
+		request = cwprov.ToExternalMetric(*m)
+		kind = "ClusterExternalMetric"
+	}
+
+	name := request.Name
+	if request.Namespace != "" {
+		name = request.Namespace + "/" + name
+	}
+	metricName := request.Spec.Name
+	if metricName == "" {
+		metricName = request.Name
+	}
+	fmt.Fprintf(out, "%s: %s %s serves external metric %q\n", path, kind, name, metricName)
+
+	// the object templates reference is only known in the cluster
+	if ref := request.Spec.Template; ref != nil {
+		fmt.Fprintf(out, "  templates are resolved by the adapter with %s %s %s\n", ref.APIVersion, ref.Kind, ref.Name)
+		if errs := templating.Validate(request.Spec, field.NewPath("spec")); len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Fprintf(out, "  invalid: %v\n", err)
+			}
+			return false
+		}
+		return true
+	}
+
+	if errs := sources.Validate(request.Spec, field.NewPath("spec")); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(out, "  invalid: %v\n", err)
+		}
+		return false
+	}
+
+	switch spec := request.Spec; {
+	case spec.PromQL != nil:
+		fmt.Fprintf(out, "  PromQL query to %s:\n    %s\n", spec.PromQL.WorkspaceURL, spec.PromQL.Query)
+	case spec.LogsInsights != nil:
+		fmt.Fprintf(out, "  Logs Insights query over %s, value of field %s:\n    %s\n",
+			strings.Join(spec.LogsInsights.LogGroupNames, ", "), spec.LogsInsights.Field, spec.LogsInsights.QueryString)
+	case spec.SQS != nil:
+		fmt.Fprintf(out, "  SQS attributes of %s%s: %v\n", spec.SQS.QueueName, spec.SQS.QueueURL, spec.SQS.Attributes)
+	case spec.Stream != nil:
+		value := spec.Stream.Value
+		if value == "" {
+			value = "OpenShardCount"
+		}
+		fmt.Fprintf(out, "  %s of stream %s%s\n", value, spec.Stream.KinesisStreamName, spec.Stream.DynamoDBStreamARN)
+	case spec.Math != nil:
+		fmt.Fprintf(out, "  math expression evaluated in the adapter:\n    %s\n", spec.Math.Expression)
+		for _, mathSource := range spec.Math.Sources {
+			if k := mathSource.Kubernetes; k != nil {
+				fmt.Fprintf(out, "    %s: field %s of %s %s/%s %s\n", mathSource.ID, k.FieldPath, k.Kind, k.APIVersion, k.Name, k.Namespace)
+				continue
+			}
+			s, _ := sources.For(source.QueryRequest(request, mathSource.SeriesQuery).Spec)
+			fmt.Fprintf(out, "    %s: %s query\n", mathSource.ID, s.Name())
+		}
+	default:
+		requests := aws.SplitRequest(request)
+		for i := range requests {
+			input := aws.NewGetMetricDataInput(requests[i], cfg.ExternalMetricDefaults.QueryWindow.Duration, time.Now())
+			if len(requests) > 1 {
+				fmt.Fprintf(out, "  GetMetricDataInput sent to region %s with role %s:\n", awssdk.StringValue(requests[i].Spec.Region), awssdk.StringValue(requests[i].Spec.RoleARN))
+			} else {
+				fmt.Fprintf(out, "  GetMetricDataInput:\n")
+			}
+			printValue(out, input)
+		}
+		if combine := spec.Combine; combine != nil {
+			fmt.Fprintf(out, "  combined with: %s%s\n", combine.Function, combine.Expression)
+		}
+	}
+
+	if !execute {
+		return true
+	}
+
+	samples, err := sources.Query(context.Background(), request)
+	if err != nil {
+		fmt.Fprintf(out, "  query failed: %v\n", err)
+		return false
+	}
+
+	fmt.Fprintf(out, "  samples:\n")
+	for _, sample := range samples {
+		fmt.Fprintf(out, "    %v %v %v\n", sample.Labels, sample.Timestamp.Format(time.RFC3339), sample.Value)
+	}
+
+	value := cwprov.MetricQuantity(samples, request.Spec.Transform)
+	fmt.Fprintf(out, "  value: %s\n", value.String())
+	return true
+}
+
+// printValue prints an AWS API value the way the AWS SDK logs it, omitting unset fields.
+func printValue(out io.Writer, v interface{}) {
+	fmt.Fprintf(out, "  %s\n", strings.Replace(awsutil.Prettify(v), "\n", "\n  ", -1))
+}
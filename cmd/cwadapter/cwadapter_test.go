@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// fakeSource handles every metric and returns the same samples.
+type fakeSource struct {
+	samples []source.Sample
+	err     error
+	queried bool
+}
+
+func (s *fakeSource) Name() string {
+	return "fake"
+}
+
+func (s *fakeSource) Handles(spec v1alpha1.MetricSeriesSpec) bool {
+	return true
+}
+
+func (s *fakeSource) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	return nil
+}
+
+func (s *fakeSource) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]source.Sample, error) {
+	s.queried = true
+	return s.samples, s.err
+}
+
+func newQueueMetric() *v1alpha1.ExternalMetric {
+	returnData := true
+	return &v1alpha1.ExternalMetric{
+		ObjectMeta: metav1.ObjectMeta{Name: "queue-length", Namespace: "default"},
+		Spec: v1alpha1.MetricSeriesSpec{
+			Queries: []v1alpha1.MetricDataQuery{{
+				ID: "m1",
+				MetricStat: v1alpha1.MetricStat{
+					Metric: v1alpha1.Metric{
+						Namespace:  "AWS/SQS",
+						MetricName: "ApproximateNumberOfMessagesVisible",
+						Dimensions: []v1alpha1.Dimension{{Name: "QueueName", Value: "helloworld"}},
+					},
+					Period: 60,
+					Stat:   "Average",
+				},
+				ReturnData: &returnData,
+			}},
+		},
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	templated := newQueueMetric()
+	templated.Spec.Template = &v1alpha1.TemplateReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "consumer"}
+	templated.Spec.Queries[0].MetricStat.Metric.Dimensions[0].Value = "{{ .metadata.labels.queue }}"
+
+	invalidTemplate := templated.DeepCopy()
+	invalidTemplate.Spec.Queries[0].MetricStat.Metric.Dimensions[0].Value = "{{ .metadata.labels.queue"
+
+	noQuery := newQueueMetric()
+	noQuery.Spec.Queries = nil
+
+	tests := []struct {
+		name string
+		obj  runtime.Object
+		ok   bool
+		want []string
+	}{
+		{
+			name: "CloudWatch metric",
+			obj:  newQueueMetric(),
+			ok:   true,
+			want: []string{
+				`ExternalMetric default/queue-length serves external metric "queue-length"`,
+				"GetMetricDataInput:",
+				"ApproximateNumberOfMessagesVisible",
+			},
+		},
+		{
+			name: "cluster metric",
+			obj: &v1alpha1.ClusterExternalMetric{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster-queue-length"},
+				Spec:       v1alpha1.ClusterMetricSeriesSpec{MetricSeriesSpec: newQueueMetric().Spec},
+			},
+			ok:   true,
+			want: []string{`ClusterExternalMetric cluster-queue-length serves external metric "cluster-queue-length"`},
+		},
+		{
+			name: "templated metric",
+			obj:  templated,
+			ok:   true,
+			want: []string{"templates are resolved by the adapter with apps/v1 Deployment consumer"},
+		},
+		{
+			name: "invalid template",
+			obj:  invalidTemplate,
+			ok:   false,
+			want: []string{"invalid: spec.queries[0]"},
+		},
+		{
+			name: "no query",
+			obj:  noQuery,
+			ok:   false,
+			want: []string{"invalid: spec: Required value"},
+		},
+	}
+
+	cfg := config.NewDefaultConfig()
+	sources := newMetricsSources(cfg)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if ok := dryRun(&out, "metric.yaml", tt.obj, cfg, sources, false); ok != tt.ok {
+				t.Errorf("dryRun() = %v, want %v\n%s", ok, tt.ok, out.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("dryRun() output doesn't contain %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestDryRunExecute(t *testing.T) {
+	timestamp := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		execute bool
+		source  *fakeSource
+		ok      bool
+		want    string
+	}{
+		{
+			name:   "not executed",
+			source: &fakeSource{},
+			ok:     true,
+		},
+		{
+			name:    "executed",
+			execute: true,
+			source:  &fakeSource{samples: []source.Sample{{Value: 12, Timestamp: timestamp}}},
+			ok:      true,
+			want:    "value: 12",
+		},
+		{
+			name:    "query failed",
+			execute: true,
+			source:  &fakeSource{err: errors.New("access denied")},
+			ok:      false,
+			want:    "query failed: fake: access denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			ok := dryRun(&out, "metric.yaml", newQueueMetric(), config.NewDefaultConfig(), source.NewRegistry(tt.source), tt.execute)
+			if ok != tt.ok {
+				t.Errorf("dryRun() = %v, want %v\n%s", ok, tt.ok, out.String())
+			}
+			if tt.source.queried != tt.execute {
+				t.Errorf("source queried = %v, want %v", tt.source.queried, tt.execute)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("dryRun() output doesn't contain %q:\n%s", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	cfg, err := loadConfig(options{endpoint: "http://localhost:4566", region: "eu-west-1"})
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if cfg.AWS.Endpoint != "http://localhost:4566" {
+		t.Errorf("endpoint = %q, want the --endpoint flag", cfg.AWS.Endpoint)
+	}
+	if cfg.AWS.Region != "eu-west-1" {
+		t.Errorf("region = %q, want the --region flag", cfg.AWS.Region)
+	}
+}
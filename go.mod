@@ -3,15 +3,18 @@ module github.com/awslabs/k8s-cloudwatch-adapter
 go 1.14
 
 require (
-	github.com/aws/aws-sdk-go v1.33.5
+	github.com/aws/aws-sdk-go v1.44.149
 	github.com/kubernetes-incubator/custom-metrics-apiserver v0.0.0-20200323093244-5046ce1afe6b
 	github.com/pkg/errors v0.9.1
-	gopkg.in/yaml.v2 v2.2.8 // indirect
+	github.com/spf13/pflag v1.0.5
+	github.com/stretchr/testify v1.5.1 // indirect
+	k8s.io/api v0.17.7
 	k8s.io/apimachinery v0.17.7
-	k8s.io/apiserver v0.17.7 // indirect
+	k8s.io/apiserver v0.17.7
 	k8s.io/client-go v0.17.7
 	k8s.io/code-generator v0.17.7
 	k8s.io/component-base v0.17.7
 	k8s.io/klog v1.0.0
 	k8s.io/metrics v0.17.7
+	sigs.k8s.io/yaml v1.1.0
 )
@@ -0,0 +1,43 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +genclient:skipVerbs=patch
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterExternalMetric describes a cluster-scoped ExternalMetric resource that can be used from
+// any namespace allowed by its namespace selector.
+type ClusterExternalMetric struct {
+	// TypeMeta is the metadata for the resource, like kind and apiversion
+	metav1.TypeMeta `json:",inline"`
+
+	// ObjectMeta contains the metadata for the particular object (name, self link, labels, etc)
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the custom resource spec
+	Spec ClusterMetricSeriesSpec `json:"spec"`
+}
+
+// ClusterMetricSeriesSpec contains the specification for a cluster-scoped metric series.
+type ClusterMetricSeriesSpec struct {
+	MetricSeriesSpec `json:",inline"`
+
+	// NamespaceSelector restricts the namespaces which may use this metric. If omitted, the
+	// metric is available to every namespace.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterExternalMetricList is a list of ClusterExternalMetric resources
+type ClusterExternalMetricList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterExternalMetric `json:"items"`
+}
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -24,8 +25,14 @@ type ExternalMetric struct {
 
 // MetricSeriesSpec contains the specification for a metric series.
 type MetricSeriesSpec struct {
-	// Name specifies the series name.
-	Name string `json:"name"`
+	// Name specifies the series name, which is the external metric name served to the HPA. If
+	// omitted, the name of the object is used.
+	Name string `json:"name,omitempty"`
+
+	// Template references a Kubernetes object whose fields the string fields of this series use as
+	// Go templates, such as {{ .Labels.queue }}. The templates are resolved again when the object
+	// changes.
+	Template *TemplateReference `json:"template,omitempty"`
 
 	// RoleARN indicate the ARN of IAM role to assume, this metric will be retrieved using this role.
 	RoleARN *string `json:"roleArn,omitempty"`
@@ -34,7 +41,283 @@ type MetricSeriesSpec struct {
 	Region *string `json:"region,omitempty"`
 
 	// Queries specify the CloudWatch metrics query to retrieve data for this series.
-	Queries []MetricDataQuery `json:"queries"`
+	Queries []MetricDataQuery `json:"queries,omitempty"`
+
+	// Combine combines the values of the queries into a single value, in the adapter, which
+	// allows combining the values of queries sent to different regions.
+	Combine *Combine `json:"combine,omitempty"`
+
+	// LabelOptions specifies how CloudWatch formats the labels of the queries.
+	LabelOptions *LabelOptions `json:"labelOptions,omitempty"`
+
+	// MaxDatapoints limits the number of data points CloudWatch returns for the queries. If
+	// omitted, CloudWatch returns up to 100,800 data points.
+	MaxDatapoints *int64 `json:"maxDatapoints,omitempty"`
+
+	// PromQL specifies a PromQL query to retrieve data for this series from an Amazon Managed
+	// Service for Prometheus workspace instead of CloudWatch.
+	PromQL *PromQLQuery `json:"promql,omitempty"`
+
+	// LogsInsights specifies a CloudWatch Logs Insights query to retrieve data for this series
+	// from log events instead of metrics.
+	LogsInsights *LogsInsightsQuery `json:"logsInsights,omitempty"`
+
+	// SQS specifies queue attributes to retrieve from Amazon SQS directly for this series, which
+	// avoids the delay of the SQS metrics published to CloudWatch.
+	SQS *SQSQuery `json:"sqs,omitempty"`
+
+	// Stream specifies a value describing an Amazon Kinesis data stream or DynamoDB stream, such
+	// as its number of open shards, to retrieve for this series.
+	Stream *StreamQuery `json:"stream,omitempty"`
+
+	// Transform converts the values of this series before they are served to the HPA, so that
+	// targets can be written in a convenient unit.
+	Transform *ValueTransform `json:"transform,omitempty"`
+
+	// Smoothing smooths the values of this series over the successive queries of the metric
+	// source, so that a single spiky data point does not trigger a large scale out.
+	Smoothing *Smoothing `json:"smoothing,omitempty"`
+
+	// Guard holds back values which change sharply from the previous value until the next query
+	// confirms them.
+	Guard *Guard `json:"guard,omitempty"`
+
+	// Fallbacks are queried in order when the query of this series fails or returns no data,
+	// the values of the first fallback returning data are served.
+	Fallbacks []SeriesQuery `json:"fallbacks,omitempty"`
+
+	// Math evaluates an expression over the values of queries of any source and of fields of
+	// Kubernetes objects, in the adapter.
+	Math *MathQuery `json:"math,omitempty"`
+}
+
+// TemplateReference references the Kubernetes object the templates of a metric series are
+// executed with.
+type TemplateReference struct {
+	// APIVersion is the API version of the object, such as apps/v1.
+	APIVersion string `json:"apiVersion"`
+
+	// Kind is the kind of the object, one of ConfigMap, Deployment or StatefulSet.
+	Kind string `json:"kind"`
+
+	// Name is the name of the object.
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the object. If omitted, the namespace of the metric is used.
+	// An ExternalMetric may only reference objects in its own namespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// SeriesQuery replaces the query of a metric series, for a fallback or a source of a math
+// expression. Unset fields are those of the series, so that it can run the query of the series in
+// another region or with another role, or run another query.
+type SeriesQuery struct {
+	// RoleARN is the ARN of the IAM role to assume instead of the role of the series.
+	RoleARN *string `json:"roleArn,omitempty"`
+
+	// Region is the region to query instead of the region of the series.
+	Region *string `json:"region,omitempty"`
+
+	// Queries are the CloudWatch queries to run instead of the query of the series.
+	Queries []MetricDataQuery `json:"queries,omitempty"`
+
+	// PromQL is the PromQL query to run instead of the query of the series.
+	PromQL *PromQLQuery `json:"promql,omitempty"`
+
+	// LogsInsights is the Logs Insights query to run instead of the query of the series.
+	LogsInsights *LogsInsightsQuery `json:"logsInsights,omitempty"`
+
+	// SQS is the SQS query to run instead of the query of the series.
+	SQS *SQSQuery `json:"sqs,omitempty"`
+
+	// Stream is the stream query to run instead of the query of the series.
+	Stream *StreamQuery `json:"stream,omitempty"`
+}
+
+// MathQuery is an expression evaluated over the values of its sources, such as
+// IF(pods > 0, messages / pods, messages).
+type MathQuery struct {
+	// Expression combines the values of the sources, referenced by their IDs, with the operators
+	// +, -, *, /, the comparisons <, <=, >, >=, == and !=, and the functions MIN, MAX, AVG, SUM,
+	// IF and FILL.
+	Expression string `json:"expression"`
+
+	// Sources are the values the expression references.
+	Sources []MathSource `json:"sources"`
+}
+
+// MathSource is a value referenced by a math expression, the first value of a query or the value
+// of a field of a Kubernetes object.
+type MathSource struct {
+	// ID identifies the value in the expression.
+	ID string `json:"id"`
+
+	// SeriesQuery is the query of the value. Unset fields are those of the series.
+	SeriesQuery `json:",inline"`
+
+	// Kubernetes is the field of a Kubernetes object to use as the value instead of a query.
+	Kubernetes *KubernetesValue `json:"kubernetes,omitempty"`
+}
+
+// KubernetesValue is a numeric field of a Kubernetes object, such as the number of ready replicas
+// of a deployment.
+type KubernetesValue struct {
+	// APIVersion is the API version of the object, such as apps/v1.
+	APIVersion string `json:"apiVersion"`
+
+	// Kind is the kind of the object, one of ConfigMap, Deployment or StatefulSet.
+	Kind string `json:"kind"`
+
+	// Name is the name of the object.
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the object. If omitted, the namespace of the metric is used.
+	// An ExternalMetric may only read objects in its own namespace.
+	Namespace string `json:"namespace,omitempty"`
+
+	// FieldPath is the path of the field, such as status.readyReplicas. Fields which are not set
+	// have no value, FILL gives them a default value.
+	FieldPath string `json:"fieldPath"`
+}
+
+// Smoothing smooths the values of a series over the successive queries of the metric source.
+type Smoothing struct {
+	// Method is the smoothing method, EWMA for an exponentially weighted moving average or
+	// MovingMedian for the median of the last values.
+	Method string `json:"method"`
+
+	// Alpha is the weight of the newest value in an EWMA, greater than 0 and at most 1. If
+	// omitted, a weight of 0.5 is used.
+	Alpha *resource.Quantity `json:"alpha,omitempty"`
+
+	// Window is the number of values a MovingMedian is computed over. If omitted, the median of
+	// the last 3 values is used.
+	Window int32 `json:"window,omitempty"`
+}
+
+// Guard holds back values which change sharply from the previous value.
+type Guard struct {
+	// MaxChangePercent is the largest change, in percent of the previous value, accepted from
+	// one query to the next. A larger change is only accepted when the next query confirms it
+	// with a change in the same direction, until then the previous value is served.
+	MaxChangePercent int32 `json:"maxChangePercent"`
+}
+
+// ValueTransform converts the values of a series. The steps are applied in the order of the
+// fields: unit conversion, scale, offset, clamping and rounding.
+type ValueTransform struct {
+	// FromUnit is the unit of the values, such as Bytes or Milliseconds. It must be set together
+	// with ToUnit.
+	FromUnit string `json:"fromUnit,omitempty"`
+
+	// ToUnit is the unit the values are converted to, such as Mebibytes or Seconds. It must be of
+	// the same kind as FromUnit.
+	ToUnit string `json:"toUnit,omitempty"`
+
+	// Scale multiplies the values.
+	Scale *resource.Quantity `json:"scale,omitempty"`
+
+	// Offset is added to the values.
+	Offset *resource.Quantity `json:"offset,omitempty"`
+
+	// Min is the smallest value served, smaller values are raised to it.
+	Min *resource.Quantity `json:"min,omitempty"`
+
+	// Max is the largest value served, larger values are lowered to it.
+	Max *resource.Quantity `json:"max,omitempty"`
+
+	// Round rounds the values to an integer, one of Floor, Ceiling or Nearest. If omitted, values
+	// are served with a precision of a thousandth.
+	Round string `json:"round,omitempty"`
+}
+
+// Combine combines the values of the queries of a series into a single value. Exactly one of
+// Function or Expression must be specified.
+type Combine struct {
+	// Function is applied to the values of every query returning data, one of Sum, Max, Min or
+	// Average.
+	Function string `json:"function,omitempty"`
+
+	// Expression is an arithmetic expression over the IDs of the queries, such as
+	// (east + west) / 2, supporting +, -, *, / and parentheses.
+	Expression string `json:"expression,omitempty"`
+}
+
+// LabelOptions specifies how CloudWatch formats the labels of the series of a query.
+type LabelOptions struct {
+	// Timezone is the offset used for the dates and times in labels, such as +0130 or -0700. If
+	// omitted, UTC is used.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// PromQLQuery is an instant PromQL query sent to a Prometheus compatible HTTP API.
+type PromQLQuery struct {
+	// WorkspaceURL is the URL of the workspace, such as
+	// https://aps-workspaces.us-west-2.amazonaws.com/workspaces/ws-1234. Requests are sent to the
+	// api/v1/query path below it.
+	WorkspaceURL string `json:"workspaceUrl"`
+
+	// Query is the PromQL expression, evaluated at the time of the request.
+	Query string `json:"query"`
+}
+
+// LogsInsightsQuery is a CloudWatch Logs Insights query whose result rows are served as values.
+type LogsInsightsQuery struct {
+	// LogGroupNames are the log groups the query runs over.
+	LogGroupNames []string `json:"logGroupNames"`
+
+	// QueryString is the Logs Insights query, such as
+	// filter @message like /job enqueued/ | stats count(*) as enqueued.
+	QueryString string `json:"queryString"`
+
+	// Field is the name of the result field holding the value, the other fields of a row are kept
+	// as labels of the value.
+	Field string `json:"field"`
+
+	// Window is how far back log events are queried. If omitted, the query window of the adapter
+	// configuration is used.
+	Window *metav1.Duration `json:"window,omitempty"`
+}
+
+// SQSQuery retrieves the attributes of an Amazon SQS queue.
+type SQSQuery struct {
+	// QueueURL is the URL of the queue. Exactly one of QueueURL or QueueName must be specified.
+	QueueURL string `json:"queueUrl,omitempty"`
+
+	// QueueName is the name of the queue in the account of the adapter, or of RoleARN when set.
+	QueueName string `json:"queueName,omitempty"`
+
+	// Attributes are summed into the value of the series, named after the CloudWatch metrics of
+	// the queue: ApproximateNumberOfMessagesVisible, ApproximateNumberOfMessagesNotVisible and
+	// ApproximateNumberOfMessagesDelayed. ApproximateAgeOfOldestMessage is not an attribute of the
+	// queue, it is retrieved from CloudWatch and may not be combined with other attributes. If
+	// omitted, ApproximateNumberOfMessagesVisible is used.
+	Attributes []string `json:"attributes,omitempty"`
+
+	// Divisor the value is divided by, such as the number of messages a replica processes at
+	// once.
+	Divisor *resource.Quantity `json:"divisor,omitempty"`
+}
+
+// StreamQuery retrieves a value describing a stream and its consumers.
+type StreamQuery struct {
+	// KinesisStreamName is the name of a Kinesis data stream. Exactly one of KinesisStreamName or
+	// DynamoDBStreamARN must be specified.
+	KinesisStreamName string `json:"kinesisStreamName,omitempty"`
+
+	// DynamoDBStreamARN is the ARN of a DynamoDB stream. Exactly one of KinesisStreamName or
+	// DynamoDBStreamARN must be specified.
+	DynamoDBStreamARN string `json:"dynamoDBStreamArn,omitempty"`
+
+	// Value is the value of the series: OpenShardCount, IteratorAgeMilliseconds, the maximum
+	// GetRecords.IteratorAgeMilliseconds of a Kinesis data stream, or LaggingShardCount, the number
+	// of open shards of a Kinesis data stream whose iterator age exceeds IteratorAgeThreshold. If
+	// omitted, OpenShardCount is used.
+	Value string `json:"value,omitempty"`
+
+	// IteratorAgeThreshold is the iterator age above which a shard is lagging, required for
+	// LaggingShardCount.
+	IteratorAgeThreshold *metav1.Duration `json:"iteratorAgeThreshold,omitempty"`
 }
 
 // MetricDataQuery represents the query structure used in GetMetricData operation to CloudWatch API.
@@ -44,10 +327,38 @@ type MetricDataQuery struct {
 	// see Metric Math Syntax and Functions (http://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/using-metric-math.html#metric-math-syntax)
 	// in the Amazon CloudWatch User Guide.
 	//
-	// Within one MetricDataQuery structure, you must specify either Expression
-	// or MetricStat but not both.
+	// Within one MetricDataQuery structure, you must specify exactly one of Expression,
+	// SQL or MetricStat.
 	Expression string `json:"expression,omitempty"`
 
+	// A CloudWatch Metrics Insights query, such as
+	// SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId.
+	// A query with GROUP BY returns a series per group, labelled with the GROUP BY keys and
+	// their values. Metrics Insights only queries the most recent three hours of data.
+	//
+	// Within one MetricDataQuery structure, you must specify exactly one of Expression,
+	// SQL or MetricStat.
+	SQL string `json:"sql,omitempty"`
+
+	// The granularity, in seconds, of the data points returned for an expression or SQL query. It
+	// must be 1, 5, 10, 30 or a multiple of 60. If omitted, a SQL query uses a period of 60 and an
+	// expression the period of the metrics it uses. A MetricStat sets its own period.
+	Period int64 `json:"period,omitempty"`
+
+	// The ID of the account the metric or expression is retrieved from, when the adapter runs
+	// with the credentials of a CloudWatch cross-account observability monitoring account. If
+	// omitted, the account of the credentials is used.
+	AccountID string `json:"accountId,omitempty"`
+
+	// The region the query is sent to, instead of the region of the series. Queries with
+	// different regions or roles are sent concurrently in separate requests, so an expression
+	// can only reference queries of the same region and role. Use Combine to combine values
+	// across regions.
+	Region *string `json:"region,omitempty"`
+
+	// The ARN of the IAM role the query is sent with, instead of the role of the series.
+	RoleARN *string `json:"roleArn,omitempty"`
+
 	// A short name used to tie this structure to the results in the response. This
 	// name must be unique within a single call to GetMetricData. If you are performing
 	// math expressions on this set of data, this name represents that data and
@@ -68,8 +379,8 @@ type MetricDataQuery struct {
 	// this parameter only if this structure is performing a data retrieval and
 	// not performing a math expression on the returned data.
 	//
-	// Within one MetricDataQuery structure, you must specify either Expression
-	// or MetricStat but not both.
+	// Within one MetricDataQuery structure, you must specify exactly one of Expression,
+	// SQL or MetricStat.
 	MetricStat MetricStat `json:"metricStat"`
 
 	// Indicates whether to return the time stamps and raw data values of this metric.
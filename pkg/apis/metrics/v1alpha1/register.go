@@ -31,6 +31,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		SchemeGroupVersion,
 		&ExternalMetric{},
 		&ExternalMetricList{},
+		&ClusterExternalMetric{},
+		&ClusterExternalMetricList{},
 	)
 
 	// register the type in the scheme
@@ -18,9 +18,108 @@
 package v1alpha1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterExternalMetric) DeepCopyInto(out *ClusterExternalMetric) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterExternalMetric.
+func (in *ClusterExternalMetric) DeepCopy() *ClusterExternalMetric {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterExternalMetric)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterExternalMetric) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterExternalMetricList) DeepCopyInto(out *ClusterExternalMetricList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterExternalMetric, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterExternalMetricList.
+func (in *ClusterExternalMetricList) DeepCopy() *ClusterExternalMetricList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterExternalMetricList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterExternalMetricList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterMetricSeriesSpec) DeepCopyInto(out *ClusterMetricSeriesSpec) {
+	*out = *in
+	in.MetricSeriesSpec.DeepCopyInto(&out.MetricSeriesSpec)
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterMetricSeriesSpec.
+func (in *ClusterMetricSeriesSpec) DeepCopy() *ClusterMetricSeriesSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterMetricSeriesSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Combine) DeepCopyInto(out *Combine) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Combine.
+func (in *Combine) DeepCopy() *Combine {
+	if in == nil {
+		return nil
+	}
+	out := new(Combine)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Dimension) DeepCopyInto(out *Dimension) {
 	*out = *in
@@ -97,6 +196,125 @@ func (in *ExternalMetricList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Guard) DeepCopyInto(out *Guard) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Guard.
+func (in *Guard) DeepCopy() *Guard {
+	if in == nil {
+		return nil
+	}
+	out := new(Guard)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubernetesValue) DeepCopyInto(out *KubernetesValue) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesValue.
+func (in *KubernetesValue) DeepCopy() *KubernetesValue {
+	if in == nil {
+		return nil
+	}
+	out := new(KubernetesValue)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LabelOptions) DeepCopyInto(out *LabelOptions) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LabelOptions.
+func (in *LabelOptions) DeepCopy() *LabelOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(LabelOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LogsInsightsQuery) DeepCopyInto(out *LogsInsightsQuery) {
+	*out = *in
+	if in.LogGroupNames != nil {
+		in, out := &in.LogGroupNames, &out.LogGroupNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Window != nil {
+		in, out := &in.Window, &out.Window
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LogsInsightsQuery.
+func (in *LogsInsightsQuery) DeepCopy() *LogsInsightsQuery {
+	if in == nil {
+		return nil
+	}
+	out := new(LogsInsightsQuery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MathQuery) DeepCopyInto(out *MathQuery) {
+	*out = *in
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]MathSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MathQuery.
+func (in *MathQuery) DeepCopy() *MathQuery {
+	if in == nil {
+		return nil
+	}
+	out := new(MathQuery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MathSource) DeepCopyInto(out *MathSource) {
+	*out = *in
+	in.SeriesQuery.DeepCopyInto(&out.SeriesQuery)
+	if in.Kubernetes != nil {
+		in, out := &in.Kubernetes, &out.Kubernetes
+		*out = new(KubernetesValue)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MathSource.
+func (in *MathSource) DeepCopy() *MathSource {
+	if in == nil {
+		return nil
+	}
+	out := new(MathSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Metric) DeepCopyInto(out *Metric) {
 	*out = *in
@@ -121,6 +339,16 @@ func (in *Metric) DeepCopy() *Metric {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetricDataQuery) DeepCopyInto(out *MetricDataQuery) {
 	*out = *in
+	if in.Region != nil {
+		in, out := &in.Region, &out.Region
+		*out = new(string)
+		**out = **in
+	}
+	if in.RoleARN != nil {
+		in, out := &in.RoleARN, &out.RoleARN
+		*out = new(string)
+		**out = **in
+	}
 	in.MetricStat.DeepCopyInto(&out.MetricStat)
 	if in.ReturnData != nil {
 		in, out := &in.ReturnData, &out.ReturnData
@@ -143,6 +371,11 @@ func (in *MetricDataQuery) DeepCopy() *MetricDataQuery {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetricSeriesSpec) DeepCopyInto(out *MetricSeriesSpec) {
 	*out = *in
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = new(TemplateReference)
+		**out = **in
+	}
 	if in.RoleARN != nil {
 		in, out := &in.RoleARN, &out.RoleARN
 		*out = new(string)
@@ -160,6 +393,68 @@ func (in *MetricSeriesSpec) DeepCopyInto(out *MetricSeriesSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Combine != nil {
+		in, out := &in.Combine, &out.Combine
+		*out = new(Combine)
+		**out = **in
+	}
+	if in.LabelOptions != nil {
+		in, out := &in.LabelOptions, &out.LabelOptions
+		*out = new(LabelOptions)
+		**out = **in
+	}
+	if in.MaxDatapoints != nil {
+		in, out := &in.MaxDatapoints, &out.MaxDatapoints
+		*out = new(int64)
+		**out = **in
+	}
+	if in.PromQL != nil {
+		in, out := &in.PromQL, &out.PromQL
+		*out = new(PromQLQuery)
+		**out = **in
+	}
+	if in.LogsInsights != nil {
+		in, out := &in.LogsInsights, &out.LogsInsights
+		*out = new(LogsInsightsQuery)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SQS != nil {
+		in, out := &in.SQS, &out.SQS
+		*out = new(SQSQuery)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Stream != nil {
+		in, out := &in.Stream, &out.Stream
+		*out = new(StreamQuery)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Transform != nil {
+		in, out := &in.Transform, &out.Transform
+		*out = new(ValueTransform)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Smoothing != nil {
+		in, out := &in.Smoothing, &out.Smoothing
+		*out = new(Smoothing)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Guard != nil {
+		in, out := &in.Guard, &out.Guard
+		*out = new(Guard)
+		**out = **in
+	}
+	if in.Fallbacks != nil {
+		in, out := &in.Fallbacks, &out.Fallbacks
+		*out = make([]SeriesQuery, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Math != nil {
+		in, out := &in.Math, &out.Math
+		*out = new(MathQuery)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -189,3 +484,192 @@ func (in *MetricStat) DeepCopy() *MetricStat {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PromQLQuery) DeepCopyInto(out *PromQLQuery) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PromQLQuery.
+func (in *PromQLQuery) DeepCopy() *PromQLQuery {
+	if in == nil {
+		return nil
+	}
+	out := new(PromQLQuery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SQSQuery) DeepCopyInto(out *SQSQuery) {
+	*out = *in
+	if in.Attributes != nil {
+		in, out := &in.Attributes, &out.Attributes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Divisor != nil {
+		in, out := &in.Divisor, &out.Divisor
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQSQuery.
+func (in *SQSQuery) DeepCopy() *SQSQuery {
+	if in == nil {
+		return nil
+	}
+	out := new(SQSQuery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SeriesQuery) DeepCopyInto(out *SeriesQuery) {
+	*out = *in
+	if in.RoleARN != nil {
+		in, out := &in.RoleARN, &out.RoleARN
+		*out = new(string)
+		**out = **in
+	}
+	if in.Region != nil {
+		in, out := &in.Region, &out.Region
+		*out = new(string)
+		**out = **in
+	}
+	if in.Queries != nil {
+		in, out := &in.Queries, &out.Queries
+		*out = make([]MetricDataQuery, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PromQL != nil {
+		in, out := &in.PromQL, &out.PromQL
+		*out = new(PromQLQuery)
+		**out = **in
+	}
+	if in.LogsInsights != nil {
+		in, out := &in.LogsInsights, &out.LogsInsights
+		*out = new(LogsInsightsQuery)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SQS != nil {
+		in, out := &in.SQS, &out.SQS
+		*out = new(SQSQuery)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Stream != nil {
+		in, out := &in.Stream, &out.Stream
+		*out = new(StreamQuery)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SeriesQuery.
+func (in *SeriesQuery) DeepCopy() *SeriesQuery {
+	if in == nil {
+		return nil
+	}
+	out := new(SeriesQuery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Smoothing) DeepCopyInto(out *Smoothing) {
+	*out = *in
+	if in.Alpha != nil {
+		in, out := &in.Alpha, &out.Alpha
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Smoothing.
+func (in *Smoothing) DeepCopy() *Smoothing {
+	if in == nil {
+		return nil
+	}
+	out := new(Smoothing)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StreamQuery) DeepCopyInto(out *StreamQuery) {
+	*out = *in
+	if in.IteratorAgeThreshold != nil {
+		in, out := &in.IteratorAgeThreshold, &out.IteratorAgeThreshold
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StreamQuery.
+func (in *StreamQuery) DeepCopy() *StreamQuery {
+	if in == nil {
+		return nil
+	}
+	out := new(StreamQuery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateReference) DeepCopyInto(out *TemplateReference) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateReference.
+func (in *TemplateReference) DeepCopy() *TemplateReference {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValueTransform) DeepCopyInto(out *ValueTransform) {
+	*out = *in
+	if in.Scale != nil {
+		in, out := &in.Scale, &out.Scale
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Offset != nil {
+		in, out := &in.Offset, &out.Offset
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Min != nil {
+		in, out := &in.Min, &out.Min
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValueTransform.
+func (in *ValueTransform) DeepCopy() *ValueTransform {
+	if in == nil {
+		return nil
+	}
+	out := new(ValueTransform)
+	in.DeepCopyInto(out)
+	return out
+}
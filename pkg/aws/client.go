@@ -2,7 +2,8 @@ package aws
 
 import (
 	"context"
-	"os"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
@@ -10,75 +11,274 @@ import (
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/debug"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
-	"k8s.io/klog"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
-func NewCloudWatchManager() CloudWatchManager {
-	return &cloudwatchManager{
-		localRegion: GetLocalRegion(),
-	}
+// NewCloudWatchManager returns a CloudWatchManager recording the queries it sends to the debug
+// store, which is optional. The rate limiter is shared with the other sources querying AWS.
+func NewCloudWatchManager(cfg *config.AdapterConfig, store *debug.Store, rateLimiter *RateLimiter) CloudWatchManager {
+	manager := &cloudwatchManager{settings: settings{rateLimiter: rateLimiter}, store: store}
+	manager.Configure(cfg)
+	return manager
 }
 
 type cloudwatchManager struct {
-	localRegion string
+	settings
+	store *debug.Store
+}
+
+// settings holds the adapter configuration applied to the queries of a source querying AWS.
+type settings struct {
+	// the local region is only looked up when a query does not set a region
+	localRegionOnce sync.Once
+	localRegion     string
+
+	configLock sync.RWMutex
+	config     *config.AdapterConfig
+	// rateLimiter is shared by the sources, the rate limit applies to the queries of all of them
+	rateLimiter *RateLimiter
+}
+
+func (s *settings) Configure(cfg *config.AdapterConfig) {
+	s.rateLimiter.Configure(cfg)
+
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+
+	s.config = cfg
+}
+
+func (s *settings) getConfig() (*config.AdapterConfig, flowcontrol.RateLimiter) {
+	s.configLock.RLock()
+	defer s.configLock.RUnlock()
+
+	return s.config, s.rateLimiter.get()
+}
+
+// RateLimiter limits the queries sent to AWS. A single RateLimiter is shared by the sources so
+// the rate limit of the configuration applies to all their queries together.
+type RateLimiter struct {
+	lock       sync.RWMutex
+	configured bool
+	rateLimit  config.RateLimitConfig
+	limiter    flowcontrol.RateLimiter
+}
+
+// NewRateLimiter returns a RateLimiter applying the rate limit of the configuration.
+func NewRateLimiter(cfg *config.AdapterConfig) *RateLimiter {
+	r := &RateLimiter{}
+	r.Configure(cfg)
+	return r
+}
+
+// Configure applies the rate limit of a new configuration. The limiter is only replaced when the
+// rate limit changes, as each source sharing it applies the same configuration.
+func (r *RateLimiter) Configure(cfg *config.AdapterConfig) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.configured && r.rateLimit == cfg.RateLimit {
+		return
+	}
+	r.limiter = newRateLimiter(cfg)
+	r.rateLimit = cfg.RateLimit
+	r.configured = true
+}
+
+func (r *RateLimiter) get() flowcontrol.RateLimiter {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.limiter
+}
+
+// getRegion returns the region of a query, falling back to the region of the configuration and
+// then to the region the adapter runs in.
+func (s *settings) getRegion(cfg *config.AdapterConfig, region *string) *string {
+	if region != nil {
+		return region
+	}
+	if cfg.AWS.Region != "" {
+		return aws.String(cfg.AWS.Region)
+	}
+
+	s.localRegionOnce.Do(func() { s.localRegion = GetLocalRegion() })
+	return aws.String(s.localRegion)
 }
 
-func (c *cloudwatchManager) getClient(role, region *string) *cloudwatch.CloudWatch {
-	// Using the Config value, create the CloudWatch client
+func (c *cloudwatchManager) getClient(cfg *config.AdapterConfig, role, region *string) *cloudwatch.CloudWatch {
+	return NewClient(cfg, role, c.getRegion(cfg, region))
+}
+
+// NewClient returns a CloudWatch client using the AWS settings of the configuration. The role and
+// region override the defaults of the configuration when set, the region of the environment is
+// used when neither sets one.
+func NewClient(cfg *config.AdapterConfig, role, region *string) *cloudwatch.CloudWatch {
+	sess, awsCfg := newSession(cfg, role, region)
+
+	if cfg.AWS.Endpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(cfg.AWS.Endpoint)
+	}
+
+	svc := cloudwatch.New(sess, awsCfg)
+	return svc
+}
+
+// NewDefaultClient returns a CloudWatch client with the role and region of the configuration,
+// querying the region the adapter runs in when the configuration doesn't set one, like the
+// queries of the adapter.
+func NewDefaultClient(cfg *config.AdapterConfig) *cloudwatch.CloudWatch {
+	var s settings
+	return NewClient(cfg, nil, s.getRegion(cfg, nil))
+}
+
+// newSession returns the session and client configuration used to query AWS, with the
+// credentials of the role when one is set by the query or the configuration.
+func newSession(cfg *config.AdapterConfig, role, region *string) (*session.Session, *aws.Config) {
 	sess := session.Must(session.NewSession())
 
 	// Using the SDK's default configuration, loading additional config
 	// and credentials values from the environment variables, shared
 	// credentials, and shared configuration files
-	cfg := aws.NewConfig().WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint)
+	awsCfg := aws.NewConfig().WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint)
 
 	// check if roleARN is passed
+	if role == nil && cfg.ExternalMetricDefaults.RoleARN != "" {
+		role = aws.String(cfg.ExternalMetricDefaults.RoleARN)
+	}
 	if role != nil {
 		creds := stscreds.NewCredentials(sess, *role)
-		cfg = cfg.WithCredentials(creds)
-		klog.Infof("using IAM role ARN: %s", *role)
+		awsCfg = awsCfg.WithCredentials(creds)
 	}
 
 	// check if region is set
 	if region != nil {
-		cfg = cfg.WithRegion(*region)
-	} else if aws.StringValue(cfg.Region) == "" {
-		cfg.Region = aws.String(c.localRegion)
+		awsCfg = awsCfg.WithRegion(*region)
+	} else if cfg.AWS.Region != "" {
+		awsCfg = awsCfg.WithRegion(cfg.AWS.Region)
 	}
-	klog.Infof("using AWS Region: %s", aws.StringValue(cfg.Region))
+	logging.V(5).Info("Creating AWS session", "role", role, "region", awsCfg.Region)
+	sess.Handlers.Complete.PushBackNamed(logRequest(logging.WithValues("role", role, "region", awsCfg.Region)))
 
-	if os.Getenv("DEBUG") == "true" {
-		cfg = cfg.WithLogLevel(aws.LogDebugWithHTTPBody)
+	if cfg.AWS.MaxRetries != nil {
+		awsCfg = awsCfg.WithMaxRetries(*cfg.AWS.MaxRetries)
 	}
 
-	svc := cloudwatch.New(sess, cfg)
-	return svc
+	if cfg.AWS.Debug {
+		awsCfg = awsCfg.WithLogLevel(aws.LogDebugWithHTTPBody)
+	}
+
+	return sess, awsCfg
+}
+
+// newRateLimiter returns the limiter of the queries sent to AWS, nil when they are not limited.
+func newRateLimiter(cfg *config.AdapterConfig) flowcontrol.RateLimiter {
+	if cfg.RateLimit.QPS > 0 {
+		return flowcontrol.NewTokenBucketRateLimiter(cfg.RateLimit.QPS, cfg.RateLimit.Burst)
+	}
+	return nil
+}
+
+// waitForRateLimit waits until the rate limiter allows a query, or returns an error once the
+// context is done. Queries are not limited when the rate limiter is nil.
+func waitForRateLimit(ctx context.Context, rateLimiter flowcontrol.RateLimiter) error {
+	if rateLimiter == nil {
+		return nil
+	}
+	return errors.Wrap(rateLimiter.Wait(ctx), "unable to wait for the rate limit")
 }
 
-func (c *cloudwatchManager) QueryCloudWatch(request v1alpha1.ExternalMetric) ([]*cloudwatch.MetricDataResult, error) {
+func (c *cloudwatchManager) QueryCloudWatch(ctx context.Context, request v1alpha1.ExternalMetric) ([]*cloudwatch.MetricDataResult, error) {
+	cfg, rateLimiter := c.getConfig()
 	role := request.Spec.RoleARN
 	region := request.Spec.Region
-	cwQuery := toCloudWatchQuery(&request)
-	now := time.Now()
-	endTime := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), 0, 0, now.Location())
-	// CloudWatch metrics have latency, we will grab in a 5 minute window and extract the latest value
-	startTime := endTime.Add(-5 * time.Minute)
+	// CloudWatch metrics have latency, we will grab values in the query window and extract the latest one
+	cwQuery := NewGetMetricDataInput(request, cfg.ExternalMetricDefaults.QueryWindow.Duration, time.Now())
 
-	cwQuery.EndTime = &endTime
-	cwQuery.StartTime = &startTime
-	cwQuery.ScanBy = aws.String("TimestampDescending")
+	if err := waitForRateLimit(ctx, rateLimiter); err != nil {
+		return []*cloudwatch.MetricDataResult{}, err
+	}
 
-	req, resp := c.getClient(role, region).GetMetricDataRequest(&cwQuery)
-	req.SetContext(context.Background())
+	req, resp := c.getClient(cfg, role, region).GetMetricDataRequest(&cwQuery)
+	req.SetContext(ctx)
+
+	start := c.store.Now()
+	err := req.Send()
+	if c.store != nil {
+		query := debug.Query{
+			Time:        metav1.NewTime(start),
+			Region:      aws.StringValue(req.Config.Region),
+			Credentials: credentialsSource(cfg, req, role),
+			Input:       &cwQuery,
+			Results:     resp.MetricDataResults,
+			Latency:     c.store.Now().Sub(start).String(),
+		}
+		if err != nil {
+			query.Error = err.Error()
+		}
+		c.store.RecordQuery(request, query)
+	}
 
-	if err := req.Send(); err != nil {
-		klog.Errorf("err: %v", err)
+	log := logging.ForMetric(request.Namespace, request.Name).WithValues(
+		"role", role, "region", req.Config.Region, "requestID", req.RequestID, "duration", c.store.Now().Sub(start))
+	if err != nil {
+		log.Error(err, "CloudWatch query failed")
 		return []*cloudwatch.MetricDataResult{}, err
 	}
 
+	log.V(4).Info("Queried CloudWatch", "queries", len(cwQuery.MetricDataQueries), "results", len(resp.MetricDataResults))
 	return resp.MetricDataResults, nil
 }
+
+// logRequest returns a handler logging each request sent to AWS once it completes, with the
+// values of the logger.
+func logRequest(log logging.Logger) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "k8s-cloudwatch-adapter.logRequest",
+		Fn: func(r *request.Request) {
+			v := log.V(5)
+			if !v.Enabled() {
+				return
+			}
+
+			keysAndValues := []interface{}{
+				"service", r.ClientInfo.ServiceName,
+				"operation", r.Operation.Name,
+				"requestID", r.RequestID,
+				"duration", time.Since(r.Time),
+			}
+			if r.Error != nil {
+				keysAndValues = append(keysAndValues, "err", r.Error)
+			}
+			v.Info("Sent AWS request", keysAndValues...)
+		},
+	}
+}
+
+// credentialsSource describes where the credentials of a request came from: the provider of the
+// credentials and the role assumed, if any.
+func credentialsSource(cfg *config.AdapterConfig, req *request.Request, role *string) string {
+	if role == nil && cfg.ExternalMetricDefaults.RoleARN != "" {
+		role = aws.String(cfg.ExternalMetricDefaults.RoleARN + " (default role)")
+	}
+
+	// the credentials are cached once the request was signed
+	value, err := req.Config.Credentials.Get()
+	if err != nil {
+		return fmt.Sprintf("unavailable: %v", err)
+	}
+	if role != nil {
+		return fmt.Sprintf("%s: %s", value.ProviderName, *role)
+	}
+	return value.ProviderName
+}
@@ -0,0 +1,116 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/expression"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// The functions combining the values of the queries of a series.
+const (
+	combineSum     = "Sum"
+	combineMax     = "Max"
+	combineMin     = "Min"
+	combineAverage = "Average"
+)
+
+// combinedID is the id label of the sample combining the values of the queries of a series.
+const combinedID = "combined"
+
+// SplitRequest splits a metric request into a request for each region and role its queries are
+// sent with, in the order of their first query. A request whose queries set no region or role is
+// returned unchanged.
+func SplitRequest(request v1alpha1.ExternalMetric) []v1alpha1.ExternalMetric {
+	var requests []v1alpha1.ExternalMetric
+	indexes := map[string]int{}
+	for _, q := range request.Spec.Queries {
+		region, role := request.Spec.Region, request.Spec.RoleARN
+		if q.Region != nil {
+			region = q.Region
+		}
+		if q.RoleARN != nil {
+			role = q.RoleARN
+		}
+
+		key := fmt.Sprintf("%s/%s", aws.StringValue(role), aws.StringValue(region))
+		i, found := indexes[key]
+		if !found {
+			groupRequest := *request.DeepCopy()
+			groupRequest.Spec.Region, groupRequest.Spec.RoleARN, groupRequest.Spec.Queries = region, role, nil
+			requests = append(requests, groupRequest)
+			i = len(requests) - 1
+			indexes[key] = i
+		}
+
+		groupQuery := *q.DeepCopy()
+		groupQuery.Region, groupQuery.RoleARN = nil, nil
+		requests[i].Spec.Queries = append(requests[i].Spec.Queries, groupQuery)
+	}
+	return requests
+}
+
+// combineSamples combines the samples of the queries of a series into a single sample, with the
+// timestamp of the oldest sample. No sample is returned when there is no data, or when a query
+// referenced by the expression has no data.
+func combineSamples(combine *v1alpha1.Combine, samples []source.Sample) ([]source.Sample, error) {
+	if len(samples) == 0 {
+		return nil, nil
+	}
+
+	timestamp := samples[0].Timestamp
+	for _, sample := range samples {
+		if sample.Timestamp.Before(timestamp) {
+			timestamp = sample.Timestamp
+		}
+	}
+
+	var value float64
+	switch combine.Function {
+	case combineSum, combineAverage:
+		for _, sample := range samples {
+			value += sample.Value
+		}
+		if combine.Function == combineAverage {
+			value /= float64(len(samples))
+		}
+	case combineMax:
+		value = math.Inf(-1)
+		for _, sample := range samples {
+			value = math.Max(value, sample.Value)
+		}
+	case combineMin:
+		value = math.Inf(1)
+		for _, sample := range samples {
+			value = math.Min(value, sample.Value)
+		}
+	default:
+		e, err := expression.Parse(combine.Expression)
+		if err != nil {
+			return nil, err
+		}
+
+		vars := map[string]float64{}
+		for _, sample := range samples {
+			if _, found := vars[sample.Labels["id"]]; !found {
+				vars[sample.Labels["id"]] = sample.Value
+			}
+		}
+		if value, err = e.Evaluate(vars); errors.Is(err, expression.ErrNoValue) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return []source.Sample{{
+		Value:     value,
+		Timestamp: timestamp,
+		Labels:    map[string]string{"id": combinedID},
+	}}, nil
+}
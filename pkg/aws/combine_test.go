@@ -0,0 +1,135 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+
+	api "github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// regionalCloudWatchManager returns a result with the value of the region for each query.
+type regionalCloudWatchManager struct {
+	values map[string]float64
+
+	lock     sync.Mutex
+	requests []api.ExternalMetric
+}
+
+func (m *regionalCloudWatchManager) QueryCloudWatch(ctx context.Context, request api.ExternalMetric) ([]*cloudwatch.MetricDataResult, error) {
+	m.lock.Lock()
+	m.requests = append(m.requests, request)
+	m.lock.Unlock()
+
+	value, found := m.values[aws.StringValue(request.Spec.Region)]
+	if !found {
+		return nil, errors.New("unavailable")
+	}
+
+	var results []*cloudwatch.MetricDataResult
+	for _, q := range request.Spec.Queries {
+		results = append(results, &cloudwatch.MetricDataResult{
+			Id:         aws.String(q.ID),
+			Timestamps: []*time.Time{aws.Time(time.Now())},
+			Values:     []*float64{aws.Float64(value)},
+		})
+	}
+	return results, nil
+}
+
+func (m *regionalCloudWatchManager) Configure(cfg *config.AdapterConfig) {}
+
+func newRegionalExternalMetric(combine *api.Combine) api.ExternalMetric {
+	externalMetric := newFullExternalMetric("test")
+	externalMetric.Spec.Region = aws.String("us-east-1")
+	externalMetric.Spec.Queries = []api.MetricDataQuery{
+		{ID: "east", Expression: "SUM(METRICS())"},
+		{ID: "west", Expression: "SUM(METRICS())", Region: aws.String("us-west-2")},
+		{ID: "west_role", Expression: "SUM(METRICS())", Region: aws.String("us-west-2"), RoleARN: aws.String("other")},
+		{ID: "west_2", Expression: "SUM(METRICS())", Region: aws.String("us-west-2")},
+	}
+	externalMetric.Spec.Combine = combine
+	return *externalMetric
+}
+
+func TestSplitRequest(t *testing.T) {
+	requests := SplitRequest(newRegionalExternalMetric(nil))
+	if len(requests) != 3 {
+		t.Fatalf("len(requests) = %d, want 3", len(requests))
+	}
+
+	want := []struct {
+		region, role string
+		ids          []string
+	}{
+		{region: "us-east-1", role: "MyRoleARN", ids: []string{"east"}},
+		{region: "us-west-2", role: "MyRoleARN", ids: []string{"west", "west_2"}},
+		{region: "us-west-2", role: "other", ids: []string{"west_role"}},
+	}
+	for i, w := range want {
+		spec := requests[i].Spec
+		if aws.StringValue(spec.Region) != w.region || aws.StringValue(spec.RoleARN) != w.role || len(spec.Queries) != len(w.ids) {
+			t.Errorf("request %d = %v %v %d queries, want %v %v %v", i, aws.StringValue(spec.Region), aws.StringValue(spec.RoleARN), len(spec.Queries), w.region, w.role, w.ids)
+			continue
+		}
+		for j, q := range spec.Queries {
+			if q.ID != w.ids[j] || q.Region != nil || q.RoleARN != nil {
+				t.Errorf("request %d query %d = %v, want %v without a region or role", i, j, q.ID, w.ids[j])
+			}
+		}
+	}
+}
+
+func TestCloudWatchSourceCombinesRegions(t *testing.T) {
+	tests := []struct {
+		combine *api.Combine
+		want    float64
+	}{
+		{combine: &api.Combine{Function: "Sum"}, want: 31},
+		{combine: &api.Combine{Function: "Max"}, want: 10},
+		{combine: &api.Combine{Function: "Min"}, want: 1},
+		{combine: &api.Combine{Function: "Average"}, want: 7.75},
+		{combine: &api.Combine{Expression: "east + west * 2"}, want: 21},
+	}
+
+	for _, tt := range tests {
+		manager := &regionalCloudWatchManager{values: map[string]float64{"us-east-1": 1, "us-west-2": 10}}
+		samples, err := NewCloudWatchSource(manager).Query(context.Background(), newRegionalExternalMetric(tt.combine))
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		if len(samples) != 1 || samples[0].Value != tt.want || samples[0].Labels["id"] != combinedID {
+			t.Errorf("%s%s: samples = %+v, want a combined sample of %v", tt.combine.Function, tt.combine.Expression, samples, tt.want)
+		}
+		if len(manager.requests) != 3 {
+			t.Errorf("requests = %d, want a request per region and role", len(manager.requests))
+		}
+	}
+}
+
+func TestCloudWatchSourceFailsWhenARegionFails(t *testing.T) {
+	manager := &regionalCloudWatchManager{values: map[string]float64{"us-east-1": 1}}
+	if _, err := NewCloudWatchSource(manager).Query(context.Background(), newRegionalExternalMetric(&api.Combine{Function: "Sum"})); err == nil {
+		t.Errorf("Query() error = nil, want the error of us-west-2")
+	}
+}
+
+func TestCombineSamplesWithoutData(t *testing.T) {
+	samples := []source.Sample{{Value: 1, Labels: map[string]string{"id": "east"}}}
+	combined, err := combineSamples(&api.Combine{Expression: "east + west"}, samples)
+	if err != nil || len(combined) != 0 {
+		t.Errorf("combineSamples() = %v, %v, want no sample when a query has no data", combined, err)
+	}
+
+	combined, err = combineSamples(&api.Combine{Function: "Sum"}, nil)
+	if err != nil || len(combined) != 0 {
+		t.Errorf("combineSamples() = %v, %v, want no sample without data", combined, err)
+	}
+}
@@ -0,0 +1,205 @@
+package aws
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+)
+
+// MetricFilter selects the metrics to discover.
+type MetricFilter struct {
+	// Namespace of the metrics, required.
+	Namespace string
+	// MetricName of the metrics, all the metrics of the namespace match when empty.
+	MetricName string
+	// Dimensions the metrics must have, any value matches when the value of a dimension is empty.
+	Dimensions map[string]string
+}
+
+// MetricDefaults are the statistic, period and unit used to query a metric.
+type MetricDefaults struct {
+	Stat   string
+	Period int64
+	Unit   string
+}
+
+// genericDefaults are used for the metrics of unknown namespaces.
+var genericDefaults = MetricDefaults{Stat: "Average", Period: 60}
+
+// knownDefaults holds the defaults of the AWS namespaces commonly used for scaling, keyed by
+// namespace, and of their metrics, keyed by namespace and metric name. A unit is only set for
+// metrics, as querying a metric with another unit than it is published with returns no data.
+var knownDefaults = map[string]MetricDefaults{
+	"AWS/SQS": {Stat: "Average", Period: 60},
+	"AWS/SQS/ApproximateNumberOfMessagesVisible": {Stat: "Average", Period: 60, Unit: "Count"},
+	"AWS/SQS/NumberOfMessagesSent":               {Stat: "Sum", Period: 60, Unit: "Count"},
+	"AWS/SQS/NumberOfMessagesReceived":           {Stat: "Sum", Period: 60, Unit: "Count"},
+	"AWS/SQS/ApproximateAgeOfOldestMessage":      {Stat: "Maximum", Period: 60, Unit: "Seconds"},
+
+	"AWS/ApplicationELB":                    {Stat: "Sum", Period: 60},
+	"AWS/ApplicationELB/RequestCount":       {Stat: "Sum", Period: 60, Unit: "Count"},
+	"AWS/ApplicationELB/TargetResponseTime": {Stat: "Average", Period: 60, Unit: "Seconds"},
+	"AWS/ELB":                               {Stat: "Sum", Period: 60},
+	"AWS/ELB/RequestCount":                  {Stat: "Sum", Period: 60, Unit: "Count"},
+	"AWS/ELB/Latency":                       {Stat: "Average", Period: 60, Unit: "Seconds"},
+
+	"AWS/Kinesis":                                    {Stat: "Sum", Period: 60},
+	"AWS/Kinesis/IncomingRecords":                    {Stat: "Sum", Period: 60, Unit: "Count"},
+	"AWS/Kinesis/GetRecords.IteratorAgeMilliseconds": {Stat: "Maximum", Period: 60, Unit: "Milliseconds"},
+	"AWS/DynamoDB":                                   {Stat: "Sum", Period: 60},
+	"AWS/DynamoDB/ConsumedReadCapacityUnits":         {Stat: "Sum", Period: 60, Unit: "Count"},
+	"AWS/DynamoDB/ConsumedWriteCapacityUnits":        {Stat: "Sum", Period: 60, Unit: "Count"},
+
+	"AWS/Lambda":                      {Stat: "Sum", Period: 60},
+	"AWS/Lambda/Invocations":          {Stat: "Sum", Period: 60, Unit: "Count"},
+	"AWS/Lambda/ConcurrentExecutions": {Stat: "Maximum", Period: 60, Unit: "Count"},
+	"AWS/Lambda/Duration":             {Stat: "Average", Period: 60, Unit: "Milliseconds"},
+
+	// basic monitoring publishes EC2 metrics every 5 minutes
+	"AWS/EC2":                   {Stat: "Average", Period: 300},
+	"AWS/EC2/CPUUtilization":    {Stat: "Average", Period: 300, Unit: "Percent"},
+	"AWS/ECS/CPUUtilization":    {Stat: "Average", Period: 60, Unit: "Percent"},
+	"AWS/ECS/MemoryUtilization": {Stat: "Average", Period: 60, Unit: "Percent"},
+}
+
+// DefaultsForMetric returns the statistic, period and unit used to query a metric.
+func DefaultsForMetric(namespace, metricName string) MetricDefaults {
+	if d, ok := knownDefaults[namespace+"/"+metricName]; ok {
+		return d
+	}
+	if d, ok := knownDefaults[namespace]; ok {
+		return d
+	}
+	return genericDefaults
+}
+
+// DiscoverMetrics lists the metrics matching the filter, sorted by name and dimensions.
+func DiscoverMetrics(client cloudwatchiface.CloudWatchAPI, filter MetricFilter) ([]*cloudwatch.Metric, error) {
+	if filter.Namespace == "" {
+		return nil, errors.New("a namespace is required to discover metrics")
+	}
+
+	input := &cloudwatch.ListMetricsInput{
+		Namespace: aws.String(filter.Namespace),
+	}
+	if filter.MetricName != "" {
+		input.MetricName = aws.String(filter.MetricName)
+	}
+	for name, value := range filter.Dimensions {
+		dimension := &cloudwatch.DimensionFilter{Name: aws.String(name)}
+		if value != "" {
+			dimension.Value = aws.String(value)
+		}
+		input.Dimensions = append(input.Dimensions, dimension)
+	}
+
+	var metrics []*cloudwatch.Metric
+	err := client.ListMetricsPages(input, func(page *cloudwatch.ListMetricsOutput, lastPage bool) bool {
+		metrics = append(metrics, page.Metrics...)
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list metrics")
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metricKey(metrics[i]) < metricKey(metrics[j])
+	})
+	return metrics, nil
+}
+
+// NewExternalMetric returns an ExternalMetric querying a discovered metric with the defaults of
+// the metric. The object and the served metric are named after the metric and its dimension
+// values.
+func NewExternalMetric(metric *cloudwatch.Metric, namespace string) v1alpha1.ExternalMetric {
+	metricNamespace := aws.StringValue(metric.Namespace)
+	metricName := aws.StringValue(metric.MetricName)
+	defaults := DefaultsForMetric(metricNamespace, metricName)
+
+	dimensions := make([]v1alpha1.Dimension, len(metric.Dimensions))
+	for i, d := range metric.Dimensions {
+		dimensions[i] = v1alpha1.Dimension{
+			Name:  aws.StringValue(d.Name),
+			Value: aws.StringValue(d.Value),
+		}
+	}
+
+	name := metricObjectName(metric)
+	returnData := true
+	return v1alpha1.ExternalMetric{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "ExternalMetric",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: v1alpha1.MetricSeriesSpec{
+			Name: name,
+			Queries: []v1alpha1.MetricDataQuery{{
+				ID: strings.Replace(name, "-", "_", -1),
+				MetricStat: v1alpha1.MetricStat{
+					Metric: v1alpha1.Metric{
+						Dimensions: dimensions,
+						MetricName: metricName,
+						Namespace:  metricNamespace,
+					},
+					Period: defaults.Period,
+					Stat:   defaults.Stat,
+					Unit:   defaults.Unit,
+				},
+				ReturnData: &returnData,
+			}},
+		},
+	}
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// maxNameLength keeps generated names within the limit of a label value, as they are used in
+// HPA metric selectors and URLs.
+const maxNameLength = 63
+
+// metricObjectName builds a DNS-1123 name from the namespace, dimension values and name of a
+// metric, such as sqs-helloworld-approximatenumberofmessagesvisible.
+func metricObjectName(metric *cloudwatch.Metric) string {
+	parts := []string{strings.TrimPrefix(aws.StringValue(metric.Namespace), "AWS/")}
+	for _, d := range metric.Dimensions {
+		parts = append(parts, aws.StringValue(d.Value))
+	}
+	parts = append(parts, aws.StringValue(metric.MetricName))
+
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-")
+	name = strings.Trim(name, "-")
+	// names must start with a letter to be valid query ids
+	if name == "" || name[0] < 'a' {
+		name = "m-" + name
+	}
+	if len(name) > maxNameLength {
+		// a hash of the full name keeps the names of metrics differing past the limit apart
+		hash := fnv.New32a()
+		hash.Write([]byte(name))
+		suffix := fmt.Sprintf("-%08x", hash.Sum32())
+		name = strings.TrimRight(name[:maxNameLength-len(suffix)], "-") + suffix
+	}
+	return strings.TrimRight(name, "-")
+}
+
+func metricKey(metric *cloudwatch.Metric) string {
+	parts := []string{aws.StringValue(metric.MetricName)}
+	for _, d := range metric.Dimensions {
+		parts = append(parts, aws.StringValue(d.Name)+"="+aws.StringValue(d.Value))
+	}
+	return strings.Join(parts, ",")
+}
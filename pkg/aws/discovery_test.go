@@ -0,0 +1,148 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// fakeCloudWatch serves ListMetrics from a fixed set of pages.
+type fakeCloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+
+	pages []*cloudwatch.ListMetricsOutput
+	input *cloudwatch.ListMetricsInput
+}
+
+func (f *fakeCloudWatch) ListMetricsPages(input *cloudwatch.ListMetricsInput, fn func(*cloudwatch.ListMetricsOutput, bool) bool) error {
+	f.input = input
+	for i, page := range f.pages {
+		if !fn(page, i == len(f.pages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func newMetric(namespace, name string, dimensions ...string) *cloudwatch.Metric {
+	metric := &cloudwatch.Metric{
+		Namespace:  aws.String(namespace),
+		MetricName: aws.String(name),
+	}
+	for i := 0; i < len(dimensions); i += 2 {
+		metric.Dimensions = append(metric.Dimensions, &cloudwatch.Dimension{
+			Name:  aws.String(dimensions[i]),
+			Value: aws.String(dimensions[i+1]),
+		})
+	}
+	return metric
+}
+
+func TestDiscoverMetrics(t *testing.T) {
+	client := &fakeCloudWatch{
+		pages: []*cloudwatch.ListMetricsOutput{
+			{Metrics: []*cloudwatch.Metric{newMetric("AWS/SQS", "ApproximateNumberOfMessagesVisible", "QueueName", "orders")}},
+			{Metrics: []*cloudwatch.Metric{newMetric("AWS/SQS", "ApproximateNumberOfMessagesVisible", "QueueName", "emails")}},
+		},
+	}
+
+	metrics, err := DiscoverMetrics(client, MetricFilter{
+		Namespace:  "AWS/SQS",
+		MetricName: "ApproximateNumberOfMessagesVisible",
+		Dimensions: map[string]string{"QueueName": ""},
+	})
+	if err != nil {
+		t.Fatalf("DiscoverMetrics() error = %v", err)
+	}
+
+	if aws.StringValue(client.input.MetricName) != "ApproximateNumberOfMessagesVisible" {
+		t.Errorf("MetricName = %v, want %v", aws.StringValue(client.input.MetricName), "ApproximateNumberOfMessagesVisible")
+	}
+	if len(client.input.Dimensions) != 1 || client.input.Dimensions[0].Value != nil {
+		t.Errorf("Dimensions = %v, want a QueueName filter without value", client.input.Dimensions)
+	}
+
+	if len(metrics) != 2 {
+		t.Fatalf("len(metrics) = %v, want %v", len(metrics), 2)
+	}
+	if v := aws.StringValue(metrics[0].Dimensions[0].Value); v != "emails" {
+		t.Errorf("metrics[0] queue = %v, want %v", v, "emails")
+	}
+}
+
+func TestDiscoverMetricsRequiresNamespace(t *testing.T) {
+	if _, err := DiscoverMetrics(&fakeCloudWatch{}, MetricFilter{}); err == nil {
+		t.Errorf("DiscoverMetrics() error = nil, want an error")
+	}
+}
+
+func TestNewExternalMetric(t *testing.T) {
+	tests := []struct {
+		metric *cloudwatch.Metric
+		name   string
+		stat   string
+		period int64
+		unit   string
+	}{
+		{
+			metric: newMetric("AWS/SQS", "ApproximateNumberOfMessagesVisible", "QueueName", "hello_world"),
+			name:   "sqs-hello-world-approximatenumberofmessagesvisible",
+			stat:   "Average",
+			period: 60,
+			unit:   "Count",
+		},
+		{
+			metric: newMetric("AWS/ApplicationELB", "RequestCountPerTarget", "TargetGroup", "targetgroup/web/0123"),
+			name:   "applicationelb-targetgroup-web-0123-requestcountpertarget",
+			stat:   "Sum",
+			period: 60,
+		},
+		{
+			metric: newMetric("Custom/1App", "Jobs"),
+			name:   "custom-1app-jobs",
+			stat:   "Average",
+			period: 60,
+		},
+		{
+			metric: newMetric("1Custom", "Jobs"),
+			name:   "m-1custom-jobs",
+			stat:   "Average",
+			period: 60,
+		},
+		{
+			metric: newMetric("AWS/ApplicationELB", "RequestCountPerTarget", "TargetGroup", "targetgroup/web-frontend-production/0123456789abcdef"),
+			name:   "applicationelb-targetgroup-web-frontend-production-012-7367cb53",
+			stat:   "Sum",
+			period: 60,
+		},
+		{
+			metric: newMetric("AWS/ApplicationELB", "RequestCountPerTarget", "TargetGroup", "targetgroup/web-frontend-production/fedcba9876543210"),
+			name:   "applicationelb-targetgroup-web-frontend-production-fed-1feb5c23",
+			stat:   "Sum",
+			period: 60,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			em := NewExternalMetric(tt.metric, "default")
+			stat := em.Spec.Queries[0].MetricStat
+
+			if em.Name != tt.name || em.Spec.Name != tt.name {
+				t.Errorf("name = %v, want %v", em.Name, tt.name)
+			}
+			if len(em.Name) > maxNameLength {
+				t.Errorf("name %v is longer than %d characters", em.Name, maxNameLength)
+			}
+			if stat.Stat != tt.stat || stat.Period != tt.period || stat.Unit != tt.unit {
+				t.Errorf("stat, period, unit = %v, %v, %v, want %v, %v, %v", stat.Stat, stat.Period, stat.Unit, tt.stat, tt.period, tt.unit)
+			}
+			if errs := ValidateMetricSeriesSpec(em.Spec, field.NewPath("spec")); len(errs) > 0 {
+				t.Errorf("ValidateMetricSeriesSpec() = %v, want no errors", errs)
+			}
+		})
+	}
+}
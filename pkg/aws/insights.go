@@ -0,0 +1,73 @@
+package aws
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// defaultSQLPeriod is the period of the results of a Metrics Insights query which does not set
+// one.
+const defaultSQLPeriod = 60
+
+// maxSQLLimit is the largest number of series a Metrics Insights query may return.
+const maxSQLLimit = 500
+
+var (
+	sqlSelectRegexp  = regexp.MustCompile(`(?is)^\s*SELECT\s+.+\s+FROM\s+\S`)
+	sqlGroupByRegexp = regexp.MustCompile(`(?is)\bGROUP\s+BY\s+(.+?)(?:\s+ORDER\s+BY\b.*|\s+LIMIT\b.*)?$`)
+	sqlLimitRegexp   = regexp.MustCompile(`(?is)\bLIMIT\s+(\d+)\s*$`)
+)
+
+// sqlPeriod returns the period of the results of a Metrics Insights query.
+func sqlPeriod(q v1alpha1.MetricDataQuery) int64 {
+	if q.Period > 0 {
+		return q.Period
+	}
+	return defaultSQLPeriod
+}
+
+// sqlGroupByKeys returns the GROUP BY keys of a Metrics Insights query, in order, without quotes.
+func sqlGroupByKeys(sql string) []string {
+	m := sqlGroupByRegexp.FindStringSubmatch(strings.TrimSpace(sql))
+	if m == nil {
+		return nil
+	}
+
+	keys := strings.Split(m[1], ",")
+	for i, key := range keys {
+		keys[i] = strings.Trim(strings.TrimSpace(key), `"`)
+	}
+	return keys
+}
+
+// addGroupByLabels labels the samples of the Metrics Insights queries with GROUP BY with the
+// values of their keys. CloudWatch labels each series with the values of its keys separated by
+// spaces, a value containing spaces is only supported for the last key.
+func addGroupByLabels(samples []source.Sample, queries []v1alpha1.MetricDataQuery) {
+	keysByID := make(map[string][]string)
+	for _, q := range queries {
+		if q.SQL == "" || q.Label != "" {
+			continue
+		}
+		if keys := sqlGroupByKeys(q.SQL); len(keys) > 0 {
+			keysByID[q.ID] = keys
+		}
+	}
+
+	for _, sample := range samples {
+		keys, found := keysByID[sample.Labels["id"]]
+		if !found {
+			continue
+		}
+
+		values := strings.SplitN(sample.Labels["label"], " ", len(keys))
+		for i, key := range keys {
+			if i < len(values) {
+				sample.Labels[key] = values[i]
+			}
+		}
+	}
+}
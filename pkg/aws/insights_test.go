@@ -0,0 +1,66 @@
+package aws
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+func TestSQLGroupByKeys(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []string
+	}{
+		{sql: `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId)`},
+		{sql: `SELECT AVG(CPUUtilization) FROM "AWS/EC2" GROUP BY InstanceId`, want: []string{"InstanceId"}},
+		{
+			sql:  `SELECT SUM(RequestCount) FROM SCHEMA("AWS/ApplicationELB", LoadBalancer, AvailabilityZone) group by LoadBalancer, "AvailabilityZone" order by SUM() desc limit 5`,
+			want: []string{"LoadBalancer", "AvailabilityZone"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := sqlGroupByKeys(tt.sql); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sqlGroupByKeys(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestAddGroupByLabels(t *testing.T) {
+	queries := []v1alpha1.MetricDataQuery{
+		{ID: "requests", SQL: `SELECT SUM(RequestCount) FROM SCHEMA("AWS/ApplicationELB", LoadBalancer, AvailabilityZone) GROUP BY LoadBalancer, AvailabilityZone`},
+		{ID: "cpu", Expression: "AVG(METRICS())"},
+	}
+	samples := []source.Sample{
+		{Value: 10, Labels: map[string]string{"id": "requests", "label": "app/web/123 us-west-2a"}},
+		{Value: 20, Labels: map[string]string{"id": "cpu", "label": "cpu us-west-2a"}},
+	}
+
+	addGroupByLabels(samples, queries)
+
+	want := map[string]string{"id": "requests", "label": "app/web/123 us-west-2a", "LoadBalancer": "app/web/123", "AvailabilityZone": "us-west-2a"}
+	if !reflect.DeepEqual(samples[0].Labels, want) {
+		t.Errorf("labels = %v, want %v", samples[0].Labels, want)
+	}
+	if len(samples[1].Labels) != 2 {
+		t.Errorf("labels of an expression = %v, want only id and label", samples[1].Labels)
+	}
+}
+
+func TestToCloudWatchQuerySQL(t *testing.T) {
+	externalMetric := newFullExternalMetric("test")
+	externalMetric.Spec.Queries = []v1alpha1.MetricDataQuery{
+		{ID: "cpu", SQL: `SELECT AVG(CPUUtilization) FROM "AWS/EC2" GROUP BY InstanceId`},
+		{ID: "latency", SQL: `SELECT MAX(Latency) FROM "AWS/ELB"`, Label: "latency", Period: 300},
+	}
+
+	queries := toCloudWatchQuery(externalMetric).MetricDataQueries
+	if *queries[0].Expression != externalMetric.Spec.Queries[0].SQL || *queries[0].Period != defaultSQLPeriod || queries[0].Label != nil {
+		t.Errorf("query = %v, want the SQL as expression with the default period and no label", queries[0])
+	}
+	if *queries[1].Period != 300 || *queries[1].Label != "latency" || queries[1].MetricStat != nil {
+		t.Errorf("query = %v, want the period and label of the query", queries[1])
+	}
+}
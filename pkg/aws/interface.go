@@ -1,12 +1,17 @@
 package aws
 
 import (
+	"context"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
 )
 
 // CloudWatchManager manages clients for Amazon CloudWatch.
 type CloudWatchManager interface {
 	// Query sends a CloudWatch GetMetricDataInput to CloudWatch API for metric results.
-	QueryCloudWatch(request v1alpha1.ExternalMetric) ([]*cloudwatch.MetricDataResult, error)
+	QueryCloudWatch(ctx context.Context, request v1alpha1.ExternalMetric) ([]*cloudwatch.MetricDataResult, error)
+
+	// Configure applies a new adapter configuration to the following queries.
+	Configure(cfg *config.AdapterConfig)
 }
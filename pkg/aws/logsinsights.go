@@ -0,0 +1,290 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+const (
+	// logsInsightsPollInterval is how often the status of a running query is checked.
+	logsInsightsPollInterval = time.Second
+	// logsInsightsTimeout bounds how long a query may run before it is stopped.
+	logsInsightsTimeout = 30 * time.Second
+	// logsInsightsStopTimeout bounds the request stopping a query which did not complete.
+	logsInsightsStopTimeout = 5 * time.Second
+	// logsInsightsCacheInterval is how long the results of a query are reused. Each run of a query
+	// is billed, the results are reused until the end of the interval they were queried in.
+	logsInsightsCacheInterval = time.Minute
+	// logsInsightsPointerField is the field Logs Insights adds to reference the log event of a
+	// row, it is not kept as a label.
+	logsInsightsPointerField = "@ptr"
+)
+
+// logsInsightsSource is the MetricsSource running the CloudWatch Logs Insights query of a metric
+// series and serving the value of a field of each result row.
+type logsInsightsSource struct {
+	settings
+
+	// newClient returns the client of a query, replaced in tests
+	newClient    func(cfg *config.AdapterConfig, role, region *string) cloudwatchlogsiface.CloudWatchLogsAPI
+	pollInterval time.Duration
+	timeout      time.Duration
+	now          func() time.Time
+
+	// results caches the result rows of each query until the end of the cache interval
+	resultsLock sync.Mutex
+	results     map[string]logsInsightsResult
+}
+
+// logsInsightsResult holds the result rows of a query run at the end of its window.
+type logsInsightsResult struct {
+	rows    [][]*cloudwatchlogs.ResultField
+	end     time.Time
+	expires time.Time
+}
+
+// NewLogsInsightsSource returns a MetricsSource running CloudWatch Logs Insights queries, using the
+// AWS settings of the configuration and the shared rate limiter.
+func NewLogsInsightsSource(cfg *config.AdapterConfig, rateLimiter *RateLimiter) source.MetricsSource {
+	s := &logsInsightsSource{
+		settings:     settings{rateLimiter: rateLimiter},
+		newClient:    newLogsClient,
+		pollInterval: logsInsightsPollInterval,
+		timeout:      logsInsightsTimeout,
+		now:          time.Now,
+		results:      map[string]logsInsightsResult{},
+	}
+	s.Configure(cfg)
+	return s
+}
+
+// newLogsClient returns a CloudWatch Logs client with the credentials and region the CloudWatch
+// client of a query would use.
+func newLogsClient(cfg *config.AdapterConfig, role, region *string) cloudwatchlogsiface.CloudWatchLogsAPI {
+	sess, awsCfg := newSession(cfg, role, region)
+	return cloudwatchlogs.New(sess, awsCfg)
+}
+
+func (s *logsInsightsSource) Name() string {
+	return "logsinsights"
+}
+
+func (s *logsInsightsSource) Handles(spec v1alpha1.MetricSeriesSpec) bool {
+	return spec.LogsInsights != nil
+}
+
+func (s *logsInsightsSource) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	query := spec.LogsInsights
+	queryPath := fldPath.Child("logsInsights")
+	if len(query.LogGroupNames) == 0 {
+		allErrs = append(allErrs, field.Required(queryPath.Child("logGroupNames"), "at least one log group is required"))
+	}
+	for i, name := range query.LogGroupNames {
+		if name == "" {
+			allErrs = append(allErrs, field.Required(queryPath.Child("logGroupNames").Index(i), ""))
+		}
+	}
+	if query.QueryString == "" {
+		allErrs = append(allErrs, field.Required(queryPath.Child("queryString"), ""))
+	}
+	if query.Field == "" {
+		allErrs = append(allErrs, field.Required(queryPath.Child("field"), "the field holding the value is required"))
+	}
+	if query.Window != nil && query.Window.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(queryPath.Child("window"), query.Window.Duration.String(), "must be greater than zero"))
+	}
+
+	return allErrs
+}
+
+// Query starts the query of the request, waits for it to complete and returns a sample for each
+// result row with the value of the field of the query. The results of a query are reused by the
+// requests with the same query and window until the end of the cache interval.
+func (s *logsInsightsSource) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]source.Sample, error) {
+	cfg, rateLimiter := s.getConfig()
+	query := request.Spec.LogsInsights
+	if query == nil {
+		return nil, errors.New("no Logs Insights query specified")
+	}
+
+	window := cfg.ExternalMetricDefaults.QueryWindow.Duration
+	if query.Window != nil {
+		window = query.Window.Duration
+	}
+	end := s.now()
+
+	region := s.getRegion(cfg, request.Spec.Region)
+	log := logging.ForMetric(request.Namespace, request.Name).WithValues("role", request.Spec.RoleARN, "region", region)
+	key := logsInsightsKey(request.Spec.RoleARN, region, query, window)
+	if result, ok := s.cachedResult(key, end); ok {
+		log.V(5).Info("Reusing Logs Insights results", "queried", result.end, "rows", len(result.rows))
+		return logsInsightsSamples(result.rows, query.Field, result.end)
+	}
+
+	if err := waitForRateLimit(ctx, rateLimiter); err != nil {
+		return nil, err
+	}
+
+	client := s.newClient(cfg, request.Spec.RoleARN, region)
+	started, err := client.StartQueryWithContext(ctx, &cloudwatchlogs.StartQueryInput{
+		LogGroupNames: aws.StringSlice(query.LogGroupNames),
+		QueryString:   aws.String(query.QueryString),
+		StartTime:     aws.Int64(end.Add(-window).Unix()),
+		EndTime:       aws.Int64(end.Unix()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	queryID := aws.StringValue(started.QueryId)
+	rows, err := s.waitForResults(ctx, client, rateLimiter, queryID)
+	if err != nil {
+		return nil, err
+	}
+	log.V(4).Info("Queried Logs Insights", "queryID", queryID, "duration", s.now().Sub(end), "rows", len(rows))
+	s.cacheResult(key, logsInsightsResult{
+		rows:    rows,
+		end:     end,
+		expires: end.Truncate(logsInsightsCacheInterval).Add(logsInsightsCacheInterval),
+	})
+
+	return logsInsightsSamples(rows, query.Field, end)
+}
+
+// logsInsightsKey returns the key of the results of a query, run with the role in the region over
+// the window ending when it is run.
+func logsInsightsKey(role, region *string, query *v1alpha1.LogsInsightsQuery, window time.Duration) string {
+	return strings.Join([]string{
+		aws.StringValue(role),
+		aws.StringValue(region),
+		window.String(),
+		strings.Join(query.LogGroupNames, ","),
+		query.QueryString,
+	}, "|")
+}
+
+// cachedResult returns the results of a query which have not expired yet.
+func (s *logsInsightsSource) cachedResult(key string, now time.Time) (logsInsightsResult, bool) {
+	s.resultsLock.Lock()
+	defer s.resultsLock.Unlock()
+
+	result, ok := s.results[key]
+	if !ok || !now.Before(result.expires) {
+		return logsInsightsResult{}, false
+	}
+	return result, true
+}
+
+// cacheResult stores the results of a query, dropping the results which expired.
+func (s *logsInsightsSource) cacheResult(key string, result logsInsightsResult) {
+	s.resultsLock.Lock()
+	defer s.resultsLock.Unlock()
+
+	for k, cached := range s.results {
+		if !result.end.Before(cached.expires) {
+			delete(s.results, k)
+		}
+	}
+	s.results[key] = result
+}
+
+// waitForResults polls the results of a query until it completes, each poll waiting for the rate
+// limit. A query which does not complete in time or whose context is done is stopped.
+func (s *logsInsightsSource) waitForResults(ctx context.Context, client cloudwatchlogsiface.CloudWatchLogsAPI, rateLimiter flowcontrol.RateLimiter, queryID string) ([][]*cloudwatchlogs.ResultField, error) {
+	pollCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	poll := time.NewTicker(s.pollInterval)
+	defer poll.Stop()
+	for {
+		if err := waitForRateLimit(pollCtx, rateLimiter); err != nil {
+			return nil, s.stopQuery(ctx, client, queryID)
+		}
+
+		results, err := client.GetQueryResultsWithContext(pollCtx, &cloudwatchlogs.GetQueryResultsInput{QueryId: aws.String(queryID)})
+		if err != nil {
+			if pollCtx.Err() != nil {
+				return nil, s.stopQuery(ctx, client, queryID)
+			}
+			return nil, err
+		}
+
+		switch status := aws.StringValue(results.Status); status {
+		case cloudwatchlogs.QueryStatusComplete:
+			return results.Results, nil
+		case cloudwatchlogs.QueryStatusScheduled, cloudwatchlogs.QueryStatusRunning:
+		default:
+			return nil, fmt.Errorf("query %s ended with status %s", queryID, status)
+		}
+
+		select {
+		case <-poll.C:
+		case <-pollCtx.Done():
+			return nil, s.stopQuery(ctx, client, queryID)
+		}
+	}
+}
+
+// stopQuery stops a query which did not complete in time or was cancelled and returns the reason
+// it was stopped. The query is stopped even if the context of the request is done, as it would
+// keep running in Logs Insights otherwise.
+func (s *logsInsightsSource) stopQuery(ctx context.Context, client cloudwatchlogsiface.CloudWatchLogsAPI, queryID string) error {
+	stopCtx, cancel := context.WithTimeout(context.Background(), logsInsightsStopTimeout)
+	defer cancel()
+	if _, err := client.StopQueryWithContext(stopCtx, &cloudwatchlogs.StopQueryInput{QueryId: aws.String(queryID)}); err != nil {
+		logging.Warning("Unable to stop Logs Insights query", "queryID", queryID, "err", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return errors.Wrapf(err, "query %s was cancelled", queryID)
+	}
+	return fmt.Errorf("query %s did not complete within %v", queryID, s.timeout)
+}
+
+// logsInsightsSamples converts the result rows of a query into samples holding the value of the
+// field, labelled with the other fields of the row. Rows without the field are skipped.
+func logsInsightsSamples(rows [][]*cloudwatchlogs.ResultField, valueField string, timestamp time.Time) ([]source.Sample, error) {
+	samples := make([]source.Sample, 0, len(rows))
+	for _, row := range rows {
+		sample := source.Sample{Timestamp: timestamp, Labels: map[string]string{}}
+		found := false
+		for _, f := range row {
+			name := aws.StringValue(f.Field)
+			switch name {
+			case valueField:
+				value, err := strconv.ParseFloat(aws.StringValue(f.Value), 64)
+				if err != nil {
+					return nil, errors.Wrapf(err, "field %s is not a number", valueField)
+				}
+				sample.Value = value
+				found = true
+			case logsInsightsPointerField:
+			default:
+				sample.Labels[name] = aws.StringValue(f.Value)
+			}
+		}
+
+		if found {
+			samples = append(samples, sample)
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,232 @@
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+)
+
+// fakeLogs answers a query with the given statuses, the results being returned with the last one.
+type fakeLogs struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+
+	statuses []string
+	results  [][]*cloudwatchlogs.ResultField
+	started  *cloudwatchlogs.StartQueryInput
+	starts   int
+	polls    int
+	stopped  bool
+}
+
+func (f *fakeLogs) StartQueryWithContext(ctx aws.Context, input *cloudwatchlogs.StartQueryInput, opts ...request.Option) (*cloudwatchlogs.StartQueryOutput, error) {
+	f.started = input
+	f.starts++
+	return &cloudwatchlogs.StartQueryOutput{QueryId: aws.String("q-1")}, nil
+}
+
+func (f *fakeLogs) GetQueryResultsWithContext(ctx aws.Context, input *cloudwatchlogs.GetQueryResultsInput, opts ...request.Option) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	status := f.statuses[f.polls]
+	if f.polls < len(f.statuses)-1 {
+		f.polls++
+	}
+
+	output := &cloudwatchlogs.GetQueryResultsOutput{Status: aws.String(status)}
+	if status == cloudwatchlogs.QueryStatusComplete {
+		output.Results = f.results
+	}
+	return output, nil
+}
+
+func (f *fakeLogs) StopQueryWithContext(ctx aws.Context, input *cloudwatchlogs.StopQueryInput, opts ...request.Option) (*cloudwatchlogs.StopQueryOutput, error) {
+	f.stopped = true
+	return &cloudwatchlogs.StopQueryOutput{}, nil
+}
+
+func resultRow(fields ...string) []*cloudwatchlogs.ResultField {
+	row := make([]*cloudwatchlogs.ResultField, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		row = append(row, &cloudwatchlogs.ResultField{Field: aws.String(fields[i]), Value: aws.String(fields[i+1])})
+	}
+	return row
+}
+
+func newLogsInsightsSource(client *fakeLogs) *logsInsightsSource {
+	region := "us-west-2"
+	cfg := config.NewDefaultConfig()
+	cfg.AWS.Region = region
+
+	s := &logsInsightsSource{
+		settings: settings{rateLimiter: NewRateLimiter(cfg)},
+		newClient: func(cfg *config.AdapterConfig, role, region *string) cloudwatchlogsiface.CloudWatchLogsAPI {
+			return client
+		},
+		pollInterval: time.Millisecond,
+		timeout:      50 * time.Millisecond,
+		now:          time.Now,
+		results:      map[string]logsInsightsResult{},
+	}
+	s.Configure(cfg)
+	return s
+}
+
+func newLogsInsightsRequest() v1alpha1.ExternalMetric {
+	return v1alpha1.ExternalMetric{
+		Spec: v1alpha1.MetricSeriesSpec{
+			LogsInsights: &v1alpha1.LogsInsightsQuery{
+				LogGroupNames: []string{"/app/worker"},
+				QueryString:   "filter @message like /job enqueued/ | stats count(*) as enqueued by queue",
+				Field:         "enqueued",
+				Window:        &metav1.Duration{Duration: 10 * time.Minute},
+			},
+		},
+	}
+}
+
+func TestLogsInsightsSourceWaitsForResults(t *testing.T) {
+	client := &fakeLogs{
+		statuses: []string{cloudwatchlogs.QueryStatusScheduled, cloudwatchlogs.QueryStatusRunning, cloudwatchlogs.QueryStatusComplete},
+		results: [][]*cloudwatchlogs.ResultField{
+			resultRow("queue", "emails", "enqueued", "12", "@ptr", "abc"),
+			resultRow("queue", "reports"),
+		},
+	}
+
+	samples, err := newLogsInsightsSource(client).Query(context.Background(), newLogsInsightsRequest())
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	if window := aws.Int64Value(client.started.EndTime) - aws.Int64Value(client.started.StartTime); window != 600 {
+		t.Errorf("queried window = %ds, want 600s", window)
+	}
+	if client.polls != 2 {
+		t.Errorf("polls = %d, want 2", client.polls)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("len(samples) = %d, want 1", len(samples))
+	}
+	if samples[0].Value != 12 || len(samples[0].Labels) != 1 || samples[0].Labels["queue"] != "emails" {
+		t.Errorf("sample = %+v, want value 12 with label queue=emails", samples[0])
+	}
+}
+
+func TestLogsInsightsSourceReusesResults(t *testing.T) {
+	client := &fakeLogs{
+		statuses: []string{cloudwatchlogs.QueryStatusComplete},
+		results:  [][]*cloudwatchlogs.ResultField{resultRow("queue", "emails", "enqueued", "12")},
+	}
+	s := newLogsInsightsSource(client)
+	queried := time.Date(2020, 1, 1, 10, 0, 10, 0, time.UTC)
+	now := queried
+	s.now = func() time.Time { return now }
+
+	otherWindow := newLogsInsightsRequest()
+	otherWindow.Spec.LogsInsights.Window = &metav1.Duration{Duration: 5 * time.Minute}
+
+	steps := []struct {
+		name       string
+		now        time.Time
+		request    v1alpha1.ExternalMetric
+		wantStarts int
+	}{
+		{name: "first query", now: queried, request: newLogsInsightsRequest(), wantStarts: 1},
+		{name: "same query within the interval", now: queried.Add(49 * time.Second), request: newLogsInsightsRequest(), wantStarts: 1},
+		{name: "other window", now: queried.Add(49 * time.Second), request: otherWindow, wantStarts: 2},
+		{name: "next interval", now: queried.Add(50 * time.Second), request: newLogsInsightsRequest(), wantStarts: 3},
+	}
+	for _, step := range steps {
+		now = step.now
+		samples, err := s.Query(context.Background(), step.request)
+		if err != nil {
+			t.Fatalf("%s: Query() error = %v", step.name, err)
+		}
+		if client.starts != step.wantStarts {
+			t.Errorf("%s: started queries = %d, want %d", step.name, client.starts, step.wantStarts)
+		}
+		if len(samples) != 1 || samples[0].Value != 12 {
+			t.Errorf("%s: samples = %+v, want a single value 12", step.name, samples)
+		}
+	}
+}
+
+func TestLogsInsightsSourceFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      *fakeLogs
+		wantStopped bool
+	}{
+		{
+			name:   "failed query",
+			client: &fakeLogs{statuses: []string{cloudwatchlogs.QueryStatusFailed}},
+		},
+		{
+			name:        "timeout",
+			client:      &fakeLogs{statuses: []string{cloudwatchlogs.QueryStatusRunning}},
+			wantStopped: true,
+		},
+		{
+			name: "value not a number",
+			client: &fakeLogs{
+				statuses: []string{cloudwatchlogs.QueryStatusComplete},
+				results:  [][]*cloudwatchlogs.ResultField{resultRow("enqueued", "many")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newLogsInsightsSource(tt.client).Query(context.Background(), newLogsInsightsRequest()); err == nil {
+				t.Errorf("Query() error = nil, want an error")
+			}
+			if tt.client.stopped != tt.wantStopped {
+				t.Errorf("stopped = %v, want %v", tt.client.stopped, tt.wantStopped)
+			}
+		})
+	}
+}
+
+func TestLogsInsightsSourceValidate(t *testing.T) {
+	s := newLogsInsightsSource(&fakeLogs{})
+
+	valid := newLogsInsightsRequest().Spec
+	if errs := s.Validate(valid, field.NewPath("spec")); len(errs) != 0 {
+		t.Errorf("Validate() = %v, want no errors", errs)
+	}
+
+	invalid := v1alpha1.MetricSeriesSpec{
+		LogsInsights: &v1alpha1.LogsInsightsQuery{Window: &metav1.Duration{}},
+	}
+	if errs := s.Validate(invalid, field.NewPath("spec")); len(errs) != 4 {
+		t.Errorf("Validate() = %v, want 4 errors", errs)
+	}
+}
+
+func TestLogsInsightsSourceStopsCancelledQuery(t *testing.T) {
+	client := &fakeLogs{statuses: []string{cloudwatchlogs.QueryStatusRunning}}
+	s := newLogsInsightsSource(client)
+	s.timeout = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := s.Query(ctx, newLogsInsightsRequest()); err == nil {
+		t.Errorf("Query() error = nil, want an error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Query() returned after %v, want it to return once the context is done", elapsed)
+	}
+	if !client.stopped {
+		t.Errorf("stopped = false, want the cancelled query to be stopped")
+	}
+}
@@ -0,0 +1,243 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// promQLSigningName is the service name requests to Amazon Managed Service for Prometheus are
+// signed for.
+const promQLSigningName = "aps"
+
+// promQLTimeout bounds a query, so a workspace which does not answer does not block the HPA.
+const promQLTimeout = 30 * time.Second
+
+// workspaceHostRegexp extracts the region from the host of an Amazon Managed Service for
+// Prometheus workspace URL.
+var workspaceHostRegexp = regexp.MustCompile(`^aps-workspaces\.([a-z0-9-]+)\.amazonaws\.com$`)
+
+// promQLSource is the MetricsSource sending the PromQL query of a metric series to a Prometheus
+// compatible HTTP API, signing requests with the credentials of the role of the series.
+type promQLSource struct {
+	settings
+	client *http.Client
+}
+
+// NewPromQLSource returns a MetricsSource querying Amazon Managed Service for Prometheus
+// workspaces, using the AWS settings of the configuration and the shared rate limiter.
+func NewPromQLSource(cfg *config.AdapterConfig, rateLimiter *RateLimiter) source.MetricsSource {
+	s := &promQLSource{
+		settings: settings{rateLimiter: rateLimiter},
+		client:   &http.Client{Timeout: promQLTimeout},
+	}
+	s.Configure(cfg)
+	return s
+}
+
+func (s *promQLSource) Name() string {
+	return "promql"
+}
+
+func (s *promQLSource) Handles(spec v1alpha1.MetricSeriesSpec) bool {
+	return spec.PromQL != nil
+}
+
+func (s *promQLSource) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	promQLPath := fldPath.Child("promql")
+	workspaceURL := spec.PromQL.WorkspaceURL
+	if workspaceURL == "" {
+		allErrs = append(allErrs, field.Required(promQLPath.Child("workspaceUrl"), ""))
+	} else if u, err := url.Parse(workspaceURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		allErrs = append(allErrs, field.Invalid(promQLPath.Child("workspaceUrl"), workspaceURL, "must be an absolute http or https URL"))
+	}
+	if strings.TrimSpace(spec.PromQL.Query) == "" {
+		allErrs = append(allErrs, field.Required(promQLPath.Child("query"), ""))
+	}
+
+	return allErrs
+}
+
+// Query sends the instant query of the request and returns a sample for each series of the
+// resulting vector, labelled with the labels of the series.
+func (s *promQLSource) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]source.Sample, error) {
+	cfg, rateLimiter := s.getConfig()
+	query := request.Spec.PromQL
+	if query == nil {
+		return nil, errors.New("no PromQL query specified")
+	}
+
+	queryURL := strings.TrimRight(query.WorkspaceURL, "/") + "/api/v1/query"
+	body := url.Values{"query": {query.Query}}.Encode()
+	req, err := http.NewRequest(http.MethodPost, queryURL, strings.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create query request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// sign the request the way the CloudWatch client would, with the role and region of the query
+	sess, awsCfg := newSession(cfg, request.Spec.RoleARN, s.region(cfg, request.Spec.Region, req.URL))
+	creds := awsCfg.Credentials
+	if creds == nil {
+		creds = sess.Config.Credentials
+	}
+	signer := v4.NewSigner(creds)
+	if _, err := signer.Sign(req, strings.NewReader(body), promQLSigningName, aws.StringValue(awsCfg.Region), time.Now()); err != nil {
+		return nil, errors.Wrap(err, "unable to sign query request")
+	}
+
+	if err := waitForRateLimit(ctx, rateLimiter); err != nil {
+		return nil, err
+	}
+
+	// the bodies are logged with the debug option of the AWS clients or at a verbosity of 6
+	log := logging.ForMetric(request.Namespace, request.Name).WithValues("role", request.Spec.RoleARN, "region", awsCfg.Region)
+	logBodies := cfg.AWS.Debug || log.V(6).Enabled()
+	if logBodies {
+		log.Info("Sending PromQL query", "url", queryURL, "query", query.Query)
+	}
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to send query")
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read query response")
+	}
+	log.V(4).Info("Queried Prometheus", "status", resp.Status, "duration", time.Since(start))
+	if logBodies {
+		log.Info("Received PromQL query response", "status", resp.Status, "body", string(data))
+	}
+
+	return parsePromQLResponse(resp.StatusCode, data)
+}
+
+// region returns the region requests are signed for, the region of an Amazon Managed Service for
+// Prometheus workspace URL is used when the query does not set one.
+func (s *promQLSource) region(cfg *config.AdapterConfig, region *string, workspaceURL *url.URL) *string {
+	if region == nil {
+		if m := workspaceHostRegexp.FindStringSubmatch(workspaceURL.Hostname()); m != nil {
+			region = aws.String(m[1])
+		}
+	}
+	return s.getRegion(cfg, region)
+}
+
+// promQLResponse is the envelope of the responses of the Prometheus HTTP API.
+type promQLResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// promQLSeries is a series of an instant vector result.
+type promQLSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+// parsePromQLResponse converts the result of an instant query into samples. Vectors result in a
+// sample per series in the order of the response and scalars in a single sample without labels.
+// NaN values are dropped like CloudWatch results without data points.
+func parsePromQLResponse(statusCode int, data []byte) ([]source.Sample, error) {
+	var resp promQLResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("query failed with status %d: %s", statusCode, bytes.TrimSpace(data))
+		}
+		return nil, errors.Wrap(err, "unable to decode query response")
+	}
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("query failed: %s: %s", resp.ErrorType, resp.Error)
+	}
+
+	var samples []source.Sample
+	switch resp.Data.ResultType {
+	case "vector":
+		var series []promQLSeries
+		if err := json.Unmarshal(resp.Data.Result, &series); err != nil {
+			return nil, errors.Wrap(err, "unable to decode vector result")
+		}
+		for _, s := range series {
+			sample, err := parsePromQLValue(s.Value)
+			if err != nil {
+				return nil, err
+			}
+			if math.IsNaN(sample.Value) {
+				continue
+			}
+			sample.Labels = s.Metric
+			samples = append(samples, sample)
+		}
+	case "scalar":
+		var value []interface{}
+		if err := json.Unmarshal(resp.Data.Result, &value); err != nil {
+			return nil, errors.Wrap(err, "unable to decode scalar result")
+		}
+		sample, err := parsePromQLValue(value)
+		if err != nil {
+			return nil, err
+		}
+		if !math.IsNaN(sample.Value) {
+			samples = append(samples, sample)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported result type %q, the query must return an instant vector or a scalar", resp.Data.ResultType)
+	}
+
+	return samples, nil
+}
+
+// parsePromQLValue parses a [timestamp, "value"] pair, the timestamp being in seconds.
+func parsePromQLValue(pair []interface{}) (source.Sample, error) {
+	if len(pair) != 2 {
+		return source.Sample{}, fmt.Errorf("invalid sample %v", pair)
+	}
+	timestamp, ok := pair[0].(float64)
+	if !ok {
+		return source.Sample{}, fmt.Errorf("invalid sample timestamp %v", pair[0])
+	}
+	text, ok := pair[1].(string)
+	if !ok {
+		return source.Sample{}, fmt.Errorf("invalid sample value %v", pair[1])
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return source.Sample{}, errors.Wrap(err, "invalid sample value")
+	}
+
+	seconds, fraction := math.Modf(timestamp)
+	return source.Sample{
+		Value:     value,
+		Timestamp: time.Unix(int64(seconds), int64(fraction*float64(time.Second))),
+	}, nil
+}
@@ -0,0 +1,168 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// setEnv sets environment variables for the duration of a test.
+func setEnv(t *testing.T, env map[string]string) {
+	for name, value := range env {
+		previous, found := os.LookupEnv(name)
+		os.Setenv(name, value)
+		t.Cleanup(func() {
+			if found {
+				os.Setenv(name, previous)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+}
+
+func newPromQLSource() source.MetricsSource {
+	cfg := config.NewDefaultConfig()
+	return NewPromQLSource(cfg, NewRateLimiter(cfg))
+}
+
+func newPromQLRequest(workspaceURL, query string) v1alpha1.ExternalMetric {
+	region := "eu-west-1"
+	return v1alpha1.ExternalMetric{
+		Spec: v1alpha1.MetricSeriesSpec{
+			Region: &region,
+			PromQL: &v1alpha1.PromQLQuery{WorkspaceURL: workspaceURL, Query: query},
+		},
+	}
+}
+
+func TestPromQLSourceQueriesStub(t *testing.T) {
+	setEnv(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKIDEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	})
+
+	var authorization, query string
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/workspaces/ws-1/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		query = r.FormValue("query")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"queue":"jobs"},"value":[1600000000.5,"42"]},
+			{"metric":{"queue":"idle"},"value":[1600000000.5,"NaN"]}]}}`))
+	}))
+	defer stub.Close()
+
+	s := newPromQLSource()
+	samples, err := s.Query(context.Background(), newPromQLRequest(stub.URL+"/workspaces/ws-1/", "sum(queue_depth) by (queue)"))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	if query != "sum(queue_depth) by (queue)" {
+		t.Errorf("query = %q, want %q", query, "sum(queue_depth) by (queue)")
+	}
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+		!strings.Contains(authorization, "/eu-west-1/aps/aws4_request") {
+		t.Errorf("Authorization = %q, want a SigV4 signature for aps in eu-west-1", authorization)
+	}
+
+	if len(samples) != 1 {
+		t.Fatalf("len(samples) = %d, want 1", len(samples))
+	}
+	if samples[0].Value != 42 || samples[0].Labels["queue"] != "jobs" {
+		t.Errorf("sample = %+v, want value 42 with label queue=jobs", samples[0])
+	}
+	if samples[0].Timestamp.UnixNano() != 1600000000500000000 {
+		t.Errorf("timestamp = %v, want 1600000000.5", samples[0].Timestamp)
+	}
+}
+
+func TestPromQLSourceReportsQueryErrors(t *testing.T) {
+	setEnv(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKIDEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	})
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+	}))
+	defer stub.Close()
+
+	_, err := newPromQLSource().Query(context.Background(), newPromQLRequest(stub.URL, "sum("))
+	if err == nil || err.Error() != "query failed: bad_data: parse error" {
+		t.Errorf("Query() error = %v, want %v", err, "query failed: bad_data: parse error")
+	}
+}
+
+func TestParsePromQLResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantSamples int
+		wantErr     bool
+	}{
+		{name: "scalar", data: `{"status":"success","data":{"resultType":"scalar","result":[1600000000,"3"]}}`, wantSamples: 1},
+		{name: "empty vector", data: `{"status":"success","data":{"resultType":"vector","result":[]}}`},
+		{name: "matrix", data: `{"status":"success","data":{"resultType":"matrix","result":[]}}`, wantErr: true},
+		{name: "invalid value", data: `{"status":"success","data":{"resultType":"scalar","result":[1600000000,"x"]}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := parsePromQLResponse(http.StatusOK, []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePromQLResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(samples) != tt.wantSamples {
+				t.Errorf("len(samples) = %d, want %d", len(samples), tt.wantSamples)
+			}
+		})
+	}
+}
+
+func TestPromQLSourceValidate(t *testing.T) {
+	s := newPromQLSource()
+	tests := []struct {
+		name     string
+		query    v1alpha1.PromQLQuery
+		wantErrs int
+	}{
+		{name: "valid", query: v1alpha1.PromQLQuery{WorkspaceURL: "https://aps-workspaces.us-west-2.amazonaws.com/workspaces/ws-1", Query: "up"}},
+		{name: "missing fields", query: v1alpha1.PromQLQuery{}, wantErrs: 2},
+		{name: "relative url", query: v1alpha1.PromQLQuery{WorkspaceURL: "workspaces/ws-1", Query: "up"}, wantErrs: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := v1alpha1.MetricSeriesSpec{PromQL: &tt.query}
+			if errs := s.Validate(spec, field.NewPath("spec")); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestPromQLRegionFromWorkspaceURL(t *testing.T) {
+	s := &promQLSource{}
+	workspaceURL, _ := url.Parse("https://aps-workspaces.ap-southeast-2.amazonaws.com/workspaces/ws-1")
+
+	if got := s.region(config.NewDefaultConfig(), nil, workspaceURL); *got != "ap-southeast-2" {
+		t.Errorf("region() = %v, want %v", *got, "ap-southeast-2")
+	}
+}
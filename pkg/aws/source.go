@@ -0,0 +1,102 @@
+package aws
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// cloudWatchSource is the MetricsSource querying CloudWatch GetMetricData with the queries of a
+// metric series.
+type cloudWatchSource struct {
+	manager CloudWatchManager
+}
+
+// NewCloudWatchSource returns a MetricsSource querying CloudWatch through the manager.
+func NewCloudWatchSource(manager CloudWatchManager) source.MetricsSource {
+	return &cloudWatchSource{manager: manager}
+}
+
+func (s *cloudWatchSource) Name() string {
+	return "cloudwatch"
+}
+
+func (s *cloudWatchSource) Handles(spec v1alpha1.MetricSeriesSpec) bool {
+	return len(spec.Queries) > 0
+}
+
+func (s *cloudWatchSource) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	return ValidateMetricSeriesSpec(spec, fldPath)
+}
+
+// Query sends the queries of the request, concurrently when they are sent to several regions or
+// with several roles, and combines their values when the series sets Combine.
+func (s *cloudWatchSource) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]source.Sample, error) {
+	requests := SplitRequest(request)
+	results := make([][]*cloudwatch.MetricDataResult, len(requests))
+	errs := make([]error, len(requests))
+
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = s.manager.QueryCloudWatch(ctx, requests[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var allResults []*cloudwatch.MetricDataResult
+	for i, err := range errs {
+		if err != nil {
+			if len(requests) > 1 {
+				err = errors.Wrapf(err, "queries to %s", aws.StringValue(requests[i].Spec.Region))
+			}
+			return nil, err
+		}
+		allResults = append(allResults, results[i]...)
+	}
+
+	samples := ToSamples(allResults)
+	addGroupByLabels(samples, request.Spec.Queries)
+	if request.Spec.Combine != nil {
+		return combineSamples(request.Spec.Combine, samples)
+	}
+	return samples, nil
+}
+
+func (s *cloudWatchSource) Configure(cfg *config.AdapterConfig) {
+	s.manager.Configure(cfg)
+}
+
+// ToSamples returns the latest value of each result with data points, labelled with the id and
+// label of its query. The results are sorted with the latest data point first.
+func ToSamples(results []*cloudwatch.MetricDataResult) []source.Sample {
+	samples := make([]source.Sample, 0, len(results))
+	for _, r := range results {
+		if len(r.Values) == 0 {
+			continue
+		}
+
+		sample := source.Sample{
+			Value: aws.Float64Value(r.Values[0]),
+			Labels: map[string]string{
+				"id":    aws.StringValue(r.Id),
+				"label": aws.StringValue(r.Label),
+			},
+		}
+		if len(r.Timestamps) > 0 {
+			sample.Timestamp = aws.TimeValue(r.Timestamps[0])
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
@@ -0,0 +1,36 @@
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+func TestToSamples(t *testing.T) {
+	now := time.Now()
+	samples := ToSamples([]*cloudwatch.MetricDataResult{
+		{
+			Id:     aws.String("empty"),
+			Label:  aws.String("empty"),
+			Values: []*float64{},
+		},
+		{
+			Id:         aws.String("queue"),
+			Label:      aws.String("messages"),
+			Timestamps: []*time.Time{aws.Time(now), aws.Time(now.Add(-time.Minute))},
+			Values:     []*float64{aws.Float64(12), aws.Float64(8)},
+		},
+	})
+
+	if len(samples) != 1 {
+		t.Fatalf("len(samples) = %v, want %v", len(samples), 1)
+	}
+	if samples[0].Value != 12 || !samples[0].Timestamp.Equal(now) {
+		t.Errorf("sample = %v at %v, want %v at %v", samples[0].Value, samples[0].Timestamp, 12, now)
+	}
+	if samples[0].Labels["id"] != "queue" || samples[0].Labels["label"] != "messages" {
+		t.Errorf("labels = %v, want id queue and label messages", samples[0].Labels)
+	}
+}
@@ -0,0 +1,282 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/transform"
+)
+
+// ageOfOldestMessage is not a queue attribute, it is only published to CloudWatch.
+const ageOfOldestMessage = "ApproximateAgeOfOldestMessage"
+
+// sqsAttributes maps the CloudWatch metric names used in SQSQuery to the queue attributes.
+var sqsAttributes = map[string]string{
+	"ApproximateNumberOfMessagesVisible":    sqs.QueueAttributeNameApproximateNumberOfMessages,
+	"ApproximateNumberOfMessagesNotVisible": sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+	"ApproximateNumberOfMessagesDelayed":    sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+}
+
+// defaultSQSAttribute is used when a query does not set attributes.
+const defaultSQSAttribute = "ApproximateNumberOfMessagesVisible"
+
+// queueHostRegexp extracts the region from the host of a queue URL.
+var queueHostRegexp = regexp.MustCompile(`^sqs\.([a-z0-9-]+)\.amazonaws\.com$`)
+
+// sqsSource is the MetricsSource reading the attributes of an SQS queue with GetQueueAttributes,
+// which reflects the queue within seconds instead of the minutes CloudWatch takes.
+type sqsSource struct {
+	settings
+
+	// newClient returns the client of a query, replaced in tests
+	newClient func(cfg *config.AdapterConfig, role, region *string) sqsiface.SQSAPI
+	// cloudwatch retrieves the metrics of the queue which are not attributes
+	cloudwatch CloudWatchManager
+
+	// queueURLs caches the URLs of the queues queried by name
+	queueURLsLock sync.Mutex
+	queueURLs     map[string]string
+}
+
+// NewSQSSource returns a MetricsSource reading SQS queue attributes, using the AWS settings of the
+// configuration and the shared rate limiter. The age of the oldest message is queried from
+// CloudWatch through the manager.
+func NewSQSSource(cfg *config.AdapterConfig, manager CloudWatchManager, rateLimiter *RateLimiter) source.MetricsSource {
+	s := &sqsSource{
+		settings:   settings{rateLimiter: rateLimiter},
+		newClient:  newSQSClient,
+		cloudwatch: manager,
+		queueURLs:  map[string]string{},
+	}
+	s.Configure(cfg)
+	return s
+}
+
+// newSQSClient returns an SQS client with the credentials and region the CloudWatch client of a
+// query would use.
+func newSQSClient(cfg *config.AdapterConfig, role, region *string) sqsiface.SQSAPI {
+	sess, awsCfg := newSession(cfg, role, region)
+	return sqs.New(sess, awsCfg)
+}
+
+func (s *sqsSource) Name() string {
+	return "sqs"
+}
+
+func (s *sqsSource) Handles(spec v1alpha1.MetricSeriesSpec) bool {
+	return spec.SQS != nil
+}
+
+func (s *sqsSource) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	query := spec.SQS
+	queryPath := fldPath.Child("sqs")
+	switch {
+	case query.QueueURL != "" && query.QueueName != "":
+		allErrs = append(allErrs, field.Forbidden(queryPath, "only one of queueUrl or queueName may be specified"))
+	case query.QueueURL == "" && query.QueueName == "":
+		allErrs = append(allErrs, field.Required(queryPath, "one of queueUrl or queueName must be specified"))
+	case query.QueueURL != "":
+		if u, err := url.Parse(query.QueueURL); err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			allErrs = append(allErrs, field.Invalid(queryPath.Child("queueUrl"), query.QueueURL, "must be the absolute URL of a queue"))
+		}
+	}
+
+	attributesPath := queryPath.Child("attributes")
+	for i, attribute := range query.Attributes {
+		_, found := sqsAttributes[attribute]
+		switch {
+		case attribute == ageOfOldestMessage:
+			if len(query.Attributes) > 1 {
+				allErrs = append(allErrs, field.Forbidden(attributesPath.Index(i), "may not be combined with other attributes"))
+			}
+		case !found:
+			allErrs = append(allErrs, field.NotSupported(attributesPath.Index(i), attribute, supportedSQSAttributes()))
+		}
+	}
+
+	if query.Divisor != nil && query.Divisor.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(queryPath.Child("divisor"), query.Divisor.String(), "must be greater than zero"))
+	}
+
+	return allErrs
+}
+
+// Query returns the sum of the attributes of the queue, divided by the divisor of the query, as a
+// sample labelled with the queue name.
+func (s *sqsSource) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]source.Sample, error) {
+	cfg, rateLimiter := s.getConfig()
+	query := request.Spec.SQS
+	if query == nil {
+		return nil, errors.New("no SQS query specified")
+	}
+
+	attributes := query.Attributes
+	if len(attributes) == 0 {
+		attributes = []string{defaultSQSAttribute}
+	}
+
+	var value float64
+	var timestamp time.Time
+	queueName := s.queueName(query)
+	if attributes[0] == ageOfOldestMessage {
+		samples, err := s.cloudwatch.QueryCloudWatch(ctx, ageOfOldestMessageRequest(request, queueName))
+		if err != nil {
+			return nil, err
+		}
+		cwSamples := ToSamples(samples)
+		if len(cwSamples) == 0 {
+			return nil, nil
+		}
+		value, timestamp = cwSamples[0].Value, cwSamples[0].Timestamp
+	} else {
+		if err := waitForRateLimit(ctx, rateLimiter); err != nil {
+			return nil, err
+		}
+
+		region := sqsRegion(request.Spec)
+		client := s.newClient(cfg, request.Spec.RoleARN, s.getRegion(cfg, region))
+
+		queueURL, err := s.queueURL(ctx, client, request.Spec.RoleARN, region, query)
+		if err != nil {
+			return nil, err
+		}
+
+		names := make([]string, len(attributes))
+		for i, attribute := range attributes {
+			names[i] = sqsAttributes[attribute]
+		}
+		output, err := client.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queueURL),
+			AttributeNames: aws.StringSlice(names),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			v, err := strconv.ParseFloat(aws.StringValue(output.Attributes[name]), 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid value of queue attribute %s", name)
+			}
+			value += v
+		}
+		timestamp = time.Now()
+	}
+
+	if query.Divisor != nil {
+		value /= transform.Float64(*query.Divisor)
+	}
+
+	return []source.Sample{{
+		Value:     value,
+		Timestamp: timestamp,
+		Labels:    map[string]string{"queue": queueName},
+	}}, nil
+}
+
+// queueURL returns the URL of the queue of a query, looking up and caching the URL of a queue
+// queried by name.
+func (s *sqsSource) queueURL(ctx context.Context, client sqsiface.SQSAPI, role, region *string, query *v1alpha1.SQSQuery) (string, error) {
+	if query.QueueURL != "" {
+		return query.QueueURL, nil
+	}
+
+	key := fmt.Sprintf("%s/%s/%s", aws.StringValue(role), aws.StringValue(region), query.QueueName)
+	s.queueURLsLock.Lock()
+	defer s.queueURLsLock.Unlock()
+
+	if queueURL, found := s.queueURLs[key]; found {
+		return queueURL, nil
+	}
+
+	output, err := client.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(query.QueueName)})
+	if err != nil {
+		return "", err
+	}
+	s.queueURLs[key] = aws.StringValue(output.QueueUrl)
+	return s.queueURLs[key], nil
+}
+
+// queueName returns the name of the queue of a query, which is the last element of a queue URL.
+func (s *sqsSource) queueName(query *v1alpha1.SQSQuery) string {
+	if query.QueueName != "" {
+		return query.QueueName
+	}
+	if u, err := url.Parse(query.QueueURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return query.QueueURL
+}
+
+// sqsRegion returns the region of a query, the region of the queue URL is used when the query
+// does not set one.
+func sqsRegion(spec v1alpha1.MetricSeriesSpec) *string {
+	if spec.Region != nil || spec.SQS.QueueURL == "" {
+		return spec.Region
+	}
+
+	u, err := url.Parse(spec.SQS.QueueURL)
+	if err != nil {
+		return nil
+	}
+	if m := queueHostRegexp.FindStringSubmatch(u.Hostname()); m != nil {
+		return aws.String(m[1])
+	}
+	return nil
+}
+
+// ageOfOldestMessageRequest returns the request of the maximum age of the oldest message of a
+// queue published to CloudWatch, with the role and region of the SQS request.
+func ageOfOldestMessageRequest(request v1alpha1.ExternalMetric, queueName string) v1alpha1.ExternalMetric {
+	defaults := DefaultsForMetric("AWS/SQS", ageOfOldestMessage)
+	returnData := true
+	cwRequest := *request.DeepCopy()
+	cwRequest.Spec = v1alpha1.MetricSeriesSpec{
+		Name:    request.Spec.Name,
+		RoleARN: request.Spec.RoleARN,
+		Region:  sqsRegion(request.Spec),
+		Queries: []v1alpha1.MetricDataQuery{{
+			ID: "age",
+			MetricStat: v1alpha1.MetricStat{
+				Metric: v1alpha1.Metric{
+					Namespace:  "AWS/SQS",
+					MetricName: ageOfOldestMessage,
+					Dimensions: []v1alpha1.Dimension{{Name: "QueueName", Value: queueName}},
+				},
+				Period: defaults.Period,
+				Stat:   defaults.Stat,
+				Unit:   defaults.Unit,
+			},
+			ReturnData: &returnData,
+		}},
+	}
+	return cwRequest
+}
+
+func supportedSQSAttributes() []string {
+	supported := []string{ageOfOldestMessage}
+	for attribute := range sqsAttributes {
+		supported = append(supported, attribute)
+	}
+	sort.Strings(supported)
+	return supported
+}
@@ -0,0 +1,173 @@
+package aws
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+)
+
+// fakeSQS returns the attributes of a single queue.
+type fakeSQS struct {
+	sqsiface.SQSAPI
+
+	attributes map[string]string
+	urlLookups int
+	requested  *sqs.GetQueueAttributesInput
+}
+
+func (f *fakeSQS) GetQueueUrlWithContext(ctx aws.Context, input *sqs.GetQueueUrlInput, opts ...request.Option) (*sqs.GetQueueUrlOutput, error) {
+	f.urlLookups++
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.us-west-2.amazonaws.com/123456789012/" + aws.StringValue(input.QueueName))}, nil
+}
+
+func (f *fakeSQS) GetQueueAttributesWithContext(ctx aws.Context, input *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+	f.requested = input
+	return &sqs.GetQueueAttributesOutput{Attributes: aws.StringMap(f.attributes)}, nil
+}
+
+// fakeCloudWatchManager records the requests and returns the given results.
+type fakeCloudWatchManager struct {
+	results []*cloudwatch.MetricDataResult
+	request v1alpha1.ExternalMetric
+}
+
+func (f *fakeCloudWatchManager) QueryCloudWatch(ctx context.Context, request v1alpha1.ExternalMetric) ([]*cloudwatch.MetricDataResult, error) {
+	f.request = request
+	return f.results, nil
+}
+
+func (f *fakeCloudWatchManager) Configure(cfg *config.AdapterConfig) {}
+
+func newSQSSource(client *fakeSQS, manager CloudWatchManager) *sqsSource {
+	cfg := config.NewDefaultConfig()
+	cfg.AWS.Region = "us-west-2"
+
+	s := NewSQSSource(cfg, manager, NewRateLimiter(cfg)).(*sqsSource)
+	s.newClient = func(cfg *config.AdapterConfig, role, region *string) sqsiface.SQSAPI {
+		return client
+	}
+	return s
+}
+
+func newSQSRequest(query v1alpha1.SQSQuery) v1alpha1.ExternalMetric {
+	return v1alpha1.ExternalMetric{Spec: v1alpha1.MetricSeriesSpec{SQS: &query}}
+}
+
+func TestSQSSourceSumsAttributes(t *testing.T) {
+	client := &fakeSQS{attributes: map[string]string{
+		sqs.QueueAttributeNameApproximateNumberOfMessages:           "30",
+		sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: "10",
+	}}
+	s := newSQSSource(client, nil)
+
+	divisor := resource.MustParse("4")
+	request := newSQSRequest(v1alpha1.SQSQuery{
+		QueueName:  "helloworld",
+		Attributes: []string{"ApproximateNumberOfMessagesVisible", "ApproximateNumberOfMessagesNotVisible"},
+		Divisor:    &divisor,
+	})
+
+	for i := 0; i < 2; i++ {
+		samples, err := s.Query(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		if len(samples) != 1 || samples[0].Value != 10 || samples[0].Labels["queue"] != "helloworld" {
+			t.Errorf("samples = %+v, want a sample of 10 for queue helloworld", samples)
+		}
+	}
+
+	if client.urlLookups != 1 {
+		t.Errorf("queue URL lookups = %d, want 1", client.urlLookups)
+	}
+	if got := aws.StringValue(client.requested.QueueUrl); got != "https://sqs.us-west-2.amazonaws.com/123456789012/helloworld" {
+		t.Errorf("queue URL = %v, want the URL of helloworld", got)
+	}
+}
+
+func TestSQSSourceDividesBySubMilliDivisor(t *testing.T) {
+	client := &fakeSQS{attributes: map[string]string{
+		sqs.QueueAttributeNameApproximateNumberOfMessages: "40",
+	}}
+	s := newSQSSource(client, nil)
+
+	divisor := resource.MustParse("0.0004")
+	samples, err := s.Query(context.Background(), newSQSRequest(v1alpha1.SQSQuery{QueueName: "helloworld", Divisor: &divisor}))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(samples) != 1 || math.Abs(samples[0].Value-100000) > 1e-6 {
+		t.Errorf("samples = %+v, want a sample of 100000", samples)
+	}
+}
+
+func TestSQSSourceQueriesAgeOfOldestMessageFromCloudWatch(t *testing.T) {
+	now := time.Now()
+	manager := &fakeCloudWatchManager{results: []*cloudwatch.MetricDataResult{{
+		Id:         aws.String("age"),
+		Timestamps: []*time.Time{aws.Time(now)},
+		Values:     []*float64{aws.Float64(90)},
+	}}}
+	s := newSQSSource(&fakeSQS{}, manager)
+
+	samples, err := s.Query(context.Background(), newSQSRequest(v1alpha1.SQSQuery{
+		QueueURL:   "https://sqs.eu-west-1.amazonaws.com/123456789012/jobs",
+		Attributes: []string{"ApproximateAgeOfOldestMessage"},
+	}))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(samples) != 1 || samples[0].Value != 90 || samples[0].Labels["queue"] != "jobs" {
+		t.Errorf("samples = %+v, want a sample of 90 for queue jobs", samples)
+	}
+
+	spec := manager.request.Spec
+	if aws.StringValue(spec.Region) != "eu-west-1" {
+		t.Errorf("region = %v, want eu-west-1", aws.StringValue(spec.Region))
+	}
+	if d := spec.Queries[0].MetricStat.Metric.Dimensions; len(d) != 1 || d[0].Value != "jobs" {
+		t.Errorf("dimensions = %v, want QueueName jobs", d)
+	}
+	if errs := ValidateMetricSeriesSpec(spec, field.NewPath("spec")); len(errs) > 0 {
+		t.Errorf("CloudWatch request is invalid: %v", errs)
+	}
+}
+
+func TestSQSSourceValidate(t *testing.T) {
+	zero := resource.MustParse("0")
+	tests := []struct {
+		name     string
+		query    v1alpha1.SQSQuery
+		wantErrs int
+	}{
+		{name: "queue name", query: v1alpha1.SQSQuery{QueueName: "helloworld"}},
+		{name: "queue url", query: v1alpha1.SQSQuery{QueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/helloworld"}},
+		{name: "no queue", query: v1alpha1.SQSQuery{}, wantErrs: 1},
+		{name: "both", query: v1alpha1.SQSQuery{QueueName: "a", QueueURL: "https://sqs.us-west-2.amazonaws.com/1/a"}, wantErrs: 1},
+		{name: "url without queue", query: v1alpha1.SQSQuery{QueueURL: "https://sqs.us-west-2.amazonaws.com/"}, wantErrs: 1},
+		{name: "unknown attribute", query: v1alpha1.SQSQuery{QueueName: "a", Attributes: []string{"Messages"}}, wantErrs: 1},
+		{name: "combined age", query: v1alpha1.SQSQuery{QueueName: "a", Attributes: []string{"ApproximateAgeOfOldestMessage", "ApproximateNumberOfMessagesVisible"}}, wantErrs: 1},
+		{name: "zero divisor", query: v1alpha1.SQSQuery{QueueName: "a", Divisor: &zero}, wantErrs: 1},
+	}
+
+	s := newSQSSource(&fakeSQS{}, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := s.Validate(newSQSRequest(tt.query).Spec, field.NewPath("spec")); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// The values a StreamQuery retrieves.
+const (
+	openShardCount          = "OpenShardCount"
+	iteratorAgeMilliseconds = "IteratorAgeMilliseconds"
+	laggingShardCount       = "LaggingShardCount"
+)
+
+// maxShardQueries is the number of queries a GetMetricData request accepts, which bounds the
+// shards LaggingShardCount can be computed for.
+const maxShardQueries = 500
+
+// streamSource is the MetricsSource describing Kinesis data streams and DynamoDB streams, combined
+// with the iterator age of Kinesis data streams published to CloudWatch.
+type streamSource struct {
+	settings
+
+	// newKinesisClient and newDynamoDBStreamsClient return the clients of a query, replaced in tests
+	newKinesisClient         func(cfg *config.AdapterConfig, role, region *string) kinesisiface.KinesisAPI
+	newDynamoDBStreamsClient func(cfg *config.AdapterConfig, role, region *string) dynamodbstreamsiface.DynamoDBStreamsAPI
+	// cloudwatch retrieves the iterator age of streams
+	cloudwatch CloudWatchManager
+}
+
+// NewStreamSource returns a MetricsSource describing streams, using the AWS settings of the
+// configuration and the shared rate limiter. Iterator ages are queried from CloudWatch through the
+// manager.
+func NewStreamSource(cfg *config.AdapterConfig, manager CloudWatchManager, rateLimiter *RateLimiter) source.MetricsSource {
+	s := &streamSource{
+		settings: settings{rateLimiter: rateLimiter},
+		newKinesisClient: func(cfg *config.AdapterConfig, role, region *string) kinesisiface.KinesisAPI {
+			sess, awsCfg := newSession(cfg, role, region)
+			return kinesis.New(sess, awsCfg)
+		},
+		newDynamoDBStreamsClient: func(cfg *config.AdapterConfig, role, region *string) dynamodbstreamsiface.DynamoDBStreamsAPI {
+			sess, awsCfg := newSession(cfg, role, region)
+			return dynamodbstreams.New(sess, awsCfg)
+		},
+		cloudwatch: manager,
+	}
+	s.Configure(cfg)
+	return s
+}
+
+func (s *streamSource) Name() string {
+	return "stream"
+}
+
+func (s *streamSource) Handles(spec v1alpha1.MetricSeriesSpec) bool {
+	return spec.Stream != nil
+}
+
+func (s *streamSource) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	query := spec.Stream
+	queryPath := fldPath.Child("stream")
+	switch {
+	case query.KinesisStreamName != "" && query.DynamoDBStreamARN != "":
+		allErrs = append(allErrs, field.Forbidden(queryPath, "only one of kinesisStreamName or dynamoDBStreamArn may be specified"))
+	case query.KinesisStreamName == "" && query.DynamoDBStreamARN == "":
+		allErrs = append(allErrs, field.Required(queryPath, "one of kinesisStreamName or dynamoDBStreamArn must be specified"))
+	case query.DynamoDBStreamARN != "":
+		if a, err := arn.Parse(query.DynamoDBStreamARN); err != nil || a.Service != "dynamodb" {
+			allErrs = append(allErrs, field.Invalid(queryPath.Child("dynamoDBStreamArn"), query.DynamoDBStreamARN, "must be the ARN of a DynamoDB stream"))
+		}
+	}
+
+	valuePath := queryPath.Child("value")
+	switch streamValue(query) {
+	case openShardCount:
+	case iteratorAgeMilliseconds, laggingShardCount:
+		if query.DynamoDBStreamARN != "" {
+			allErrs = append(allErrs, field.Forbidden(valuePath, "DynamoDB streams do not publish an iterator age, only OpenShardCount is supported"))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(valuePath, query.Value, []string{openShardCount, iteratorAgeMilliseconds, laggingShardCount}))
+	}
+
+	thresholdPath := queryPath.Child("iteratorAgeThreshold")
+	switch {
+	case streamValue(query) == laggingShardCount && query.IteratorAgeThreshold == nil:
+		allErrs = append(allErrs, field.Required(thresholdPath, "required for LaggingShardCount"))
+	case query.IteratorAgeThreshold != nil && query.IteratorAgeThreshold.Duration <= 0:
+		allErrs = append(allErrs, field.Invalid(thresholdPath, query.IteratorAgeThreshold.Duration.String(), "must be greater than zero"))
+	}
+
+	return allErrs
+}
+
+// Query returns the value of the query as a sample labelled with the stream.
+func (s *streamSource) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]source.Sample, error) {
+	cfg, rateLimiter := s.getConfig()
+	query := request.Spec.Stream
+	if query == nil {
+		return nil, errors.New("no stream query specified")
+	}
+
+	if err := waitForRateLimit(ctx, rateLimiter); err != nil {
+		return nil, err
+	}
+
+	if query.DynamoDBStreamARN != "" {
+		region := request.Spec.Region
+		if a, err := arn.Parse(query.DynamoDBStreamARN); err == nil && region == nil {
+			region = aws.String(a.Region)
+		}
+		client := s.newDynamoDBStreamsClient(cfg, request.Spec.RoleARN, s.getRegion(cfg, region))
+		shards, err := openDynamoDBStreamShards(ctx, client, query.DynamoDBStreamARN)
+		if err != nil {
+			return nil, err
+		}
+		return streamSamples(float64(len(shards)), time.Now(), query.DynamoDBStreamARN), nil
+	}
+
+	streamName := query.KinesisStreamName
+	switch streamValue(query) {
+	case iteratorAgeMilliseconds:
+		results, err := s.cloudwatch.QueryCloudWatch(ctx, kinesisIteratorAgeRequest(request, streamName, nil))
+		if err != nil {
+			return nil, err
+		}
+		samples := ToSamples(results)
+		if len(samples) == 0 {
+			return nil, nil
+		}
+		return streamSamples(samples[0].Value, samples[0].Timestamp, streamName), nil
+
+	case laggingShardCount:
+		client := s.newKinesisClient(cfg, request.Spec.RoleARN, s.getRegion(cfg, request.Spec.Region))
+		shards, err := openKinesisShards(ctx, client, streamName)
+		if err != nil {
+			return nil, err
+		}
+		if len(shards) > maxShardQueries {
+			return nil, fmt.Errorf("stream %s has %d open shards, LaggingShardCount supports up to %d", streamName, len(shards), maxShardQueries)
+		}
+
+		lagging := 0
+		if len(shards) > 0 {
+			results, err := s.cloudwatch.QueryCloudWatch(ctx, kinesisIteratorAgeRequest(request, streamName, shards))
+			if err != nil {
+				return nil, err
+			}
+			threshold := float64(query.IteratorAgeThreshold.Duration / time.Millisecond)
+			for _, sample := range ToSamples(results) {
+				if sample.Value > threshold {
+					lagging++
+				}
+			}
+		}
+		return streamSamples(float64(lagging), time.Now(), streamName), nil
+
+	default:
+		client := s.newKinesisClient(cfg, request.Spec.RoleARN, s.getRegion(cfg, request.Spec.Region))
+		summary, err := client.DescribeStreamSummaryWithContext(ctx, &kinesis.DescribeStreamSummaryInput{StreamName: aws.String(streamName)})
+		if err != nil {
+			return nil, err
+		}
+		openShards := aws.Int64Value(summary.StreamDescriptionSummary.OpenShardCount)
+		return streamSamples(float64(openShards), time.Now(), streamName), nil
+	}
+}
+
+// streamValue returns the value of a query, OpenShardCount when not set.
+func streamValue(query *v1alpha1.StreamQuery) string {
+	if query.Value == "" {
+		return openShardCount
+	}
+	return query.Value
+}
+
+// streamSamples returns the value of a query as a sample labelled with the stream.
+func streamSamples(value float64, timestamp time.Time, stream string) []source.Sample {
+	return []source.Sample{{
+		Value:     value,
+		Timestamp: timestamp,
+		Labels:    map[string]string{"stream": stream},
+	}}
+}
+
+// openKinesisShards lists the IDs of the open shards of a Kinesis data stream, which have no
+// ending sequence number.
+func openKinesisShards(ctx context.Context, client kinesisiface.KinesisAPI, streamName string) ([]string, error) {
+	var shards []string
+	input := &kinesis.ListShardsInput{StreamName: aws.String(streamName)}
+	for {
+		output, err := client.ListShardsWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, shard := range output.Shards {
+			if shard.SequenceNumberRange == nil || shard.SequenceNumberRange.EndingSequenceNumber == nil {
+				shards = append(shards, aws.StringValue(shard.ShardId))
+			}
+		}
+
+		if output.NextToken == nil {
+			return shards, nil
+		}
+		// the stream name may not be set with a token
+		input = &kinesis.ListShardsInput{NextToken: output.NextToken}
+	}
+}
+
+// openDynamoDBStreamShards lists the IDs of the open shards of a DynamoDB stream.
+func openDynamoDBStreamShards(ctx context.Context, client dynamodbstreamsiface.DynamoDBStreamsAPI, streamARN string) ([]string, error) {
+	var shards []string
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(streamARN)}
+	for {
+		output, err := client.DescribeStreamWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, shard := range output.StreamDescription.Shards {
+			if shard.SequenceNumberRange == nil || shard.SequenceNumberRange.EndingSequenceNumber == nil {
+				shards = append(shards, aws.StringValue(shard.ShardId))
+			}
+		}
+
+		if output.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		input.ExclusiveStartShardId = output.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// kinesisIteratorAgeRequest returns the request of the maximum iterator age of a Kinesis data
+// stream published to CloudWatch, or of each of the shards when given, which requires enhanced
+// shard-level monitoring.
+func kinesisIteratorAgeRequest(request v1alpha1.ExternalMetric, streamName string, shards []string) v1alpha1.ExternalMetric {
+	returnData := true
+	stream := v1alpha1.Dimension{Name: "StreamName", Value: streamName}
+
+	var queries []v1alpha1.MetricDataQuery
+	if len(shards) == 0 {
+		defaults := DefaultsForMetric("AWS/Kinesis", "GetRecords.IteratorAgeMilliseconds")
+		queries = append(queries, v1alpha1.MetricDataQuery{
+			ID: "iterator_age",
+			MetricStat: v1alpha1.MetricStat{
+				Metric: v1alpha1.Metric{
+					Namespace:  "AWS/Kinesis",
+					MetricName: "GetRecords.IteratorAgeMilliseconds",
+					Dimensions: []v1alpha1.Dimension{stream},
+				},
+				Period: defaults.Period,
+				Stat:   defaults.Stat,
+				Unit:   defaults.Unit,
+			},
+			ReturnData: &returnData,
+		})
+	}
+	for i, shard := range shards {
+		queries = append(queries, v1alpha1.MetricDataQuery{
+			ID:    fmt.Sprintf("shard_%d", i),
+			Label: shard,
+			MetricStat: v1alpha1.MetricStat{
+				Metric: v1alpha1.Metric{
+					Namespace:  "AWS/Kinesis",
+					MetricName: "IteratorAgeMilliseconds",
+					Dimensions: []v1alpha1.Dimension{stream, {Name: "ShardId", Value: shard}},
+				},
+				Period: 60,
+				Stat:   "Maximum",
+				Unit:   "Milliseconds",
+			},
+			ReturnData: &returnData,
+		})
+	}
+
+	cwRequest := *request.DeepCopy()
+	cwRequest.Spec = v1alpha1.MetricSeriesSpec{
+		Name:    request.Spec.Name,
+		RoleARN: request.Spec.RoleARN,
+		Region:  request.Spec.Region,
+		Queries: queries,
+	}
+	return cwRequest
+}
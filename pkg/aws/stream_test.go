@@ -0,0 +1,209 @@
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+)
+
+// fakeKinesis returns the shards of a stream in pages of one shard.
+type fakeKinesis struct {
+	kinesisiface.KinesisAPI
+
+	openShards int64
+	shards     []*kinesis.Shard
+}
+
+func (f *fakeKinesis) DescribeStreamSummaryWithContext(ctx aws.Context, input *kinesis.DescribeStreamSummaryInput, opts ...request.Option) (*kinesis.DescribeStreamSummaryOutput, error) {
+	return &kinesis.DescribeStreamSummaryOutput{
+		StreamDescriptionSummary: &kinesis.StreamDescriptionSummary{OpenShardCount: aws.Int64(f.openShards)},
+	}, nil
+}
+
+func (f *fakeKinesis) ListShardsWithContext(ctx aws.Context, input *kinesis.ListShardsInput, opts ...request.Option) (*kinesis.ListShardsOutput, error) {
+	i := 0
+	if input.NextToken != nil {
+		i = int(aws.StringValue(input.NextToken)[0] - '0')
+	}
+
+	output := &kinesis.ListShardsOutput{Shards: f.shards[i : i+1]}
+	if i+1 < len(f.shards) {
+		output.NextToken = aws.String(string(rune('0' + i + 1)))
+	}
+	return output, nil
+}
+
+// fakeDynamoDBStreams returns the shards of a stream in pages of one shard.
+type fakeDynamoDBStreams struct {
+	dynamodbstreamsiface.DynamoDBStreamsAPI
+
+	shards []*dynamodbstreams.Shard
+}
+
+func (f *fakeDynamoDBStreams) DescribeStreamWithContext(ctx aws.Context, input *dynamodbstreams.DescribeStreamInput, opts ...request.Option) (*dynamodbstreams.DescribeStreamOutput, error) {
+	i := 0
+	for j, shard := range f.shards {
+		if aws.StringValue(shard.ShardId) == aws.StringValue(input.ExclusiveStartShardId) {
+			i = j + 1
+		}
+	}
+
+	description := &dynamodbstreams.StreamDescription{Shards: f.shards[i : i+1]}
+	if i+1 < len(f.shards) {
+		description.LastEvaluatedShardId = f.shards[i].ShardId
+	}
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: description}, nil
+}
+
+func kinesisShard(id string, closed bool) *kinesis.Shard {
+	shard := &kinesis.Shard{ShardId: aws.String(id), SequenceNumberRange: &kinesis.SequenceNumberRange{StartingSequenceNumber: aws.String("1")}}
+	if closed {
+		shard.SequenceNumberRange.EndingSequenceNumber = aws.String("2")
+	}
+	return shard
+}
+
+func newStreamSource(kinesisClient *fakeKinesis, streamsClient *fakeDynamoDBStreams, manager CloudWatchManager) *streamSource {
+	cfg := config.NewDefaultConfig()
+	cfg.AWS.Region = "us-west-2"
+
+	s := NewStreamSource(cfg, manager, NewRateLimiter(cfg)).(*streamSource)
+	s.newKinesisClient = func(cfg *config.AdapterConfig, role, region *string) kinesisiface.KinesisAPI {
+		return kinesisClient
+	}
+	s.newDynamoDBStreamsClient = func(cfg *config.AdapterConfig, role, region *string) dynamodbstreamsiface.DynamoDBStreamsAPI {
+		return streamsClient
+	}
+	return s
+}
+
+func newStreamRequest(query v1alpha1.StreamQuery) v1alpha1.ExternalMetric {
+	return v1alpha1.ExternalMetric{Spec: v1alpha1.MetricSeriesSpec{Stream: &query}}
+}
+
+func TestStreamSourceOpenShardCount(t *testing.T) {
+	s := newStreamSource(&fakeKinesis{openShards: 4}, &fakeDynamoDBStreams{shards: []*dynamodbstreams.Shard{
+		{ShardId: aws.String("a"), SequenceNumberRange: &dynamodbstreams.SequenceNumberRange{EndingSequenceNumber: aws.String("2")}},
+		{ShardId: aws.String("b"), SequenceNumberRange: &dynamodbstreams.SequenceNumberRange{}},
+		{ShardId: aws.String("c"), SequenceNumberRange: &dynamodbstreams.SequenceNumberRange{}},
+	}}, nil)
+
+	tests := []struct {
+		name  string
+		query v1alpha1.StreamQuery
+		want  float64
+	}{
+		{name: "kinesis", query: v1alpha1.StreamQuery{KinesisStreamName: "clicks"}, want: 4},
+		{name: "dynamodb", query: v1alpha1.StreamQuery{DynamoDBStreamARN: "arn:aws:dynamodb:us-west-2:123456789012:table/orders/stream/2020-01-01T00:00:00.000"}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := s.Query(context.Background(), newStreamRequest(tt.query))
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(samples) != 1 || samples[0].Value != tt.want {
+				t.Errorf("samples = %+v, want a sample of %v", samples, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamSourceLaggingShardCount(t *testing.T) {
+	now := time.Now()
+	kinesisClient := &fakeKinesis{shards: []*kinesis.Shard{
+		kinesisShard("shardId-0", true),
+		kinesisShard("shardId-1", false),
+		kinesisShard("shardId-2", false),
+		kinesisShard("shardId-3", false),
+	}}
+	manager := &fakeCloudWatchManager{results: []*cloudwatch.MetricDataResult{
+		{Id: aws.String("shard_0"), Timestamps: []*time.Time{aws.Time(now)}, Values: []*float64{aws.Float64(120000)}},
+		{Id: aws.String("shard_1"), Timestamps: []*time.Time{aws.Time(now)}, Values: []*float64{aws.Float64(500)}},
+		{Id: aws.String("shard_2"), Values: []*float64{}},
+	}}
+	s := newStreamSource(kinesisClient, nil, manager)
+
+	samples, err := s.Query(context.Background(), newStreamRequest(v1alpha1.StreamQuery{
+		KinesisStreamName:    "clicks",
+		Value:                "LaggingShardCount",
+		IteratorAgeThreshold: &metav1.Duration{Duration: time.Minute},
+	}))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(samples) != 1 || samples[0].Value != 1 {
+		t.Errorf("samples = %+v, want a sample of 1", samples)
+	}
+
+	queries := manager.request.Spec.Queries
+	if len(queries) != 3 {
+		t.Fatalf("len(queries) = %d, want a query per open shard", len(queries))
+	}
+	if shard := queries[0].MetricStat.Metric.Dimensions[1].Value; shard != "shardId-1" {
+		t.Errorf("first queried shard = %v, want shardId-1", shard)
+	}
+	if errs := ValidateMetricSeriesSpec(manager.request.Spec, field.NewPath("spec")); len(errs) > 0 {
+		t.Errorf("CloudWatch request is invalid: %v", errs)
+	}
+}
+
+func TestStreamSourceIteratorAge(t *testing.T) {
+	now := time.Now()
+	manager := &fakeCloudWatchManager{results: []*cloudwatch.MetricDataResult{
+		{Id: aws.String("iterator_age"), Timestamps: []*time.Time{aws.Time(now)}, Values: []*float64{aws.Float64(3000)}},
+	}}
+	s := newStreamSource(nil, nil, manager)
+
+	samples, err := s.Query(context.Background(), newStreamRequest(v1alpha1.StreamQuery{KinesisStreamName: "clicks", Value: "IteratorAgeMilliseconds"}))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(samples) != 1 || samples[0].Value != 3000 || samples[0].Labels["stream"] != "clicks" {
+		t.Errorf("samples = %+v, want a sample of 3000 for stream clicks", samples)
+	}
+	if name := manager.request.Spec.Queries[0].MetricStat.Metric.MetricName; name != "GetRecords.IteratorAgeMilliseconds" {
+		t.Errorf("metric = %v, want GetRecords.IteratorAgeMilliseconds", name)
+	}
+}
+
+func TestStreamSourceValidate(t *testing.T) {
+	streamARN := "arn:aws:dynamodb:us-west-2:123456789012:table/orders/stream/2020-01-01T00:00:00.000"
+	tests := []struct {
+		name     string
+		query    v1alpha1.StreamQuery
+		wantErrs int
+	}{
+		{name: "kinesis", query: v1alpha1.StreamQuery{KinesisStreamName: "clicks"}},
+		{name: "dynamodb", query: v1alpha1.StreamQuery{DynamoDBStreamARN: streamARN}},
+		{name: "no stream", query: v1alpha1.StreamQuery{}, wantErrs: 1},
+		{name: "both", query: v1alpha1.StreamQuery{KinesisStreamName: "clicks", DynamoDBStreamARN: streamARN}, wantErrs: 1},
+		{name: "invalid arn", query: v1alpha1.StreamQuery{DynamoDBStreamARN: "orders"}, wantErrs: 1},
+		{name: "dynamodb iterator age", query: v1alpha1.StreamQuery{DynamoDBStreamARN: streamARN, Value: "IteratorAgeMilliseconds"}, wantErrs: 1},
+		{name: "unknown value", query: v1alpha1.StreamQuery{KinesisStreamName: "clicks", Value: "Shards"}, wantErrs: 1},
+		{name: "missing threshold", query: v1alpha1.StreamQuery{KinesisStreamName: "clicks", Value: "LaggingShardCount"}, wantErrs: 1},
+	}
+
+	s := newStreamSource(nil, nil, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := s.Validate(newStreamRequest(tt.query).Spec, field.NewPath("spec")); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
@@ -1,34 +1,60 @@
 package aws
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
-
-	"k8s.io/klog"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
 )
 
+// availabilityZoneURL is the instance metadata endpoint returning the availability zone of the node.
+var availabilityZoneURL = "http://169.254.169.254/latest/meta-data/placement/availability-zone/"
+
+// metadataClient queries the instance metadata, which doesn't answer outside of EC2.
+var metadataClient = &http.Client{Timeout: 2 * time.Second}
+
 // GetLocalRegion gets the region ID from the instance metadata.
 func GetLocalRegion() string {
-	resp, err := http.Get("http://169.254.169.254/latest/meta-data/placement/availability-zone/")
+	resp, err := metadataClient.Get(availabilityZoneURL)
 	if err != nil {
-		klog.Errorf("unable to get current region information, %v", err)
+		logging.Error(err, "Unable to get current region information")
 		return ""
 	}
 
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		klog.Errorf("cannot read response from instance metadata, %v", err)
+		logging.Error(err, "Cannot read response from instance metadata")
+		return ""
+	}
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		logging.Error(fmt.Errorf("unexpected response %q with status %s", body, resp.Status), "Cannot read availability zone from instance metadata")
+		return ""
 	}
 
 	// strip the last character from AZ to get region ID
 	return string(body[0 : len(body)-1])
 }
 
+// NewGetMetricDataInput builds the GetMetricData request sent to CloudWatch for an external metric,
+// querying the window ending at the start of the current minute.
+func NewGetMetricDataInput(externalMetric v1alpha1.ExternalMetric, window time.Duration, now time.Time) cloudwatch.GetMetricDataInput {
+	cwQuery := toCloudWatchQuery(&externalMetric)
+	endTime := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), 0, 0, now.Location())
+	startTime := endTime.Add(-window)
+
+	cwQuery.EndTime = &endTime
+	cwQuery.StartTime = &startTime
+	cwQuery.ScanBy = aws.String("TimestampDescending")
+
+	return cwQuery
+}
+
 func toCloudWatchQuery(externalMetric *v1alpha1.ExternalMetric) cloudwatch.GetMetricDataInput {
 	queries := externalMetric.Spec.Queries
 
@@ -41,8 +67,11 @@ func toCloudWatchQuery(externalMetric *v1alpha1.ExternalMetric) cloudwatch.GetMe
 			Label:      &q.Label,
 			ReturnData: *returnData,
 		}
+		if q.AccountID != "" {
+			mdq.AccountId = aws.String(q.AccountID)
+		}
 
-		if len(q.Expression) == 0 {
+		if len(q.Expression) == 0 && len(q.SQL) == 0 {
 			dimensions := make([]*cloudwatch.Dimension, len(q.MetricStat.Metric.Dimensions))
 			for j := range q.MetricStat.Metric.Dimensions {
 				dimensions[j] = &cloudwatch.Dimension{
@@ -63,14 +92,29 @@ func toCloudWatchQuery(externalMetric *v1alpha1.ExternalMetric) cloudwatch.GetMe
 				Stat:   &q.MetricStat.Stat,
 				Unit:   aws.String(q.MetricStat.Unit),
 			}
+		} else if len(q.SQL) > 0 {
+			// Metrics Insights queries are sent as expressions, with the period of their results
+			mdq.Expression = &q.SQL
+			mdq.Period = aws.Int64(sqlPeriod(q))
+			if q.Label == "" {
+				// without a label CloudWatch labels each series with its GROUP BY values
+				mdq.Label = nil
+			}
 		} else {
 			mdq.Expression = &q.Expression
+			if q.Period > 0 {
+				mdq.Period = aws.Int64(q.Period)
+			}
 		}
 
 		cwMetricQueries[i] = mdq
 	}
 	cwQuery := cloudwatch.GetMetricDataInput{
 		MetricDataQueries: cwMetricQueries,
+		MaxDatapoints:     externalMetric.Spec.MaxDatapoints,
+	}
+	if options := externalMetric.Spec.LabelOptions; options != nil && options.Timezone != "" {
+		cwQuery.LabelOptions = &cloudwatch.LabelOptions{Timezone: aws.String(options.Timezone)}
 	}
 
 	return cwQuery
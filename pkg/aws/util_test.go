@@ -1,12 +1,18 @@
 package aws
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/flowcontrol"
 
 	"github.com/aws/aws-sdk-go/aws"
 	api "github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
 )
 
 func TestToCloudWatchQuery(t *testing.T) {
@@ -80,6 +86,36 @@ func TestToCloudWatchQuery(t *testing.T) {
 	}
 }
 
+func TestToCloudWatchQueryOptions(t *testing.T) {
+	externalMetric := newFullExternalMetric("test")
+	maxDatapoints := int64(10)
+	externalMetric.Spec.MaxDatapoints = &maxDatapoints
+	externalMetric.Spec.LabelOptions = &api.LabelOptions{Timezone: "+0130"}
+	externalMetric.Spec.Queries[0].Period = 300
+	externalMetric.Spec.Queries[2].AccountID = "123456789012"
+
+	metricRequest := toCloudWatchQuery(externalMetric)
+	if aws.Int64Value(metricRequest.MaxDatapoints) != 10 {
+		t.Errorf("metricRequest MaxDatapoints = %v, want 10", metricRequest.MaxDatapoints)
+	}
+	if aws.Int64Value(metricRequest.MetricDataQueries[0].Period) != 300 {
+		t.Errorf("metricRequest expression Period = %v, want 300", metricRequest.MetricDataQueries[0].Period)
+	}
+	if metricRequest.MetricDataQueries[1].Period != nil {
+		t.Errorf("metricRequest metricStat query Period = %v, want nil", *metricRequest.MetricDataQueries[1].Period)
+	}
+
+	if aws.StringValue(metricRequest.MetricDataQueries[2].AccountId) != "123456789012" {
+		t.Errorf("metricRequest AccountId = %v, want 123456789012", metricRequest.MetricDataQueries[2].AccountId)
+	}
+	if metricRequest.MetricDataQueries[0].AccountId != nil {
+		t.Errorf("metricRequest AccountId = %v, want nil", *metricRequest.MetricDataQueries[0].AccountId)
+	}
+	if metricRequest.LabelOptions == nil || aws.StringValue(metricRequest.LabelOptions.Timezone) != "+0130" {
+		t.Errorf("metricRequest LabelOptions = %v, want timezone +0130", metricRequest.LabelOptions)
+	}
+}
+
 func newFullExternalMetric(name string) *api.ExternalMetric {
 	role := "MyRoleARN"
 	region := "Region"
@@ -142,3 +178,82 @@ func newFullExternalMetric(name string) *api.ExternalMetric {
 		},
 	}
 }
+
+func TestWaitForRateLimitReturnsWhenCancelled(t *testing.T) {
+	if err := waitForRateLimit(context.Background(), nil); err != nil {
+		t.Errorf("waitForRateLimit() without a limiter error = %v, want nil", err)
+	}
+
+	// a single query per hour, the first one takes the only token
+	rateLimiter := flowcontrol.NewTokenBucketRateLimiter(1.0/3600, 1)
+	if err := waitForRateLimit(context.Background(), rateLimiter); err != nil {
+		t.Fatalf("waitForRateLimit() error = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := waitForRateLimit(ctx, rateLimiter); err == nil {
+		t.Errorf("waitForRateLimit() error = nil, want an error once the context is done")
+	}
+}
+
+func TestSourcesShareRateLimiter(t *testing.T) {
+	// a single query per hour, shared by every source
+	cfg := config.NewDefaultConfig()
+	cfg.RateLimit = config.RateLimitConfig{QPS: 1.0 / 3600, Burst: 1}
+	rateLimiter := NewRateLimiter(cfg)
+	promQL := NewPromQLSource(cfg, rateLimiter).(*promQLSource)
+	logsInsights := NewLogsInsightsSource(cfg, rateLimiter).(*logsInsightsSource)
+
+	// applying the same rate limit again keeps the tokens already taken
+	reloaded := *cfg
+	promQL.Configure(&reloaded)
+	logsInsights.Configure(&reloaded)
+
+	if _, limiter := promQL.getConfig(); !limiter.TryAccept() {
+		t.Fatalf("TryAccept() = false for the first query, want true")
+	}
+	if _, limiter := logsInsights.getConfig(); limiter.TryAccept() {
+		t.Errorf("TryAccept() = true for a query of another source, want false once the shared token is taken")
+	}
+
+	// a new rate limit replaces the limiter of every source
+	cfg = config.NewDefaultConfig()
+	cfg.RateLimit = config.RateLimitConfig{QPS: 1.0 / 3600, Burst: 2}
+	promQL.Configure(cfg)
+	_, promQLLimiter := promQL.getConfig()
+	_, logsInsightsLimiter := logsInsights.getConfig()
+	if promQLLimiter != logsInsightsLimiter {
+		t.Errorf("sources use different limiters after a new rate limit, want a shared one")
+	}
+}
+
+func TestGetLocalRegion(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{name: "availability zone", status: http.StatusOK, body: "us-west-2a", want: "us-west-2"},
+		{name: "empty body", status: http.StatusOK, body: "", want: ""},
+		{name: "not found", status: http.StatusNotFound, body: "Not Found", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			defer func(u string) { availabilityZoneURL = u }(availabilityZoneURL)
+			availabilityZoneURL = server.URL
+
+			if got := GetLocalRegion(); got != tt.want {
+				t.Errorf("GetLocalRegion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package aws
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/expression"
+)
+
+var (
+	queryIDRegexp   = regexp.MustCompile(`^[a-z][a-zA-Z0-9_]*$`)
+	accountIDRegexp = regexp.MustCompile(`^[0-9]{12}$`)
+	timezoneRegexp  = regexp.MustCompile(`^[+-](0[0-9]|1[0-4])[0-5][0-9]$`)
+)
+
+// ValidateMetricSeriesSpec checks that a metric series can be translated into a valid
+// GetMetricData request.
+func ValidateMetricSeriesSpec(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	queriesPath := fldPath.Child("queries")
+	if len(spec.Queries) == 0 {
+		allErrs = append(allErrs, field.Required(queriesPath, "at least one query is required"))
+	}
+
+	ids := make(map[string]bool, len(spec.Queries))
+	for i, q := range spec.Queries {
+		allErrs = append(allErrs, validateMetricDataQuery(q, ids, queriesPath.Index(i))...)
+	}
+
+	if spec.Combine != nil {
+		allErrs = append(allErrs, validateCombine(spec.Combine, spec.Queries, fldPath.Child("combine"))...)
+	}
+
+	if spec.LabelOptions != nil && spec.LabelOptions.Timezone != "" && !timezoneRegexp.MatchString(spec.LabelOptions.Timezone) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("labelOptions", "timezone"), spec.LabelOptions.Timezone, "must be an offset such as +0130 or -0700"))
+	}
+	if spec.MaxDatapoints != nil && *spec.MaxDatapoints <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxDatapoints"), *spec.MaxDatapoints, "must be greater than zero"))
+	}
+
+	return allErrs
+}
+
+func validateMetricDataQuery(q v1alpha1.MetricDataQuery, ids map[string]bool, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	idPath := fldPath.Child("id")
+	switch {
+	case q.ID == "":
+		allErrs = append(allErrs, field.Required(idPath, ""))
+	case !queryIDRegexp.MatchString(q.ID):
+		allErrs = append(allErrs, field.Invalid(idPath, q.ID, "must start with a lowercase letter and contain only letters, numbers and underscores"))
+	case ids[q.ID]:
+		allErrs = append(allErrs, field.Duplicate(idPath, q.ID))
+	}
+	ids[q.ID] = true
+
+	hasMetricStat := q.MetricStat.Metric.MetricName != ""
+	set := 0
+	for _, isSet := range []bool{q.Expression != "", q.SQL != "", hasMetricStat} {
+		if isSet {
+			set++
+		}
+	}
+	switch {
+	case set > 1:
+		allErrs = append(allErrs, field.Forbidden(fldPath, "only one of expression, sql or metricStat may be specified"))
+	case set == 0:
+		allErrs = append(allErrs, field.Required(fldPath, "one of expression, sql or metricStat must be specified"))
+	case hasMetricStat:
+		allErrs = append(allErrs, validateMetricStat(q.MetricStat, fldPath.Child("metricStat"))...)
+	case q.SQL != "":
+		allErrs = append(allErrs, validateSQL(q, fldPath)...)
+	default:
+		allErrs = append(allErrs, validatePeriod(q.Period, true, fldPath.Child("period"))...)
+	}
+
+	if q.Period != 0 && hasMetricStat {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("period"), "the period of a metricStat is set in metricStat"))
+	}
+	if q.AccountID != "" && !accountIDRegexp.MatchString(q.AccountID) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("accountId"), q.AccountID, "must be a 12 digit account ID"))
+	}
+	if q.Region != nil && *q.Region == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("region"), "", "must not be empty"))
+	}
+	if q.RoleARN != nil && *q.RoleARN == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("roleArn"), "", "must not be empty"))
+	}
+
+	return allErrs
+}
+
+func validateMetricStat(stat v1alpha1.MetricStat, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if stat.Metric.Namespace == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("metric", "namespace"), ""))
+	}
+
+	for i, d := range stat.Metric.Dimensions {
+		dimensionPath := fldPath.Child("metric", "dimensions").Index(i)
+		if d.Name == "" {
+			allErrs = append(allErrs, field.Required(dimensionPath.Child("name"), ""))
+		}
+		if d.Value == "" {
+			allErrs = append(allErrs, field.Required(dimensionPath.Child("value"), ""))
+		}
+	}
+
+	allErrs = append(allErrs, validatePeriod(stat.Period, false, fldPath.Child("period"))...)
+
+	if stat.Stat == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("stat"), ""))
+	}
+
+	return allErrs
+}
+
+// validateCombine checks that a series combines its values with exactly one of a function or an
+// expression, and that the expression only references queries returning data.
+func validateCombine(combine *v1alpha1.Combine, queries []v1alpha1.MetricDataQuery, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch {
+	case combine.Function != "" && combine.Expression != "":
+		allErrs = append(allErrs, field.Forbidden(fldPath, "only one of function or expression may be specified"))
+	case combine.Function == "" && combine.Expression == "":
+		allErrs = append(allErrs, field.Required(fldPath, "one of function or expression must be specified"))
+	case combine.Function != "":
+		switch combine.Function {
+		case combineSum, combineMax, combineMin, combineAverage:
+		default:
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("function"), combine.Function, []string{combineSum, combineMax, combineMin, combineAverage}))
+		}
+	default:
+		expressionPath := fldPath.Child("expression")
+		e, err := expression.Parse(combine.Expression)
+		if err != nil {
+			return append(allErrs, field.Invalid(expressionPath, combine.Expression, err.Error()))
+		}
+
+		returned := map[string]bool{}
+		for _, q := range queries {
+			returned[q.ID] = q.ReturnData == nil || *q.ReturnData
+		}
+		for _, id := range e.Variables() {
+			if !returned[id] {
+				allErrs = append(allErrs, field.Invalid(expressionPath, combine.Expression, fmt.Sprintf("%s is not the id of a query returning data", id)))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validateSQL checks the structure of a Metrics Insights query, the query itself is validated by
+// CloudWatch.
+func validateSQL(q v1alpha1.MetricDataQuery, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	sqlPath := fldPath.Child("sql")
+	if !sqlSelectRegexp.MatchString(q.SQL) {
+		allErrs = append(allErrs, field.Invalid(sqlPath, q.SQL, "must be a SELECT ... FROM ... query"))
+	}
+	if m := sqlLimitRegexp.FindStringSubmatch(q.SQL); m != nil {
+		if limit, err := strconv.Atoi(m[1]); err != nil || limit < 1 || limit > maxSQLLimit {
+			allErrs = append(allErrs, field.Invalid(sqlPath, q.SQL, fmt.Sprintf("LIMIT must be between 1 and %d", maxSQLLimit)))
+		}
+	}
+	if len(sqlGroupByKeys(q.SQL)) > 0 && q.Label != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("label"), "a label replaces the GROUP BY values of the series of a sql query"))
+	}
+
+	allErrs = append(allErrs, validatePeriod(q.Period, true, fldPath.Child("period"))...)
+
+	return allErrs
+}
+
+// validatePeriod checks a period in seconds. High resolution metrics support periods of 1, 5, 10
+// and 30 seconds, all others must be a multiple of 60.
+func validatePeriod(p int64, optional bool, fldPath *field.Path) field.ErrorList {
+	switch {
+	case p == 0 && optional:
+		return nil
+	case p <= 0:
+		return field.ErrorList{field.Required(fldPath, "must be greater than zero")}
+	case p != 1 && p != 5 && p != 10 && p != 30 && p%60 != 0:
+		return field.ErrorList{field.Invalid(fldPath, p, "must be 1, 5, 10, 30 or a multiple of 60")}
+	}
+	return nil
+}
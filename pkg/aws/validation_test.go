@@ -0,0 +1,146 @@
+package aws
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	api "github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+)
+
+func TestValidateMetricSeriesSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(spec *api.MetricSeriesSpec)
+		errs   int
+	}{
+		{
+			name:   "valid",
+			modify: func(spec *api.MetricSeriesSpec) {},
+		},
+		{
+			name:   "no queries",
+			modify: func(spec *api.MetricSeriesSpec) { spec.Queries = nil },
+			errs:   1,
+		},
+		{
+			name:   "invalid id",
+			modify: func(spec *api.MetricSeriesSpec) { spec.Queries[1].ID = "Query2" },
+			errs:   1,
+		},
+		{
+			name:   "duplicate id",
+			modify: func(spec *api.MetricSeriesSpec) { spec.Queries[2].ID = "query2" },
+			errs:   1,
+		},
+		{
+			name:   "expression and metricStat",
+			modify: func(spec *api.MetricSeriesSpec) { spec.Queries[1].Expression = "query3" },
+			errs:   1,
+		},
+		{
+			name:   "neither expression nor metricStat",
+			modify: func(spec *api.MetricSeriesSpec) { spec.Queries[0].Expression = "" },
+			errs:   1,
+		},
+		{
+			name: "invalid metricStat",
+			modify: func(spec *api.MetricSeriesSpec) {
+				spec.Queries[1].MetricStat.Period = 45
+				spec.Queries[1].MetricStat.Stat = ""
+				spec.Queries[1].MetricStat.Metric.Namespace = ""
+				spec.Queries[1].MetricStat.Metric.Dimensions[0].Value = ""
+			},
+			errs: 4,
+		},
+		{
+			name: "sql",
+			modify: func(spec *api.MetricSeriesSpec) {
+				spec.Queries[0].Expression = ""
+				spec.Queries[0].SQL = `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId ORDER BY AVG() DESC LIMIT 10`
+				spec.Queries[0].Period = 300
+			},
+		},
+		{
+			name: "invalid sql",
+			modify: func(spec *api.MetricSeriesSpec) {
+				spec.Queries[0].Expression = ""
+				spec.Queries[0].SQL = "AVG(CPUUtilization) GROUP BY InstanceId LIMIT 1000"
+				spec.Queries[0].Label = "cpu"
+				spec.Queries[0].Period = 45
+			},
+			errs: 4,
+		},
+		{
+			name:   "sql and expression",
+			modify: func(spec *api.MetricSeriesSpec) { spec.Queries[0].SQL = `SELECT MAX(Latency) FROM "AWS/ELB"` },
+			errs:   1,
+		},
+		{
+			name: "expression period and options",
+			modify: func(spec *api.MetricSeriesSpec) {
+				maxDatapoints := int64(10)
+				spec.Queries[0].Period = 300
+				spec.Queries[1].AccountID = "123456789012"
+				spec.LabelOptions = &api.LabelOptions{Timezone: "-0700"}
+				spec.MaxDatapoints = &maxDatapoints
+			},
+		},
+		{
+			name: "invalid period and options",
+			modify: func(spec *api.MetricSeriesSpec) {
+				maxDatapoints := int64(0)
+				spec.Queries[0].Period = 45
+				spec.Queries[1].Period = 60
+				spec.Queries[1].AccountID = "12345"
+				spec.LabelOptions = &api.LabelOptions{Timezone: "UTC"}
+				spec.MaxDatapoints = &maxDatapoints
+			},
+			errs: 5,
+		},
+		{
+			name: "combine",
+			modify: func(spec *api.MetricSeriesSpec) {
+				region := "us-west-2"
+				spec.Queries[1].Region = &region
+				spec.Combine = &api.Combine{Expression: "query1 + query2 * 2"}
+			},
+		},
+		{
+			name: "invalid combine",
+			modify: func(spec *api.MetricSeriesSpec) {
+				empty := ""
+				spec.Queries[1].RoleARN = &empty
+				spec.Combine = &api.Combine{Expression: "query1 + query3 + query4"}
+			},
+			errs: 3,
+		},
+		{
+			name:   "combine function and expression",
+			modify: func(spec *api.MetricSeriesSpec) { spec.Combine = &api.Combine{Function: "Sum", Expression: "query1"} },
+			errs:   1,
+		},
+		{
+			name:   "unknown combine function",
+			modify: func(spec *api.MetricSeriesSpec) { spec.Combine = &api.Combine{Function: "Median"} },
+			errs:   1,
+		},
+		{
+			name:   "invalid combine expression",
+			modify: func(spec *api.MetricSeriesSpec) { spec.Combine = &api.Combine{Expression: "query1 +"} },
+			errs:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newFullExternalMetric("test").Spec
+			tt.modify(&spec)
+
+			errs := ValidateMetricSeriesSpec(spec, field.NewPath("spec"))
+			if len(errs) != tt.errs {
+				t.Errorf("errors = %v, want %d errors", errs, tt.errs)
+			}
+		})
+	}
+}
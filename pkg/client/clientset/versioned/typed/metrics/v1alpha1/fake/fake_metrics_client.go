@@ -25,6 +25,10 @@ type FakeMetricsV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeMetricsV1alpha1) ClusterExternalMetrics() v1alpha1.ClusterExternalMetricInterface {
+	return &FakeClusterExternalMetrics{c}
+}
+
 func (c *FakeMetricsV1alpha1) ExternalMetrics(namespace string) v1alpha1.ExternalMetricInterface {
 	return &FakeExternalMetrics{c, namespace}
 }
@@ -15,4 +15,6 @@
 
 package v1alpha1
 
+type ClusterExternalMetricExpansion interface{}
+
 type ExternalMetricExpansion interface{}
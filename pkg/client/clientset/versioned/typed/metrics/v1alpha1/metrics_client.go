@@ -23,6 +23,7 @@ import (
 
 type MetricsV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	ClusterExternalMetricsGetter
 	ExternalMetricsGetter
 }
 
@@ -31,6 +32,10 @@ type MetricsV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *MetricsV1alpha1Client) ClusterExternalMetrics() ClusterExternalMetricInterface {
+	return newClusterExternalMetrics(c)
+}
+
 func (c *MetricsV1alpha1Client) ExternalMetrics(namespace string) ExternalMetricInterface {
 	return newExternalMetrics(c, namespace)
 }
@@ -50,6 +50,8 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=metrics.aws, Version=v1alpha1
+	case v1alpha1.SchemeGroupVersion.WithResource("clusterexternalmetrics"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Metrics().V1alpha1().ClusterExternalMetrics().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("externalmetrics"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Metrics().V1alpha1().ExternalMetrics().Informer()}, nil
 
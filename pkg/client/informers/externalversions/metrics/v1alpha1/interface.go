@@ -21,6 +21,8 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// ClusterExternalMetrics returns a ClusterExternalMetricInformer.
+	ClusterExternalMetrics() ClusterExternalMetricInformer
 	// ExternalMetrics returns a ExternalMetricInformer.
 	ExternalMetrics() ExternalMetricInformer
 }
@@ -36,6 +38,11 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// ClusterExternalMetrics returns a ClusterExternalMetricInformer.
+func (v *version) ClusterExternalMetrics() ClusterExternalMetricInformer {
+	return &clusterExternalMetricInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // ExternalMetrics returns a ExternalMetricInformer.
 func (v *version) ExternalMetrics() ExternalMetricInformer {
 	return &externalMetricInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
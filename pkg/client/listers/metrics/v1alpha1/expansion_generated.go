@@ -15,6 +15,10 @@
 
 package v1alpha1
 
+// ClusterExternalMetricListerExpansion allows custom methods to be added to
+// ClusterExternalMetricLister.
+type ClusterExternalMetricListerExpansion interface{}
+
 // ExternalMetricListerExpansion allows custom methods to be added to
 // ExternalMetricLister.
 type ExternalMetricListerExpansion interface{}
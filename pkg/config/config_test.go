@@ -0,0 +1,149 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSetsDefaults(t *testing.T) {
+	cfg, err := Parse([]byte(`
+apiVersion: config.metrics.aws/v1alpha1
+kind: AdapterConfig
+aws:
+  region: eu-west-1
+rateLimit:
+  qps: 5
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if cfg.AWS.Region != "eu-west-1" {
+		t.Errorf("aws.region = %v, want %v", cfg.AWS.Region, "eu-west-1")
+	}
+	if cfg.Controller.ResyncPeriod.Duration != 30*time.Second {
+		t.Errorf("controller.resyncPeriod = %v, want %v", cfg.Controller.ResyncPeriod.Duration, 30*time.Second)
+	}
+	if cfg.Controller.Workers != 2 {
+		t.Errorf("controller.workers = %v, want %v", cfg.Controller.Workers, 2)
+	}
+	if cfg.Controller.ActivationInterval.Duration != 15*time.Second {
+		t.Errorf("controller.activationInterval = %v, want %v", cfg.Controller.ActivationInterval.Duration, 15*time.Second)
+	}
+	if cfg.RateLimit.Burst != 1 {
+		t.Errorf("rateLimit.burst = %v, want %v", cfg.RateLimit.Burst, 1)
+	}
+	if cfg.ExternalMetricDefaults.QueryWindow.Duration != 5*time.Minute {
+		t.Errorf("externalMetricDefaults.queryWindow = %v, want %v", cfg.ExternalMetricDefaults.QueryWindow.Duration, 5*time.Minute)
+	}
+}
+
+func TestParseRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "missing version",
+			data: `kind: AdapterConfig`,
+		},
+		{
+			name: "unknown field",
+			data: `
+apiVersion: config.metrics.aws/v1alpha1
+kind: AdapterConfig
+controller:
+  worker: 4
+`,
+		},
+		{
+			name: "invalid duration",
+			data: `
+apiVersion: config.metrics.aws/v1alpha1
+kind: AdapterConfig
+cache:
+  refreshInterval: 30
+`,
+		},
+		{
+			name: "negative workers",
+			data: `
+apiVersion: config.metrics.aws/v1alpha1
+kind: AdapterConfig
+controller:
+  workers: -1
+`,
+		},
+		{
+			name: "unknown log format",
+			data: `
+apiVersion: config.metrics.aws/v1alpha1
+kind: AdapterConfig
+logging:
+  format: yaml
+`,
+		},
+		{
+			name: "invalid role",
+			data: `
+apiVersion: config.metrics.aws/v1alpha1
+kind: AdapterConfig
+externalMetricDefaults:
+  roleArn: my-role
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); err == nil {
+				t.Errorf("Parse() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestWatcherReloadsChangedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	write := func(data string) {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("apiVersion: config.metrics.aws/v1alpha1\nkind: AdapterConfig\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var reloaded *AdapterConfig
+	w := NewWatcher(path, cfg, time.Second)
+	w.OnChange(func(cfg *AdapterConfig) { reloaded = cfg })
+
+	w.check()
+	if reloaded != nil {
+		t.Errorf("reloaded unchanged file")
+	}
+
+	write("apiVersion: config.metrics.aws/v1alpha1\nkind: AdapterConfig\naws:\n  debug: yes\n  maxRetries: -1\n")
+	w.check()
+	if reloaded != nil {
+		t.Errorf("reloaded invalid file")
+	}
+
+	write("apiVersion: config.metrics.aws/v1alpha1\nkind: AdapterConfig\naws:\n  debug: true\n")
+	w.check()
+	if reloaded == nil || !reloaded.AWS.Debug {
+		t.Errorf("reloaded = %+v, want aws.debug to be true", reloaded)
+	}
+}
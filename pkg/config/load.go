@@ -0,0 +1,105 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+)
+
+// Load reads the configuration file at path, sets the defaults and validates it.
+func Load(path string) (*AdapterConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read configuration file")
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes a configuration, sets the defaults and validates it. Unknown fields are rejected
+// so misspelled settings do not go unnoticed.
+func Parse(data []byte) (*AdapterConfig, error) {
+	cfg := &AdapterConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, errors.Wrap(err, "unable to decode configuration")
+	}
+
+	SetDefaults(cfg)
+	if errs := Validate(cfg); len(errs) > 0 {
+		return nil, errors.Wrap(errs.ToAggregate(), "invalid configuration")
+	}
+
+	return cfg, nil
+}
+
+// Validate checks the configuration after defaults were set.
+func Validate(cfg *AdapterConfig) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if cfg.APIVersion != APIVersion {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("apiVersion"), cfg.APIVersion, []string{APIVersion}))
+	}
+	if cfg.Kind != Kind {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("kind"), cfg.Kind, []string{Kind}))
+	}
+
+	awsPath := field.NewPath("aws")
+	if cfg.AWS.Endpoint != "" {
+		if u, err := url.Parse(cfg.AWS.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(awsPath.Child("endpoint"), cfg.AWS.Endpoint, "must be an absolute URL"))
+		}
+	}
+	if cfg.AWS.MaxRetries != nil && *cfg.AWS.MaxRetries < 0 {
+		allErrs = append(allErrs, field.Invalid(awsPath.Child("maxRetries"), *cfg.AWS.MaxRetries, "must not be negative"))
+	}
+
+	controllerPath := field.NewPath("controller")
+	if cfg.Controller.ResyncPeriod.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(controllerPath.Child("resyncPeriod"), cfg.Controller.ResyncPeriod.Duration.String(), "must not be negative"))
+	}
+	if cfg.Controller.Workers < 1 {
+		allErrs = append(allErrs, field.Invalid(controllerPath.Child("workers"), cfg.Controller.Workers, "must be at least 1"))
+	}
+	if cfg.Controller.ActivationInterval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(controllerPath.Child("activationInterval"), cfg.Controller.ActivationInterval.Duration.String(), "must not be negative"))
+	}
+
+	cachePath := field.NewPath("cache")
+	if cfg.Cache.RefreshInterval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(cachePath.Child("refreshInterval"), cfg.Cache.RefreshInterval.Duration.String(), "must not be negative"))
+	}
+	if cfg.Cache.MaxAge.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(cachePath.Child("maxAge"), cfg.Cache.MaxAge.Duration.String(), "must not be negative"))
+	}
+
+	rateLimitPath := field.NewPath("rateLimit")
+	if cfg.RateLimit.QPS < 0 {
+		allErrs = append(allErrs, field.Invalid(rateLimitPath.Child("qps"), cfg.RateLimit.QPS, "must not be negative"))
+	}
+	if cfg.RateLimit.Burst < 0 {
+		allErrs = append(allErrs, field.Invalid(rateLimitPath.Child("burst"), cfg.RateLimit.Burst, "must not be negative"))
+	}
+
+	if cfg.Logging.Verbosity != nil && *cfg.Logging.Verbosity < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("logging", "verbosity"), *cfg.Logging.Verbosity, "must not be negative"))
+	}
+	if format := cfg.Logging.Format; format != "" && format != logging.FormatText && format != logging.FormatJSON {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("logging", "format"), format, []string{logging.FormatText, logging.FormatJSON}))
+	}
+
+	defaultsPath := field.NewPath("externalMetricDefaults")
+	if arn := cfg.ExternalMetricDefaults.RoleARN; arn != "" && !strings.HasPrefix(arn, "arn:") {
+		allErrs = append(allErrs, field.Invalid(defaultsPath.Child("roleArn"), arn, "must be an IAM role ARN"))
+	}
+	if cfg.ExternalMetricDefaults.QueryWindow.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(defaultsPath.Child("queryWindow"), cfg.ExternalMetricDefaults.QueryWindow.Duration.String(), "must be greater than zero"))
+	}
+
+	return allErrs
+}
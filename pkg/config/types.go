@@ -0,0 +1,136 @@
+package config
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// APIVersion is the version of the configuration file format, in a group of its own so it is
+	// not mistaken for the metric objects of the adapter.
+	APIVersion = "config.metrics.aws/v1alpha1"
+	// Kind is the kind of the configuration file.
+	Kind = "AdapterConfig"
+)
+
+// AdapterConfig is the configuration of the adapter, loaded from the file given with --config.
+//
+// The aws, rateLimit, logging and externalMetricDefaults settings are applied when the file
+// changes, the controller and cache settings are only read at startup and require a restart.
+type AdapterConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// AWS configures the clients used to query AWS.
+	AWS AWSConfig `json:"aws,omitempty"`
+	// Controller configures how ExternalMetric objects are watched.
+	Controller ControllerConfig `json:"controller,omitempty"`
+	// Cache configures the background refresh of metric values.
+	Cache CacheConfig `json:"cache,omitempty"`
+	// RateLimit limits the queries sent to AWS.
+	RateLimit RateLimitConfig `json:"rateLimit,omitempty"`
+	// Logging configures the adapter logs.
+	Logging LoggingConfig `json:"logging,omitempty"`
+	// ExternalMetricDefaults are used for the fields an ExternalMetric does not set.
+	ExternalMetricDefaults ExternalMetricDefaults `json:"externalMetricDefaults,omitempty"`
+}
+
+// AWSConfig configures the clients used to query AWS.
+type AWSConfig struct {
+	// Region is the region queried when an ExternalMetric does not set one, the region the
+	// adapter runs in is used when empty.
+	Region string `json:"region,omitempty"`
+	// Endpoint is the URL of the CloudWatch API, the endpoint of the region is used when empty.
+	// This allows querying a local stub.
+	Endpoint string `json:"endpoint,omitempty"`
+	// MaxRetries is the number of times a failed request is retried, the SDK default is used
+	// when not set.
+	MaxRetries *int `json:"maxRetries,omitempty"`
+	// Debug logs the requests sent to AWS and their responses.
+	Debug bool `json:"debug,omitempty"`
+}
+
+// ControllerConfig configures how ExternalMetric objects are watched.
+type ControllerConfig struct {
+	// ResyncPeriod is how often all the metrics are processed again. Defaults to 30s.
+	ResyncPeriod metav1.Duration `json:"resyncPeriod,omitempty"`
+	// Workers is the number of metrics processed concurrently. Defaults to 2.
+	Workers int `json:"workers,omitempty"`
+	// Workloads enables generating an ExternalMetric and a HorizontalPodAutoscaler for the
+	// deployments and stateful sets annotated with an SQS queue.
+	Workloads bool `json:"workloads,omitempty"`
+	// ScaleToZero enables scaling the deployments and stateful sets annotated with scale-to-zero
+	// between zero and one replica.
+	ScaleToZero bool `json:"scaleToZero,omitempty"`
+	// ActivationInterval is how often the workloads annotated with scale-to-zero are checked.
+	// Defaults to 15s.
+	ActivationInterval metav1.Duration `json:"activationInterval,omitempty"`
+}
+
+// CacheConfig configures the background refresh of metric values.
+type CacheConfig struct {
+	// RefreshInterval is how often metric values are refreshed in the background, values are
+	// queried on every request when zero. The --refresh-interval flag takes precedence.
+	RefreshInterval metav1.Duration `json:"refreshInterval,omitempty"`
+	// MaxAge is how long refreshed values are served, after which values are queried on
+	// request again. Defaults to twice the refresh interval.
+	MaxAge metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// RateLimitConfig limits the queries sent to AWS.
+type RateLimitConfig struct {
+	// QPS is the number of queries per second sent to AWS, not limited when zero.
+	QPS float32 `json:"qps,omitempty"`
+	// Burst is the number of queries which may be sent at once. Defaults to 1 when qps is set.
+	Burst int `json:"burst,omitempty"`
+}
+
+// LoggingConfig configures the adapter logs.
+type LoggingConfig struct {
+	// Verbosity is the log level, the --v flag is used when not set.
+	Verbosity *int `json:"verbosity,omitempty"`
+	// Format is the format of the structured log lines of the adapter, text or json. Defaults to
+	// text.
+	Format string `json:"format,omitempty"`
+}
+
+// ExternalMetricDefaults are used for the fields an ExternalMetric does not set.
+type ExternalMetricDefaults struct {
+	// RoleARN is the IAM role assumed to query metrics.
+	RoleARN string `json:"roleArn,omitempty"`
+	// QueryWindow is how far back metric data is queried, the latest value in the window is
+	// used. Defaults to 5m.
+	QueryWindow metav1.Duration `json:"queryWindow,omitempty"`
+}
+
+// NewDefaultConfig returns the configuration used when no file is given.
+func NewDefaultConfig() *AdapterConfig {
+	cfg := &AdapterConfig{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: APIVersion,
+			Kind:       Kind,
+		},
+	}
+	SetDefaults(cfg)
+	return cfg
+}
+
+// SetDefaults sets the fields which are not set in the file to their default values.
+func SetDefaults(cfg *AdapterConfig) {
+	if cfg.Controller.ResyncPeriod.Duration == 0 {
+		cfg.Controller.ResyncPeriod.Duration = 30 * time.Second
+	}
+	if cfg.Controller.Workers == 0 {
+		cfg.Controller.Workers = 2
+	}
+	if cfg.Controller.ActivationInterval.Duration == 0 {
+		cfg.Controller.ActivationInterval.Duration = 15 * time.Second
+	}
+	if cfg.RateLimit.QPS > 0 && cfg.RateLimit.Burst == 0 {
+		cfg.RateLimit.Burst = 1
+	}
+	if cfg.ExternalMetricDefaults.QueryWindow.Duration == 0 {
+		// CloudWatch metrics have latency, query a 5 minute window and extract the latest value
+		cfg.ExternalMetricDefaults.QueryWindow.Duration = 5 * time.Minute
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+)
+
+// Watcher reloads the configuration file when its content changes. The file is polled rather
+// than watched for events, as a ConfigMap volume updates its files by swapping a symlink.
+type Watcher struct {
+	path     string
+	interval time.Duration
+
+	lock     sync.Mutex
+	data     []byte
+	current  *AdapterConfig
+	handlers []func(*AdapterConfig)
+}
+
+// NewWatcher returns a Watcher for the configuration file at path, which was loaded as current.
+func NewWatcher(path string, current *AdapterConfig, interval time.Duration) *Watcher {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logging.Error(err, "Unable to read configuration file", "path", path)
+	}
+
+	return &Watcher{
+		path:     path,
+		interval: interval,
+		data:     data,
+		current:  current,
+	}
+}
+
+// OnChange registers a function called with the new configuration after the file changed.
+func (w *Watcher) OnChange(handler func(*AdapterConfig)) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.handlers = append(w.handlers, handler)
+}
+
+// Run checks the file for changes until stopCh is closed.
+func (w *Watcher) Run(stopCh <-chan struct{}) {
+	logging.Info("Watching configuration file for changes", "path", w.path)
+	wait.Until(w.check, w.interval, stopCh)
+}
+
+// check reloads the file if it changed. An invalid file is logged and the current configuration
+// is kept, so a bad edit does not take the adapter down.
+func (w *Watcher) check() {
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		logging.Error(err, "Unable to read configuration file", "path", w.path)
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if bytes.Equal(data, w.data) {
+		return
+	}
+	w.data = data
+
+	cfg, err := Parse(data)
+	if err != nil {
+		logging.Error(err, "Ignoring changed configuration file", "path", w.path)
+		return
+	}
+
+	if !reflect.DeepEqual(cfg.Controller, w.current.Controller) {
+		logging.Warning("The controller settings changed, they are ignored until the adapter is restarted")
+	}
+	if !reflect.DeepEqual(cfg.Cache, w.current.Cache) {
+		logging.Warning("The cache settings changed, they are ignored until the adapter is restarted")
+	}
+
+	logging.Info("Reloaded configuration file", "path", w.path)
+	w.current = cfg
+	for _, handler := range w.handlers {
+		handler(cfg)
+	}
+}
@@ -0,0 +1,325 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+	"github.com/kubernetes-incubator/custom-metrics-apiserver/pkg/provider"
+)
+
+// The annotations of a workload scaled between zero and one replica on the value of an
+// ExternalMetric. Above one replica the workload is scaled by its HorizontalPodAutoscaler, which
+// does not scale workloads with zero replicas.
+const (
+	// AnnotationScaleToZero enables scaling the workload to zero replicas when set to "true".
+	AnnotationScaleToZero = "cloudwatch.metrics.aws/scale-to-zero"
+	// AnnotationActivationMetric is the name of the external metric activating the workload, the
+	// name of the workload by default, which is the name of the metric generated for a workload
+	// annotated with a queue.
+	AnnotationActivationMetric = "cloudwatch.metrics.aws/activation-metric"
+	// AnnotationActivationThreshold is the value the metric has to exceed to activate the
+	// workload, 0 by default.
+	AnnotationActivationThreshold = "cloudwatch.metrics.aws/activation-threshold"
+	// AnnotationCooldown is how long the metric has to stay at or below the threshold before the
+	// workload is scaled to zero, 5m by default.
+	AnnotationCooldown = "cloudwatch.metrics.aws/cooldown"
+	// AnnotationIdleSince is set by the controller on a workload with one replica to when its
+	// metric was first seen at or below the threshold. The cooldown is counted from it, so it
+	// survives restarts of the adapter and a change of leader.
+	AnnotationIdleSince = "cloudwatch.metrics.aws/idle-since"
+)
+
+const defaultCooldown = 5 * time.Minute
+
+// ExternalMetricGetter returns the values of an external metric, it is implemented by the
+// provider serving the metrics to the HPA.
+type ExternalMetricGetter interface {
+	GetExternalMetric(namespace string, metricSelector labels.Selector, info provider.ExternalMetricInfo) (*external_metrics.ExternalMetricValueList, error)
+}
+
+// ActivationController scales the deployments and stateful sets annotated with scale-to-zero
+// from zero to one replica once their metric exceeds the activation threshold, and from one to
+// zero replicas once it stayed at or below the threshold for the cooldown.
+type ActivationController struct {
+	kubeClient   kubernetes.Interface
+	deployments  appslisters.DeploymentLister
+	statefulSets appslisters.StatefulSetLister
+	synced       []cache.InformerSynced
+	metrics      ExternalMetricGetter
+	recorder     *events.Recorder
+	interval     time.Duration
+	now          func() time.Time
+}
+
+// NewActivationController returns an ActivationController checking the annotated workloads
+// every interval.
+func NewActivationController(kubeClient kubernetes.Interface, kubeInformers kubeinformers.SharedInformerFactory, metrics ExternalMetricGetter, recorder *events.Recorder, interval time.Duration) *ActivationController {
+	deployments := kubeInformers.Apps().V1().Deployments()
+	statefulSets := kubeInformers.Apps().V1().StatefulSets()
+
+	return &ActivationController{
+		kubeClient:   kubeClient,
+		deployments:  deployments.Lister(),
+		statefulSets: statefulSets.Lister(),
+		synced: []cache.InformerSynced{
+			deployments.Informer().HasSynced,
+			statefulSets.Informer().HasSynced,
+		},
+		metrics:  metrics,
+		recorder: recorder,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Run checks the annotated workloads every interval until stopCh is closed. It may be run again
+// once it returned, such as in each term of the leader.
+func (c *ActivationController) Run(stopCh <-chan struct{}) error {
+	defer runtime.HandleCrash()
+
+	if !cache.WaitForCacheSync(stopCh, c.synced...) {
+		select {
+		case <-stopCh:
+			return nil
+		default:
+			return fmt.Errorf("error syncing activation controller cache")
+		}
+	}
+
+	logging.Info("Scaling annotated workloads to zero", "interval", c.interval)
+	wait.Until(c.activateAll, c.interval, stopCh)
+	return nil
+}
+
+// activateAll scales each annotated workload between zero and one replica as needed.
+func (c *ActivationController) activateAll() {
+	deployments, err := c.deployments.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, d := range deployments {
+		c.check(workloadItem{kind: "Deployment", namespace: d.Namespace, name: d.Name}, d, d, replicasOf(d.Spec.Replicas))
+	}
+
+	statefulSets, err := c.statefulSets.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, s := range statefulSets {
+		c.check(workloadItem{kind: "StatefulSet", namespace: s.Namespace, name: s.Name}, s, s, replicasOf(s.Spec.Replicas))
+	}
+}
+
+// check activates a workload annotated with scale-to-zero, and drops the cooldown of a workload
+// which no longer is.
+func (c *ActivationController) check(item workloadItem, workload metav1.Object, obj kruntime.Object, replicas int32) {
+	annotations := workload.GetAnnotations()
+	if annotations[AnnotationScaleToZero] == "true" {
+		c.activate(item, workload, obj, replicas)
+	} else if _, found := annotations[AnnotationIdleSince]; found {
+		c.setIdleSince(item, nil)
+	}
+}
+
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// activate scales a workload from zero to one replica when its metric is above the threshold, and
+// from one to zero replicas when the metric has not been above the threshold for the cooldown.
+func (c *ActivationController) activate(item workloadItem, workload metav1.Object, obj kruntime.Object, replicas int32) {
+	metric, threshold, cooldown, err := activationSettings(workload)
+	if err != nil {
+		c.recorder.Warningf(obj, events.ReasonInvalidAnnotations, "Unable to scale to zero: %v", err)
+		return
+	}
+
+	value, err := c.metricValue(item.namespace, metric)
+	if err != nil {
+		// the provider records the query failures on the metric, the replicas are left unchanged
+		logging.ForMetric(item.namespace, metric).Error(err, "Unable to get activation metric, not changing replicas", "kind", item.kind, "name", item.name)
+		return
+	}
+
+	now := c.now()
+	active := value.Cmp(threshold) > 0
+	idleSince, idle := idleSince(workload)
+	if idle && (active || replicas != 1) {
+		c.setIdleSince(item, nil)
+	}
+
+	switch {
+	case replicas == 0 && active:
+		if scaled, err := c.scale(item, 0, 1); err != nil || !scaled {
+			if err != nil {
+				runtime.HandleError(fmt.Errorf("unable to scale %s %s/%s to 1 replica: %v", item.kind, item.namespace, item.name, err))
+			}
+			return
+		}
+		c.recorder.Normalf(obj, events.ReasonActivated, "Scaled from 0 to 1 replica, %s is %s, above the activation threshold of %s", metric, value.String(), threshold.String())
+	case replicas == 1 && !active:
+		if !idle {
+			// the cooldown starts once the workload is first seen idle
+			c.setIdleSince(item, &now)
+			return
+		}
+		if now.Sub(idleSince) < cooldown {
+			return
+		}
+		if scaled, err := c.scale(item, 1, 0); err != nil || !scaled {
+			if err != nil {
+				runtime.HandleError(fmt.Errorf("unable to scale %s %s/%s to 0 replicas: %v", item.kind, item.namespace, item.name, err))
+			}
+			return
+		}
+		c.setIdleSince(item, nil)
+		c.recorder.Normalf(obj, events.ReasonDeactivated, "Scaled from 1 to 0 replicas, %s has not been above the activation threshold of %s for %v", metric, threshold.String(), cooldown)
+	}
+}
+
+// activationSettings returns the metric, threshold and cooldown of a workload from its
+// annotations.
+func activationSettings(workload metav1.Object) (string, resource.Quantity, time.Duration, error) {
+	annotations := workload.GetAnnotations()
+
+	metric := annotations[AnnotationActivationMetric]
+	if metric == "" {
+		metric = workload.GetName()
+	}
+
+	var threshold resource.Quantity
+	if value, found := annotations[AnnotationActivationThreshold]; found {
+		var err error
+		if threshold, err = resource.ParseQuantity(value); err != nil || threshold.Sign() < 0 {
+			return "", threshold, 0, fmt.Errorf("%s must be a value not less than zero, got %q", AnnotationActivationThreshold, value)
+		}
+	}
+
+	cooldown := defaultCooldown
+	if value, found := annotations[AnnotationCooldown]; found {
+		var err error
+		if cooldown, err = time.ParseDuration(value); err != nil || cooldown < 0 {
+			return "", threshold, 0, fmt.Errorf("%s must be a duration such as 5m, got %q", AnnotationCooldown, value)
+		}
+	}
+
+	return metric, threshold, cooldown, nil
+}
+
+// idleSince returns when a workload was first seen idle, and false if it was not or the annotation
+// is not a time.
+func idleSince(workload metav1.Object) (time.Time, bool) {
+	value, found := workload.GetAnnotations()[AnnotationIdleSince]
+	if !found {
+		return time.Time{}, false
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return since, true
+}
+
+// setIdleSince records when a workload was first seen idle in its annotations, or removes the
+// annotation when since is nil.
+func (c *ActivationController) setIdleSince(item workloadItem, since *time.Time) {
+	var value *string
+	if since != nil {
+		formatted := since.UTC().Format(time.RFC3339)
+		value = &formatted
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{AnnotationIdleSince: value},
+		},
+	})
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+
+	switch item.kind {
+	case "Deployment":
+		_, err = c.kubeClient.AppsV1().Deployments(item.namespace).Patch(item.name, types.MergePatchType, patch)
+	case "StatefulSet":
+		_, err = c.kubeClient.AppsV1().StatefulSets(item.namespace).Patch(item.name, types.MergePatchType, patch)
+	default:
+		err = fmt.Errorf("unable to annotate kind %s", item.kind)
+	}
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("unable to record the cooldown of %s %s/%s: %v", item.kind, item.namespace, item.name, err))
+	}
+}
+
+// metricValue returns the sum of the values of an external metric, as served to the HPA.
+func (c *ActivationController) metricValue(namespace, metric string) (resource.Quantity, error) {
+	var sum resource.Quantity
+	values, err := c.metrics.GetExternalMetric(namespace, labels.Everything(), provider.ExternalMetricInfo{Metric: metric})
+	if err != nil {
+		return sum, err
+	}
+	if len(values.Items) == 0 {
+		return sum, fmt.Errorf("no values")
+	}
+
+	for _, item := range values.Items {
+		sum.Add(item.Value)
+	}
+	return sum, nil
+}
+
+// scale sets the replicas of a workload from the expected replicas, and returns whether it was
+// scaled. The workload is left unchanged when its replicas are no longer the expected ones, as the
+// lister may be behind an HPA or a user scaling it in the meantime.
+func (c *ActivationController) scale(item workloadItem, expected, replicas int32) (bool, error) {
+	log := logging.WithValues("kind", item.kind, "namespace", item.namespace, "name", item.name)
+
+	var scales interface {
+		GetScale(name string, options metav1.GetOptions) (*autoscalingv1.Scale, error)
+		UpdateScale(name string, scale *autoscalingv1.Scale) (*autoscalingv1.Scale, error)
+	}
+	switch item.kind {
+	case "Deployment":
+		scales = c.kubeClient.AppsV1().Deployments(item.namespace)
+	case "StatefulSet":
+		scales = c.kubeClient.AppsV1().StatefulSets(item.namespace)
+	default:
+		return false, fmt.Errorf("unable to scale kind %s", item.kind)
+	}
+
+	scale, err := scales.GetScale(item.name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	if scale.Spec.Replicas != expected {
+		log.V(2).Info("Not scaling workload, its replicas changed", "replicas", scale.Spec.Replicas, "expected", expected)
+		return false, nil
+	}
+
+	log.V(2).Info("Scaling workload", "replicas", replicas)
+	scale.Spec.Replicas = replicas
+	_, err = scales.UpdateScale(item.name, scale)
+	return err == nil, err
+}
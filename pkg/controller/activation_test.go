@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
+	"github.com/kubernetes-incubator/custom-metrics-apiserver/pkg/provider"
+)
+
+// fakeMetrics serves a single value for every metric.
+type fakeMetrics struct {
+	value string
+	err   error
+}
+
+func (m *fakeMetrics) GetExternalMetric(namespace string, metricSelector labels.Selector, info provider.ExternalMetricInfo) (*external_metrics.ExternalMetricValueList, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &external_metrics.ExternalMetricValueList{
+		Items: []external_metrics.ExternalMetricValue{{MetricName: info.Metric, Value: resource.MustParse(m.value)}},
+	}, nil
+}
+
+type activationTest struct {
+	controller *ActivationController
+	deployment *appsv1.Deployment
+	metrics    *fakeMetrics
+	recorder   *record.FakeRecorder
+	now        time.Time
+	// scaleReplicas are the replicas of the scale subresource when they differ from those of the
+	// deployment held by the lister
+	scaleReplicas *int32
+}
+
+// newActivationController returns a controller for a deployment with the given replicas, which
+// scales the deployment held by the test.
+func newActivationController(replicas int32, annotations map[string]string) *activationTest {
+	deployment := newAnnotatedDeployment(annotations)
+	deployment.Spec.Replicas = &replicas
+
+	kubeClient := kubefake.NewSimpleClientset()
+	kubeInformers := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	kubeInformers.Apps().V1().Deployments().Informer().GetIndexer().Add(deployment)
+
+	test := &activationTest{
+		deployment: deployment,
+		metrics:    &fakeMetrics{value: "0"},
+		recorder:   record.NewFakeRecorder(10),
+		now:        time.Unix(1000, 0),
+	}
+	kubeClient.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		replicas := *deployment.Spec.Replicas
+		if test.scaleReplicas != nil {
+			replicas = *test.scaleReplicas
+		}
+		return true, &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: replicas}}, nil
+	})
+	kubeClient.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+		replicas := scale.Spec.Replicas
+		deployment.Spec.Replicas = &replicas
+		return true, scale, nil
+	})
+	// the annotations are patched on the deployment held by the lister
+	kubeClient.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		var patch struct {
+			Metadata struct {
+				Annotations map[string]*string `json:"annotations"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &patch); err != nil {
+			return true, nil, err
+		}
+		for key, value := range patch.Metadata.Annotations {
+			if value == nil {
+				delete(deployment.Annotations, key)
+			} else {
+				deployment.Annotations[key] = *value
+			}
+		}
+		return true, deployment, nil
+	})
+
+	test.controller = NewActivationController(kubeClient, kubeInformers, test.metrics, events.NewRecorder(test.recorder, time.Minute), time.Second)
+	test.controller.now = func() time.Time { return test.now }
+	return test
+}
+
+func (test *activationTest) replicas() int32 {
+	return *test.deployment.Spec.Replicas
+}
+
+func TestIdleWorkloadIsActivated(t *testing.T) {
+	test := newActivationController(0, map[string]string{AnnotationScaleToZero: "true", AnnotationActivationThreshold: "5"})
+
+	test.metrics.value = "5"
+	test.controller.activateAll()
+	if test.replicas() != 0 {
+		t.Errorf("replicas = %d at the threshold, want 0", test.replicas())
+	}
+
+	test.metrics.value = "6"
+	test.controller.activateAll()
+	if test.replicas() != 1 {
+		t.Errorf("replicas = %d above the threshold, want 1", test.replicas())
+	}
+	if !hasEvent(test.recorder, events.ReasonActivated) {
+		t.Errorf("no %s event recorded", events.ReasonActivated)
+	}
+}
+
+func TestWorkloadIsDeactivatedAfterCooldown(t *testing.T) {
+	test := newActivationController(1, map[string]string{AnnotationScaleToZero: "true", AnnotationCooldown: "2m"})
+
+	// the cooldown starts when the workload is first seen idle
+	test.controller.activateAll()
+	if got, want := test.deployment.Annotations[AnnotationIdleSince], test.now.UTC().Format(time.RFC3339); got != want {
+		t.Fatalf("%s = %q, want %q", AnnotationIdleSince, got, want)
+	}
+	test.now = test.now.Add(time.Minute)
+	test.controller.activateAll()
+	if test.replicas() != 1 {
+		t.Fatalf("replicas = %d within the cooldown, want 1", test.replicas())
+	}
+
+	// activity restarts the cooldown
+	test.metrics.value = "3"
+	test.controller.activateAll()
+	if _, found := test.deployment.Annotations[AnnotationIdleSince]; found {
+		t.Fatalf("%s kept while active", AnnotationIdleSince)
+	}
+	test.metrics.value = "0"
+	test.now = test.now.Add(30 * time.Second)
+	test.controller.activateAll()
+	test.now = test.now.Add(90 * time.Second)
+	test.controller.activateAll()
+	if test.replicas() != 1 {
+		t.Fatalf("replicas = %d within the cooldown after activity, want 1", test.replicas())
+	}
+
+	test.now = test.now.Add(time.Minute)
+	test.controller.activateAll()
+	if test.replicas() != 0 {
+		t.Errorf("replicas = %d after the cooldown, want 0", test.replicas())
+	}
+	if !hasEvent(test.recorder, events.ReasonDeactivated) {
+		t.Errorf("no %s event recorded", events.ReasonDeactivated)
+	}
+	if _, found := test.deployment.Annotations[AnnotationIdleSince]; found {
+		t.Errorf("%s kept after scaling to zero", AnnotationIdleSince)
+	}
+}
+
+func TestCooldownSurvivesRestart(t *testing.T) {
+	// the cooldown was started by another replica, or before the adapter restarted
+	idleSince := time.Unix(1000, 0).Add(-3 * time.Minute).UTC().Format(time.RFC3339)
+	test := newActivationController(1, map[string]string{AnnotationScaleToZero: "true", AnnotationCooldown: "2m", AnnotationIdleSince: idleSince})
+
+	test.controller.activateAll()
+	if test.replicas() != 0 {
+		t.Errorf("replicas = %d after the cooldown, want 0", test.replicas())
+	}
+}
+
+func TestCooldownIsDroppedWithoutScaleToZero(t *testing.T) {
+	test := newActivationController(1, map[string]string{AnnotationIdleSince: time.Unix(1000, 0).UTC().Format(time.RFC3339)})
+
+	test.controller.activateAll()
+	if _, found := test.deployment.Annotations[AnnotationIdleSince]; found {
+		t.Errorf("%s kept on a workload not scaled to zero", AnnotationIdleSince)
+	}
+	if test.replicas() != 1 {
+		t.Errorf("replicas = %d, want 1", test.replicas())
+	}
+}
+
+func TestScaledWorkloadIsLeftToHPA(t *testing.T) {
+	test := newActivationController(3, map[string]string{AnnotationScaleToZero: "true", AnnotationCooldown: "0s"})
+
+	test.controller.activateAll()
+	test.now = test.now.Add(time.Minute)
+	test.controller.activateAll()
+	if test.replicas() != 3 {
+		t.Errorf("replicas = %d, want 3", test.replicas())
+	}
+}
+
+func TestScaledWorkloadIsNotDeactivatedFromStaleLister(t *testing.T) {
+	test := newActivationController(1, map[string]string{AnnotationScaleToZero: "true", AnnotationCooldown: "0s"})
+	updated := false
+	test.controller.kubeClient.(*kubefake.Clientset).PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updated = true
+		return false, nil, nil
+	})
+
+	// the HPA scaled the deployment to 3 replicas, the lister still holds 1
+	scaled := int32(3)
+	test.scaleReplicas = &scaled
+	test.controller.activateAll()
+	test.now = test.now.Add(time.Minute)
+	test.controller.activateAll()
+	if updated {
+		t.Errorf("scale updated from %d replicas, want the deployment left to the HPA", scaled)
+	}
+	if hasEvent(test.recorder, events.ReasonDeactivated) {
+		t.Errorf("%s event recorded for a deployment which was not scaled", events.ReasonDeactivated)
+	}
+}
+
+func TestReplicasUnchangedWithoutMetric(t *testing.T) {
+	test := newActivationController(1, map[string]string{AnnotationScaleToZero: "true", AnnotationCooldown: "0s"})
+	test.metrics.err = fmt.Errorf("no metric")
+
+	test.controller.activateAll()
+	test.now = test.now.Add(time.Minute)
+	test.controller.activateAll()
+	if test.replicas() != 1 {
+		t.Errorf("replicas = %d, want 1", test.replicas())
+	}
+}
+
+func TestActivationSettings(t *testing.T) {
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		wantMetric   string
+		wantCooldown time.Duration
+		wantErr      bool
+	}{
+		{name: "defaults", annotations: map[string]string{}, wantMetric: "worker", wantCooldown: defaultCooldown},
+		{name: "metric", annotations: map[string]string{AnnotationActivationMetric: "backlog", AnnotationCooldown: "30s"}, wantMetric: "backlog", wantCooldown: 30 * time.Second},
+		{name: "negative threshold", annotations: map[string]string{AnnotationActivationThreshold: "-1"}, wantErr: true},
+		{name: "invalid cooldown", annotations: map[string]string{AnnotationCooldown: "5"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric, _, cooldown, err := activationSettings(&metav1.ObjectMeta{Name: "worker", Annotations: tt.annotations})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("activationSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (metric != tt.wantMetric || cooldown != tt.wantCooldown) {
+				t.Errorf("activationSettings() = %s, %v, want %s, %v", metric, cooldown, tt.wantMetric, tt.wantCooldown)
+			}
+		})
+	}
+}
@@ -2,38 +2,52 @@ package controller
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
 	informers "github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/informers/externalversions/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
-	"k8s.io/klog"
 )
 
 // Controller will do the work of syncing the external metrics the metric adapter knows about.
 type Controller struct {
-	metricQueue          workqueue.RateLimitingInterface
-	externalMetricSynced cache.InformerSynced
-	enqueuer             func(obj interface{})
-	metricHandler        ControllerHandler
+	metricQueue                 workqueue.RateLimitingInterface
+	externalMetricSynced        cache.InformerSynced
+	clusterExternalMetricSynced cache.InformerSynced
+	enqueuer                    func(obj interface{})
+	metricHandler               ControllerHandler
+
+	externalMetricStore        cache.Store
+	clusterExternalMetricStore cache.Store
+
+	// pending holds the items found in the informer caches once they synced which have not been
+	// processed yet, the controller has synced when none are left.
+	pendingLock sync.Mutex
+	pending     map[namespacedQueueItem]bool
 }
 
 // NewController returns a new controller for handling external metric types
-func NewController(externalMetricInformer informers.ExternalMetricInformer, metricHandler ControllerHandler) *Controller {
+func NewController(externalMetricInformer informers.ExternalMetricInformer, clusterExternalMetricInformer informers.ClusterExternalMetricInformer, metricHandler ControllerHandler) *Controller {
 	controller := &Controller{
-		externalMetricSynced: externalMetricInformer.Informer().HasSynced,
-		metricQueue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "metrics"),
-		metricHandler:        metricHandler,
+		externalMetricSynced:        externalMetricInformer.Informer().HasSynced,
+		clusterExternalMetricSynced: clusterExternalMetricInformer.Informer().HasSynced,
+		externalMetricStore:         externalMetricInformer.Informer().GetStore(),
+		clusterExternalMetricStore:  clusterExternalMetricInformer.Informer().GetStore(),
+		metricQueue:                 workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "metrics"),
+		metricHandler:               metricHandler,
 	}
 
 	// wire up enqueue step. This provides a hook for testing enqueue step
 	controller.enqueuer = controller.enqueueExternalMetric
 
-	klog.Info("Setting up external metric event handlers")
-	externalMetricInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+	logging.V(4).Info("Setting up external metric event handlers")
+	eventHandler := cache.ResourceEventHandlerFuncs{
 		AddFunc: controller.enqueuer,
 		UpdateFunc: func(old, new interface{}) {
 			// Watches and Informers will “sync”.
@@ -44,50 +58,97 @@ func NewController(externalMetricInformer informers.ExternalMetricInformer, metr
 			controller.enqueuer(new)
 		},
 		DeleteFunc: controller.enqueuer,
-	})
+	}
+	externalMetricInformer.Informer().AddEventHandler(eventHandler)
+	clusterExternalMetricInformer.Informer().AddEventHandler(eventHandler)
 
 	return controller
 }
 
-// Run is the main path of execution for the controller loop
-func (c *Controller) Run(numberOfWorkers int, interval time.Duration, stopCh <-chan struct{}) {
+// Run is the main path of execution for the controller loop. It returns once stopCh is closed and
+// the items left on the queue have been processed, or with an error if the caches failed to sync.
+func (c *Controller) Run(numberOfWorkers int, interval time.Duration, stopCh <-chan struct{}) error {
 	defer runtime.HandleCrash()
 	defer c.metricQueue.ShutDown()
 
-	klog.V(2).Info("initializing controller")
+	logging.V(2).Info("Initializing controller")
 
 	// do the initial synchronization (one time) to populate resources
-	if !cache.WaitForCacheSync(stopCh, c.externalMetricSynced) {
-		runtime.HandleError(fmt.Errorf("error syncing controller cache"))
-		return
+	if !cache.WaitForCacheSync(stopCh, c.externalMetricSynced, c.clusterExternalMetricSynced) {
+		select {
+		case <-stopCh:
+			return nil
+		default:
+			return fmt.Errorf("error syncing controller cache")
+		}
 	}
 
-	klog.V(2).Infof("starting %d workers with %d interval", numberOfWorkers, interval)
+	c.setPending()
+
+	logging.Info("Starting workers", "workers", numberOfWorkers, "interval", interval)
+	var wg sync.WaitGroup
 	for i := 0; i < numberOfWorkers; i++ {
-		go wait.Until(c.runWorker, interval, stopCh)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(c.runWorker, interval, stopCh)
+		}()
 	}
 
 	<-stopCh
-	klog.Info("Shutting down workers")
-	return
+	logging.Info("Shutting down workers")
+
+	// the workers drain the items already on the queue before they stop
+	c.metricQueue.ShutDown()
+	wg.Wait()
+	logging.Info("Workers stopped")
+	return nil
+}
+
+// HasSynced returns true once the informer caches synced and every metric found in them has been
+// processed, so the metric cache holds all the metrics known at startup.
+func (c *Controller) HasSynced() bool {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+
+	return c.pending != nil && len(c.pending) == 0
+}
+
+// setPending records the items in the synced informer caches as pending.
+func (c *Controller) setPending() {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+
+	c.pending = make(map[namespacedQueueItem]bool)
+	for _, key := range c.externalMetricStore.ListKeys() {
+		c.pending[namespacedQueueItem{namespaceKey: key, kind: "ExternalMetric"}] = true
+	}
+	for _, key := range c.clusterExternalMetricStore.ListKeys() {
+		c.pending[namespacedQueueItem{namespaceKey: key, kind: "ClusterExternalMetric"}] = true
+	}
+}
+
+// processed removes an item from the pending items once it is done with.
+func (c *Controller) processed(queueItem namespacedQueueItem) {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+
+	delete(c.pending, queueItem)
 }
 
 func (c *Controller) runWorker() {
-	klog.V(2).Info("Worker starting")
+	logging.V(5).Info("Worker starting")
 
 	for c.processNextItem() {
-		klog.V(2).Info("processing next item")
 	}
 
-	klog.V(2).Info("worker completed")
+	logging.V(5).Info("Worker completed")
 }
 
 func (c *Controller) processNextItem() bool {
-	klog.V(2).Info("processing item")
-
 	rawItem, quit := c.metricQueue.Get()
 	if quit {
-		klog.V(2).Info("received quit signal")
+		logging.V(5).Info("Received quit signal")
 		return false
 	}
 
@@ -106,21 +167,23 @@ func (c *Controller) processNextItem() bool {
 	if err != nil {
 		retries := c.metricQueue.NumRequeues(rawItem)
 		if retries < 5 {
-			klog.Errorf("Transient error with %d retries for key %s: %s", retries, rawItem, err)
+			logging.Error(err, "Transient error processing item", "key", queueItem.Key(), "retries", retries)
 			c.metricQueue.AddRateLimited(rawItem)
 			return true
 		}
 
 		// something was wrong with the item on queue
-		klog.Errorf("Max retries hit for key %s: %s", rawItem, err)
+		logging.Error(err, "Max retries hit processing item", "key", queueItem.Key())
 		c.metricQueue.Forget(rawItem)
+		c.processed(queueItem)
 		runtime.HandleError(err)
 		return true
 	}
 
 	//if here success for get item
-	klog.V(2).Infof("successfully processed item '%s'", queueItem)
+	logging.V(4).Info("Processed item", "key", queueItem.Key())
 	c.metricQueue.Forget(rawItem)
+	c.processed(queueItem)
 	return true
 }
 
@@ -134,13 +197,29 @@ func (c *Controller) enqueueExternalMetric(obj interface{}) {
 
 	kind := getKind(obj)
 
-	klog.V(2).Infof("adding item to queue for '%s' with kind '%s'", key, kind)
+	logging.V(4).Info("Adding item to queue", "kind", kind, "key", key)
 	c.metricQueue.AddRateLimited(namespacedQueueItem{
 		namespaceKey: key,
 		kind:         kind,
 	})
 }
 
+// EnqueueKey adds the metric with the given cache key to the queue, such as a metric whose
+// templates have to be resolved again.
+func (c *Controller) EnqueueKey(key string) {
+	i := strings.Index(key, "/")
+	if i < 0 {
+		runtime.HandleError(fmt.Errorf("expected kind/namespace/name key but got %s", key))
+		return
+	}
+
+	logging.V(4).Info("Adding item to queue", "key", key)
+	c.metricQueue.AddRateLimited(namespacedQueueItem{
+		namespaceKey: key[i+1:],
+		kind:         key[:i],
+	})
+}
+
 type namespacedQueueItem struct {
 	namespaceKey string
 	kind         string
@@ -167,8 +246,10 @@ func getKind(obj interface{}) string {
 	switch obj.(type) {
 	case *v1alpha1.ExternalMetric:
 		return "ExternalMetric"
+	case *v1alpha1.ClusterExternalMetric:
+		return "ClusterExternalMetric"
 	default:
-		klog.Error("No known type of object")
+		logging.Error(fmt.Errorf("unexpected type %T", obj), "No known type of object")
 		return ""
 	}
 }
@@ -3,6 +3,7 @@ package controller
 import (
 	"errors"
 	"testing"
+	"time"
 
 	api "github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/clientset/versioned/fake"
@@ -10,6 +11,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
@@ -121,6 +123,33 @@ func TestRetryThenRemoveAfter5AttemptsWithExternalMetric(t *testing.T) {
 
 	runControllerTests(testConfig, t)
 }
+
+func TestProcessRunsToCompletionWithClusterExternalMetric(t *testing.T) {
+	var storeObjects []runtime.Object
+	clusterExternalMetric := newClusterExternalMetric()
+	storeObjects = append(storeObjects, clusterExternalMetric)
+
+	testConfig := testConfig{
+		controllerConfig: controllerConfig{
+			store:          storeObjects,
+			syncedFunction: alwaysSynced,
+			handler:        failedFakeHandler{},
+			runtimes:       1,
+		},
+		want: wanted{
+			itemsRemaing: 1,
+			keepRunning:  true,
+			enqueCount:   2,
+			enquedItem: namespacedQueueItem{
+				namespaceKey: "test",
+				kind:         "ClusterExternalMetric",
+			},
+		},
+	}
+
+	runControllerTests(testConfig, t)
+}
+
 func TestInvalidItemOnQueue(t *testing.T) {
 	// force the queue to have anything other than a string
 	// to exercise the invalid queue path
@@ -157,6 +186,69 @@ func TestInvalidItemOnQueue(t *testing.T) {
 	runControllerTests(testConfig, t)
 }
 
+func TestHasSyncedOnceCachedMetricsProcessed(t *testing.T) {
+	c, i := newController(controllerConfig{
+		store:          []runtime.Object{newExternalMetric(), newClusterExternalMetric()},
+		syncedFunction: alwaysSynced,
+		handler:        successFakeHandler{},
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	i.Start(stopCh)
+	i.WaitForCacheSync(stopCh)
+
+	if c.HasSynced() {
+		t.Errorf("HasSynced() before caches synced = true, want false")
+	}
+
+	c.setPending()
+	if c.HasSynced() {
+		t.Errorf("HasSynced() before items processed = true, want false")
+	}
+
+	for n := 0; n < 2; n++ {
+		c.processNextItem()
+	}
+
+	if !c.HasSynced() {
+		t.Errorf("HasSynced() after items processed = false, want true")
+	}
+}
+
+func TestRunStopsWhenStopChannelClosed(t *testing.T) {
+	c, i := newController(controllerConfig{
+		store:          []runtime.Object{newExternalMetric()},
+		syncedFunction: alwaysSynced,
+		handler:        successFakeHandler{},
+	})
+
+	stopCh := make(chan struct{})
+	i.Start(stopCh)
+	i.WaitForCacheSync(stopCh)
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- c.Run(2, time.Millisecond, stopCh)
+	}()
+
+	if err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return c.HasSynced(), nil
+	}); err != nil {
+		t.Fatalf("controller did not sync: %v", err)
+	}
+
+	close(stopCh)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil", err)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Errorf("Run() did not return after stop")
+	}
+}
+
 func runControllerTests(testConfig testConfig, t *testing.T) {
 	c, i := newController(testConfig.controllerConfig)
 
@@ -195,10 +287,11 @@ func newController(config controllerConfig) (*Controller, informers.SharedInform
 	fakeClient := fake.NewSimpleClientset(config.store...)
 	i := informers.NewSharedInformerFactory(fakeClient, 0)
 
-	c := NewController(i.Metrics().V1alpha1().ExternalMetrics(), config.handler)
+	c := NewController(i.Metrics().V1alpha1().ExternalMetrics(), i.Metrics().V1alpha1().ClusterExternalMetrics(), config.handler)
 
 	// override for testing
 	c.externalMetricSynced = config.syncedFunction
+	c.clusterExternalMetricSynced = config.syncedFunction
 
 	if config.enqueuer != nil {
 		// override for testings
@@ -247,6 +340,19 @@ func newExternalMetric() *api.ExternalMetric {
 	}
 }
 
+func newClusterExternalMetric() *api.ClusterExternalMetric {
+	externalMetric := newExternalMetric()
+	return &api.ClusterExternalMetric{
+		TypeMeta: metav1.TypeMeta{APIVersion: api.SchemeGroupVersion.String(), Kind: "ClusterExternalMetric"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+		Spec: api.ClusterMetricSeriesSpec{
+			MetricSeriesSpec: externalMetric.Spec,
+		},
+	}
+}
+
 type successFakeHandler struct{}
 
 func (h successFakeHandler) Process(key namespacedQueueItem) error {
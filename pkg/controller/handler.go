@@ -3,26 +3,54 @@ package controller
 import (
 	"fmt"
 
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
 	listers "github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/listers/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/metriccache"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/klog"
 )
 
 // Handler processes the events from the controller for external metrics
 type Handler struct {
-	externalmetricLister listers.ExternalMetricLister
-	metriccache          *metriccache.MetricCache
+	externalmetricLister        listers.ExternalMetricLister
+	clusterexternalmetricLister listers.ClusterExternalMetricLister
+	metriccache                 *metriccache.MetricCache
+	validator                   SpecValidator
+	resolver                    TemplateResolver
+	recorder                    *events.Recorder
 }
 
-// NewHandler created a new handler
-func NewHandler(externalmetricLister listers.ExternalMetricLister, metricCache *metriccache.MetricCache) Handler {
+// SpecValidator checks that a metric series can be queried, it is implemented by the registry of
+// metric sources.
+type SpecValidator interface {
+	Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList
+}
+
+// TemplateResolver resolves the templates of a metric series with the Kubernetes object it
+// references, it is implemented by templating.Resolver.
+type TemplateResolver interface {
+	Resolve(key, namespace string, spec v1alpha1.MetricSeriesSpec) (v1alpha1.MetricSeriesSpec, error)
+	Forget(key string)
+}
+
+// NewHandler created a new handler. The template resolver is optional, without it metrics with
+// templates are not served.
+func NewHandler(externalmetricLister listers.ExternalMetricLister, clusterexternalmetricLister listers.ClusterExternalMetricLister, metricCache *metriccache.MetricCache, validator SpecValidator, resolver TemplateResolver, recorder *events.Recorder) Handler {
 	return Handler{
-		externalmetricLister: externalmetricLister,
-		metriccache:          metricCache,
+		externalmetricLister:        externalmetricLister,
+		clusterexternalmetricLister: clusterexternalmetricLister,
+		metriccache:                 metricCache,
+		validator:                   validator,
+		resolver:                    resolver,
+		recorder:                    recorder,
 	}
 }
 
@@ -44,29 +72,157 @@ func (h *Handler) Process(queueItem namespacedQueueItem) error {
 	switch queueItem.kind {
 	case "ExternalMetric":
 		return h.handleExternalMetric(ns, name, queueItem)
+	case "ClusterExternalMetric":
+		return h.handleClusterExternalMetric(name, queueItem)
 	}
 
 	return nil
 }
 
 func (h *Handler) handleExternalMetric(ns, name string, queueItem namespacedQueueItem) error {
+	log := logging.ForMetric(ns, name)
+
 	// check if item exists
-	klog.V(2).Infof("processing item '%s' in namespace '%s'", name, ns)
 	externalMetricInfo, err := h.externalmetricLister.ExternalMetrics(ns).Get(name)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Then this we should remove
-			klog.V(2).Infof("removing item from cache '%s' in namespace '%s'", name, ns)
+			log.V(2).Info("Removing ExternalMetric from cache")
 			h.metriccache.Remove(queueItem.Key())
+			h.forgetTemplate(queueItem)
+			h.recorder.Forget(&v1alpha1.ExternalMetric{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name}})
 			return nil
 		}
 
 		return err
 	}
 
-	klog.V(2).Infof("externalMetricInfo: %v", externalMetricInfo)
-	klog.V(2).Infof("adding to cache item '%s' in namespace '%s'", name, ns)
-	h.metriccache.Update(queueItem.Key(), name, *externalMetricInfo)
+	log.V(4).Info("Processing ExternalMetric", "generation", externalMetricInfo.Generation, "resourceVersion", externalMetricInfo.ResourceVersion)
+	spec, resolved := h.resolve(queueItem, ns, externalMetricInfo.Spec, externalMetricInfo)
+	if !resolved || !h.validate(queueItem, spec, externalMetricInfo) {
+		return nil
+	}
+	if externalMetricInfo.Spec.Template != nil {
+		externalMetricInfo = externalMetricInfo.DeepCopy()
+		externalMetricInfo.Spec = spec
+	}
+
+	metricName := getMetricName(externalMetricInfo.Spec, name)
+	log.V(2).Info("Adding ExternalMetric to cache", "metricName", metricName)
+	h.metriccache.Update(queueItem.Key(), metricName, *externalMetricInfo)
+	h.register(queueItem, metricName, externalMetricInfo)
+
+	return nil
+}
+
+func (h *Handler) handleClusterExternalMetric(name string, queueItem namespacedQueueItem) error {
+	log := logging.ForMetric("", name)
+
+	// check if item exists
+	clusterExternalMetricInfo, err := h.clusterexternalmetricLister.Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Then this we should remove
+			log.V(2).Info("Removing ClusterExternalMetric from cache")
+			h.metriccache.Remove(queueItem.Key())
+			h.forgetTemplate(queueItem)
+			h.recorder.Forget(&v1alpha1.ClusterExternalMetric{ObjectMeta: metav1.ObjectMeta{Name: name}})
+			return nil
+		}
+
+		return err
+	}
+
+	log.V(4).Info("Processing ClusterExternalMetric", "generation", clusterExternalMetricInfo.Generation, "resourceVersion", clusterExternalMetricInfo.ResourceVersion)
+	spec, resolved := h.resolve(queueItem, "", clusterExternalMetricInfo.Spec.MetricSeriesSpec, clusterExternalMetricInfo)
+	if !resolved || !h.validate(queueItem, spec, clusterExternalMetricInfo) {
+		return nil
+	}
+	if clusterExternalMetricInfo.Spec.Template != nil {
+		clusterExternalMetricInfo = clusterExternalMetricInfo.DeepCopy()
+		clusterExternalMetricInfo.Spec.MetricSeriesSpec = spec
+	}
+
+	metricName := getMetricName(clusterExternalMetricInfo.Spec.MetricSeriesSpec, name)
+	log.V(2).Info("Adding ClusterExternalMetric to cache", "metricName", metricName)
+	h.metriccache.Update(queueItem.Key(), metricName, *clusterExternalMetricInfo)
+	h.register(queueItem, metricName, clusterExternalMetricInfo)
 
 	return nil
 }
+
+// resolve returns the metric series of an object with its templates resolved. An object whose
+// templates can't be resolved is removed from the cache until it or the object it references is
+// updated.
+func (h *Handler) resolve(queueItem namespacedQueueItem, namespace string, spec v1alpha1.MetricSeriesSpec, obj kruntime.Object) (v1alpha1.MetricSeriesSpec, bool) {
+	if spec.Template == nil {
+		h.forgetTemplate(queueItem)
+		return spec, true
+	}
+
+	err := fmt.Errorf("templates are not supported")
+	if h.resolver != nil {
+		var resolved v1alpha1.MetricSeriesSpec
+		if resolved, err = h.resolver.Resolve(queueItem.Key(), namespace, spec); err == nil {
+			return resolved, true
+		}
+	}
+
+	logging.Warning("Unable to resolve templates", "key", queueItem.Key(), "err", err)
+	h.metriccache.Remove(queueItem.Key())
+	h.recorder.Warningf(obj, events.ReasonTemplateFailed, "Unable to resolve templates, metric will not be served: %v", err)
+
+	return spec, false
+}
+
+// forgetTemplate stops resolving the templates of an object.
+func (h *Handler) forgetTemplate(queueItem namespacedQueueItem) {
+	if h.resolver != nil {
+		h.resolver.Forget(queueItem.Key())
+	}
+}
+
+// validate checks the metric series of an object, an invalid object is removed from the cache
+// and not retried until it is updated.
+func (h *Handler) validate(queueItem namespacedQueueItem, spec v1alpha1.MetricSeriesSpec, obj kruntime.Object) bool {
+	errs := h.validator.Validate(spec, field.NewPath("spec"))
+	if len(errs) == 0 {
+		return true
+	}
+
+	logging.Warning("Invalid spec", "key", queueItem.Key(), "err", errs.ToAggregate())
+	h.metriccache.Remove(queueItem.Key())
+	h.recorder.Warningf(obj, events.ReasonInvalidSpec, "Invalid spec, metric will not be served: %v", errs.ToAggregate())
+
+	return false
+}
+
+// register reports whether the object is served. When the metric name claimed by an object is
+// already served by another object, it is ignored until the other one is removed.
+func (h *Handler) register(queueItem namespacedQueueItem, metricName string, obj kruntime.Object) {
+	servingKey, conflict := h.metriccache.GetConflict(queueItem.Key())
+	if conflict {
+		logging.Warning("Metric name is already served", "key", queueItem.Key(), "metricName", metricName, "servedBy", servingKey)
+		h.recorder.Warningf(obj, events.ReasonMetricNameConflict,
+			"Metric name %q is already served by %s, this object will be ignored", metricName, servingKey)
+		return
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+
+	h.recorder.Normalf(obj, events.ReasonRegistered, "Serving external metric %q (generation %d)", metricName, accessor.GetGeneration())
+}
+
+// getMetricName returns the external metric name served for a metric series, which is the
+// series name if set or the object name otherwise.
+func getMetricName(spec v1alpha1.MetricSeriesSpec, objectName string) string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+
+	return objectName
+}
@@ -2,12 +2,19 @@ package controller
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	api "github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/aws"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/debug"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/metriccache"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/clientset/versioned/fake"
 	informers "github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/informers/externalversions"
@@ -37,7 +44,7 @@ func TestExternalMetricValueIsStored(t *testing.T) {
 		t.Errorf("error after processing = %v, want %v", err, nil)
 	}
 
-	metricRequest, exists := cache.GetExternalMetric(externalMetric.Namespace, externalMetric.Name)
+	metricRequest, exists := cache.GetExternalMetric(externalMetric.Namespace, externalMetric.Spec.Name)
 
 	if exists == false {
 		t.Errorf("exist = %v, want %v", exists, true)
@@ -63,7 +70,7 @@ func TestShouldBeAbleToStoreCustomAndExternalWithSameNameAndNamespace(t *testing
 		t.Errorf("error after processing = %v, want %v", err, nil)
 	}
 
-	metricRequest, exists := cache.GetExternalMetric(externalMetric.Namespace, externalMetric.Name)
+	metricRequest, exists := cache.GetExternalMetric(externalMetric.Namespace, externalMetric.Spec.Name)
 
 	if exists == false {
 		t.Errorf("exist = %v, want %v", exists, true)
@@ -72,6 +79,185 @@ func TestShouldBeAbleToStoreCustomAndExternalWithSameNameAndNamespace(t *testing
 	validateExternalMetricResult(metricRequest, externalMetric, t)
 }
 
+func TestExternalMetricFallsBackToObjectName(t *testing.T) {
+	var storeObjects []runtime.Object
+	var externalMetricsListerCache []*api.ExternalMetric
+
+	externalMetric := newFullExternalMetric("test")
+	externalMetric.Spec.Name = ""
+	storeObjects = append(storeObjects, externalMetric)
+	externalMetricsListerCache = append(externalMetricsListerCache, externalMetric)
+
+	handler, cache := newHandler(storeObjects, externalMetricsListerCache)
+
+	err := handler.Process(getExternalKey(externalMetric))
+
+	if err != nil {
+		t.Errorf("error after processing = %v, want %v", err, nil)
+	}
+
+	_, exists := cache.GetExternalMetric(externalMetric.Namespace, externalMetric.Name)
+
+	if exists == false {
+		t.Errorf("exist = %v, want %v", exists, true)
+	}
+}
+
+func TestConflictingMetricNameIsReported(t *testing.T) {
+	var storeObjects []runtime.Object
+	var externalMetricsListerCache []*api.ExternalMetric
+
+	older := newFullExternalMetric("older")
+	older.CreationTimestamp = metav1.Unix(1000, 0)
+	newer := newFullExternalMetric("newer")
+	newer.CreationTimestamp = metav1.Unix(2000, 0)
+
+	storeObjects = append(storeObjects, older, newer)
+	externalMetricsListerCache = append(externalMetricsListerCache, older, newer)
+
+	handler, cache, recorder := newHandlerWithRecorder(storeObjects, externalMetricsListerCache)
+
+	var displaced []string
+	cache.OnDisplaced(func(key string) { displaced = append(displaced, key) })
+
+	// process the newer object first, it should be replaced once the older one shows up
+	for _, em := range []*api.ExternalMetric{newer, older} {
+		if err := handler.Process(getExternalKey(em)); err != nil {
+			t.Errorf("error after processing = %v, want %v", err, nil)
+		}
+	}
+
+	if len(displaced) != 1 || displaced[0] != getExternalKey(newer).Key() {
+		t.Errorf("displaced = %v, want [%v]", displaced, getExternalKey(newer).Key())
+	}
+
+	metricRequest, exists := cache.GetExternalMetric(metav1.NamespaceDefault, older.Spec.Name)
+
+	if exists == false {
+		t.Errorf("exist = %v, want %v", exists, true)
+	}
+
+	if metricRequest.Name != older.Name {
+		t.Errorf("served object = %v, want %v", metricRequest.Name, older.Name)
+	}
+
+	// the newer object is reported once it is processed again, which the displaced callback
+	// triggers right away
+	if err := handler.Process(getExternalKey(newer)); err != nil {
+		t.Errorf("error after processing = %v, want %v", err, nil)
+	}
+
+	if !hasEvent(recorder, events.ReasonMetricNameConflict) {
+		t.Errorf("no %s event recorded", events.ReasonMetricNameConflict)
+	}
+
+	// removing the older object hands the metric name over to the newer one
+	cache.Remove(getExternalKey(older).Key())
+
+	metricRequest, exists = cache.GetExternalMetric(metav1.NamespaceDefault, newer.Spec.Name)
+
+	if exists == false {
+		t.Errorf("exist = %v, want %v", exists, true)
+	}
+
+	if metricRequest.Name != newer.Name {
+		t.Errorf("served object = %v, want %v", metricRequest.Name, newer.Name)
+	}
+}
+
+func TestInvalidExternalMetricIsNotStored(t *testing.T) {
+	var storeObjects []runtime.Object
+	var externalMetricsListerCache []*api.ExternalMetric
+
+	externalMetric := newFullExternalMetric("test")
+	externalMetric.Spec.Queries[1].ID = "Query2"
+	storeObjects = append(storeObjects, externalMetric)
+	externalMetricsListerCache = append(externalMetricsListerCache, externalMetric)
+
+	handler, cache, recorder := newHandlerWithRecorder(storeObjects, externalMetricsListerCache)
+
+	// an invalid spec is not retried until the object changes
+	err := handler.Process(getExternalKey(externalMetric))
+
+	if err != nil {
+		t.Errorf("error after processing = %v, want %v", err, nil)
+	}
+
+	_, exists := cache.GetExternalMetric(externalMetric.Namespace, externalMetric.Spec.Name)
+
+	if exists == true {
+		t.Errorf("exist = %v, want %v", exists, false)
+	}
+
+	if !hasEvent(recorder, events.ReasonInvalidSpec) {
+		t.Errorf("no %s event recorded", events.ReasonInvalidSpec)
+	}
+}
+
+// fakeResolver resolves the dimension values of a series to its value.
+type fakeResolver struct {
+	value     string
+	err       error
+	forgotten []string
+}
+
+func (r *fakeResolver) Resolve(key, namespace string, spec api.MetricSeriesSpec) (api.MetricSeriesSpec, error) {
+	resolved := *spec.DeepCopy()
+	for i := range resolved.Queries {
+		for j := range resolved.Queries[i].MetricStat.Metric.Dimensions {
+			resolved.Queries[i].MetricStat.Metric.Dimensions[j].Value = r.value
+		}
+	}
+	return resolved, r.err
+}
+
+func (r *fakeResolver) Forget(key string) {
+	r.forgotten = append(r.forgotten, key)
+}
+
+func TestTemplatedExternalMetricIsResolved(t *testing.T) {
+	externalMetric := newFullExternalMetric("test")
+	externalMetric.Spec.Template = &api.TemplateReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "worker"}
+	externalMetric.Spec.Queries[1].MetricStat.Metric.Dimensions[0].Value = "{{ .Labels.queue }}"
+
+	handler, cache := newHandler([]runtime.Object{externalMetric}, []*api.ExternalMetric{externalMetric})
+	handler.resolver = &fakeResolver{value: "orders"}
+
+	if err := handler.Process(getExternalKey(externalMetric)); err != nil {
+		t.Errorf("error after processing = %v, want %v", err, nil)
+	}
+
+	metricRequest, exists := cache.GetExternalMetric(externalMetric.Namespace, externalMetric.Spec.Name)
+	if !exists {
+		t.Fatalf("exist = %v, want %v", exists, true)
+	}
+	if got := metricRequest.Spec.Queries[1].MetricStat.Metric.Dimensions[0].Value; got != "orders" {
+		t.Errorf("dimension value = %q, want the resolved value", got)
+	}
+	if got := externalMetric.Spec.Queries[1].MetricStat.Metric.Dimensions[0].Value; got != "{{ .Labels.queue }}" {
+		t.Errorf("dimension value of the listed object = %q, want it unchanged", got)
+	}
+}
+
+func TestUnresolvedExternalMetricIsNotStored(t *testing.T) {
+	externalMetric := newFullExternalMetric("test")
+	externalMetric.Spec.Template = &api.TemplateReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "worker"}
+
+	handler, cache, recorder := newHandlerWithRecorder([]runtime.Object{externalMetric}, []*api.ExternalMetric{externalMetric})
+	handler.resolver = &fakeResolver{err: fmt.Errorf("deployments.apps \"worker\" not found")}
+
+	if err := handler.Process(getExternalKey(externalMetric)); err != nil {
+		t.Errorf("error after processing = %v, want %v", err, nil)
+	}
+
+	if _, exists := cache.GetExternalMetric(externalMetric.Namespace, externalMetric.Spec.Name); exists {
+		t.Errorf("exist = %v, want %v", exists, false)
+	}
+	if !hasEvent(recorder, events.ReasonTemplateFailed) {
+		t.Errorf("no %s event recorded", events.ReasonTemplateFailed)
+	}
+}
+
 func TestShouldFailOnInvalidCacheKey(t *testing.T) {
 	var storeObjects []runtime.Object
 	var externalMetricsListerCache []*api.ExternalMetric
@@ -107,10 +293,13 @@ func TestWhenExternalItemHasBeenDeleted(t *testing.T) {
 
 	// don't put anything in the stores
 	handler, cache := newHandler(storeObjects, externalMetricsListerCache)
+	debugStore := debug.NewStore()
+	cache.OnRemoved(debugStore.Forget)
 
 	// add the item to the cache then test if it gets deleted
 	queueItem := getExternalKey(externalMetric)
 	cache.Update(queueItem.Key(), "test", api.ExternalMetric{})
+	debugStore.RecordQuery(*externalMetric, debug.Query{})
 
 	err := handler.Process(queueItem)
 
@@ -123,6 +312,12 @@ func TestWhenExternalItemHasBeenDeleted(t *testing.T) {
 	if exists == true {
 		t.Errorf("exist = %v, want %v", exists, false)
 	}
+
+	// what the debug store recorded for the metric is dropped with it
+	entries := debugStore.Entries(map[string]interface{}{queueItem.Key(): *externalMetric})
+	if len(entries) != 1 || len(entries[0].Queries) != 0 {
+		t.Errorf("debug entries = %+v, want the queries of the deleted metric forgotten", entries)
+	}
 }
 
 func TestWhenItemKindIsUnknown(t *testing.T) {
@@ -151,20 +346,116 @@ func TestWhenItemKindIsUnknown(t *testing.T) {
 	}
 }
 
+func TestClusterExternalMetricValueIsStored(t *testing.T) {
+	var storeObjects []runtime.Object
+	var externalMetricsListerCache []*api.ExternalMetric
+
+	externalMetric := newFullExternalMetric("test")
+	clusterExternalMetric := &api.ClusterExternalMetric{
+		TypeMeta:   metav1.TypeMeta{APIVersion: api.SchemeGroupVersion.String(), Kind: "ClusterExternalMetric"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec: api.ClusterMetricSeriesSpec{
+			MetricSeriesSpec: externalMetric.Spec,
+		},
+	}
+	storeObjects = append(storeObjects, clusterExternalMetric)
+
+	handler, cache := newHandler(storeObjects, externalMetricsListerCache)
+
+	queueItem := namespacedQueueItem{
+		namespaceKey: "test",
+		kind:         "ClusterExternalMetric",
+	}
+	err := handler.Process(queueItem)
+
+	if err != nil {
+		t.Errorf("error after processing = %v, want %v", err, nil)
+	}
+
+	metricRequest, exists := cache.GetClusterExternalMetric(externalMetric.Spec.Name)
+
+	if exists == false {
+		t.Errorf("exist = %v, want %v", exists, true)
+	}
+
+	validateExternalMetricResult(api.ExternalMetric{Spec: metricRequest.Spec.MetricSeriesSpec}, externalMetric, t)
+
+	_, exists = cache.GetExternalMetric(metav1.NamespaceDefault, externalMetric.Spec.Name)
+
+	if exists == true {
+		t.Errorf("namespaced exist = %v, want %v", exists, false)
+	}
+}
+
+func TestWhenClusterItemHasBeenDeleted(t *testing.T) {
+	var storeObjects []runtime.Object
+	var externalMetricsListerCache []*api.ExternalMetric
+
+	// don't put anything in the stores
+	handler, cache := newHandler(storeObjects, externalMetricsListerCache)
+
+	// add the item to the cache then test if it gets deleted
+	queueItem := namespacedQueueItem{
+		namespaceKey: "test",
+		kind:         "ClusterExternalMetric",
+	}
+	cache.Update(queueItem.Key(), "test", api.ClusterExternalMetric{})
+
+	err := handler.Process(queueItem)
+
+	if err != nil {
+		t.Errorf("error == %v, want nil", err)
+	}
+
+	_, exists := cache.GetClusterExternalMetric("test")
+
+	if exists == true {
+		t.Errorf("exist = %v, want %v", exists, false)
+	}
+}
+
 func newHandler(storeObjects []runtime.Object, externalMetricsListerCache []*api.ExternalMetric) (Handler, *metriccache.MetricCache) {
+	handler, cache, _ := newHandlerWithRecorder(storeObjects, externalMetricsListerCache)
+	return handler, cache
+}
+
+func newHandlerWithRecorder(storeObjects []runtime.Object, externalMetricsListerCache []*api.ExternalMetric) (Handler, *metriccache.MetricCache, *record.FakeRecorder) {
 	fakeClient := fake.NewSimpleClientset(storeObjects...)
 	i := informers.NewSharedInformerFactory(fakeClient, 0)
 
 	externalMetricLister := i.Metrics().V1alpha1().ExternalMetrics().Lister()
+	clusterExternalMetricLister := i.Metrics().V1alpha1().ClusterExternalMetrics().Lister()
 
 	for _, em := range externalMetricsListerCache {
 		i.Metrics().V1alpha1().ExternalMetrics().Informer().GetIndexer().Add(em)
 	}
 
+	for _, obj := range storeObjects {
+		if cem, ok := obj.(*api.ClusterExternalMetric); ok {
+			i.Metrics().V1alpha1().ClusterExternalMetrics().Informer().GetIndexer().Add(cem)
+		}
+	}
+
 	cache := metriccache.NewMetricCache()
-	handler := NewHandler(externalMetricLister, cache)
+	recorder := record.NewFakeRecorder(10)
+	handler := NewHandler(externalMetricLister, clusterExternalMetricLister, cache, source.NewRegistry(aws.NewCloudWatchSource(nil)), nil, events.NewRecorder(recorder, time.Minute))
 
-	return handler, cache
+	return handler, cache, recorder
+}
+
+// hasEvent drains the recorded events and reports whether one of them has the given reason.
+func hasEvent(recorder *record.FakeRecorder, reason string) bool {
+	found := false
+	for {
+		select {
+		case event := <-recorder.Events:
+			if strings.Contains(event, " "+reason+" ") {
+				found = true
+			}
+		default:
+			return found
+		}
+	}
 }
 
 func validateExternalMetricResult(metricRequest api.ExternalMetric, externalMetricInfo *api.ExternalMetric, t *testing.T) {
@@ -0,0 +1,468 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	autoscalinglisters "k8s.io/client-go/listers/autoscaling/v2beta2"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	clientset "github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/clientset/versioned"
+	metricinformers "github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/informers/externalversions"
+	listers "github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/listers/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+)
+
+// The annotations of a workload requesting an ExternalMetric and a HorizontalPodAutoscaler scaling
+// it on the messages of an SQS queue. Only the queue and the target are required.
+const (
+	// AnnotationSQSQueue is the name of the queue.
+	AnnotationSQSQueue = "cloudwatch.metrics.aws/sqs-queue"
+	// AnnotationTarget is the number of visible messages per replica.
+	AnnotationTarget = "cloudwatch.metrics.aws/target"
+	// AnnotationMinReplicas is the minimum number of replicas, 1 by default.
+	AnnotationMinReplicas = "cloudwatch.metrics.aws/min-replicas"
+	// AnnotationMaxReplicas is the maximum number of replicas, 10 by default.
+	AnnotationMaxReplicas = "cloudwatch.metrics.aws/max-replicas"
+	// AnnotationRegion is the region of the queue, the region of the adapter by default. The queue
+	// is always read with the role of the adapter, a role annotation would let anyone allowed to
+	// edit the workload make the adapter assume any role.
+	AnnotationRegion = "cloudwatch.metrics.aws/region"
+)
+
+const (
+	defaultMinReplicas = 1
+	defaultMaxReplicas = 10
+
+	// managedByLabel marks the objects generated for annotated workloads.
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "k8s-cloudwatch-adapter"
+)
+
+// WorkloadController generates an ExternalMetric and a HorizontalPodAutoscaler for each deployment
+// and stateful set annotated with an SQS queue. The generated objects are named after the
+// workload and owned by it, so they are deleted with it, and they are deleted once the annotation
+// is removed.
+type WorkloadController struct {
+	kubeClient      kubernetes.Interface
+	metricClient    clientset.Interface
+	deployments     appslisters.DeploymentLister
+	statefulSets    appslisters.StatefulSetLister
+	externalMetrics listers.ExternalMetricLister
+	hpas            autoscalinglisters.HorizontalPodAutoscalerLister
+	synced          []cache.InformerSynced
+	recorder        *events.Recorder
+
+	// queue holds the workloads to sync while the controller runs, it is nil otherwise. The
+	// controller runs once per term of the leader, so each run has its own queue.
+	lock  sync.Mutex
+	queue workqueue.RateLimitingInterface
+}
+
+// workloadItem identifies a workload on the queue.
+type workloadItem struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+// NewWorkloadController returns a WorkloadController watching workloads and the generated objects
+// with the informers of the factories.
+func NewWorkloadController(kubeClient kubernetes.Interface, metricClient clientset.Interface, kubeInformers kubeinformers.SharedInformerFactory, metricInformers metricinformers.SharedInformerFactory, recorder *events.Recorder) *WorkloadController {
+	deployments := kubeInformers.Apps().V1().Deployments()
+	statefulSets := kubeInformers.Apps().V1().StatefulSets()
+	externalMetrics := metricInformers.Metrics().V1alpha1().ExternalMetrics()
+	hpas := kubeInformers.Autoscaling().V2beta2().HorizontalPodAutoscalers()
+
+	c := &WorkloadController{
+		kubeClient:      kubeClient,
+		metricClient:    metricClient,
+		deployments:     deployments.Lister(),
+		statefulSets:    statefulSets.Lister(),
+		externalMetrics: externalMetrics.Lister(),
+		hpas:            hpas.Lister(),
+		synced: []cache.InformerSynced{
+			deployments.Informer().HasSynced,
+			statefulSets.Informer().HasSynced,
+			externalMetrics.Informer().HasSynced,
+			hpas.Informer().HasSynced,
+		},
+		recorder: recorder,
+	}
+
+	workloadHandler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueWorkload,
+		UpdateFunc: func(old, new interface{}) { c.enqueueWorkload(new) },
+	}
+	deployments.Informer().AddEventHandler(workloadHandler)
+	statefulSets.Informer().AddEventHandler(workloadHandler)
+
+	// generated objects which are changed or deleted are generated again
+	generatedHandler := cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, new interface{}) { c.enqueueOwner(new) },
+		DeleteFunc: c.enqueueOwner,
+	}
+	externalMetrics.Informer().AddEventHandler(generatedHandler)
+	hpas.Informer().AddEventHandler(generatedHandler)
+
+	return c
+}
+
+// Run processes the workloads until stopCh is closed. It may be run again once it returned, such
+// as in each term of the leader, and syncs every workload when it starts.
+func (c *WorkloadController) Run(numberOfWorkers int, stopCh <-chan struct{}) error {
+	defer runtime.HandleCrash()
+
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "workloads")
+	c.lock.Lock()
+	c.queue = queue
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		c.queue = nil
+		c.lock.Unlock()
+		queue.ShutDown()
+	}()
+
+	if !cache.WaitForCacheSync(stopCh, c.synced...) {
+		select {
+		case <-stopCh:
+			return nil
+		default:
+			return fmt.Errorf("error syncing workload controller cache")
+		}
+	}
+
+	// the workloads changed while the controller was not running are synced as well
+	if err := c.enqueueAll(); err != nil {
+		return err
+	}
+
+	logging.Info("Generating metrics and autoscalers for annotated workloads", "workers", numberOfWorkers)
+	var wg sync.WaitGroup
+	for i := 0; i < numberOfWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(func() { c.runWorker(queue) }, time.Second, stopCh)
+		}()
+	}
+
+	<-stopCh
+	queue.ShutDown()
+	wg.Wait()
+	return nil
+}
+
+func (c *WorkloadController) runWorker(queue workqueue.RateLimitingInterface) {
+	for c.processNextItem(queue) {
+	}
+}
+
+func (c *WorkloadController) processNextItem(queue workqueue.RateLimitingInterface) bool {
+	rawItem, quit := queue.Get()
+	if quit {
+		return false
+	}
+	defer queue.Done(rawItem)
+
+	item := rawItem.(workloadItem)
+	if err := c.sync(item); err != nil {
+		if queue.NumRequeues(rawItem) < 5 {
+			logging.Error(err, "Transient error syncing workload", "kind", item.kind, "namespace", item.namespace, "name", item.name)
+			queue.AddRateLimited(rawItem)
+			return true
+		}
+		runtime.HandleError(err)
+	}
+
+	queue.Forget(rawItem)
+	return true
+}
+
+// enqueue adds a workload to the queue, workloads are dropped while the controller is not running.
+func (c *WorkloadController) enqueue(item workloadItem) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.queue != nil {
+		c.queue.Add(item)
+	}
+}
+
+// enqueueAll adds every deployment and stateful set to the queue.
+func (c *WorkloadController) enqueueAll() error {
+	deployments, err := c.deployments.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, d := range deployments {
+		c.enqueueWorkload(d)
+	}
+
+	statefulSets, err := c.statefulSets.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, s := range statefulSets {
+		c.enqueueWorkload(s)
+	}
+	return nil
+}
+
+func (c *WorkloadController) enqueueWorkload(obj interface{}) {
+	switch w := obj.(type) {
+	case *appsv1.Deployment:
+		c.enqueue(workloadItem{kind: "Deployment", namespace: w.Namespace, name: w.Name})
+	case *appsv1.StatefulSet:
+		c.enqueue(workloadItem{kind: "StatefulSet", namespace: w.Namespace, name: w.Name})
+	}
+}
+
+// enqueueOwner adds the workload owning a generated object to the queue.
+func (c *WorkloadController) enqueueOwner(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	object, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+
+	owner := metav1.GetControllerOf(object)
+	if owner == nil || owner.APIVersion != appsv1.SchemeGroupVersion.String() || object.GetLabels()[managedByLabel] != managedBy {
+		return
+	}
+	c.enqueue(workloadItem{kind: owner.Kind, namespace: object.GetNamespace(), name: owner.Name})
+}
+
+// sync generates the objects of an annotated workload, or deletes them once the workload is no
+// longer annotated.
+func (c *WorkloadController) sync(item workloadItem) error {
+	workload, err := c.getWorkload(item)
+	if errors.IsNotFound(err) {
+		// the generated objects are garbage collected with the workload
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	obj := workload.(kruntime.Object)
+	metric, hpa, err := generateObjects(item.kind, workload)
+	if err != nil {
+		c.recorder.Warningf(obj, events.ReasonInvalidAnnotations, "Unable to generate an ExternalMetric and a HorizontalPodAutoscaler: %v", err)
+		return nil
+	}
+	if metric == nil {
+		return c.deleteGenerated(workload, obj)
+	}
+
+	if err := c.applyExternalMetric(workload, obj, metric); err != nil {
+		return err
+	}
+	return c.applyHPA(workload, obj, hpa)
+}
+
+func (c *WorkloadController) getWorkload(item workloadItem) (metav1.Object, error) {
+	switch item.kind {
+	case "Deployment":
+		return c.deployments.Deployments(item.namespace).Get(item.name)
+	case "StatefulSet":
+		return c.statefulSets.StatefulSets(item.namespace).Get(item.name)
+	default:
+		return nil, errors.NewNotFound(appsv1.Resource(item.kind), item.name)
+	}
+}
+
+// generateObjects returns the ExternalMetric and the HorizontalPodAutoscaler of a workload from
+// its annotations, or nil if the workload is not annotated with a queue.
+func generateObjects(kind string, workload metav1.Object) (*v1alpha1.ExternalMetric, *autoscalingv2beta2.HorizontalPodAutoscaler, error) {
+	annotations := workload.GetAnnotations()
+	queue := annotations[AnnotationSQSQueue]
+	if queue == "" {
+		return nil, nil, nil
+	}
+
+	target, err := resource.ParseQuantity(annotations[AnnotationTarget])
+	if err != nil || target.Sign() <= 0 {
+		return nil, nil, fmt.Errorf("%s must be a number of messages per replica greater than zero, got %q", AnnotationTarget, annotations[AnnotationTarget])
+	}
+	minReplicas, err := replicasAnnotation(annotations, AnnotationMinReplicas, defaultMinReplicas)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxReplicas, err := replicasAnnotation(annotations, AnnotationMaxReplicas, defaultMaxReplicas)
+	if err != nil {
+		return nil, nil, err
+	}
+	if maxReplicas < minReplicas {
+		return nil, nil, fmt.Errorf("%s must not be less than %s", AnnotationMaxReplicas, AnnotationMinReplicas)
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:            workload.GetName(),
+		Namespace:       workload.GetNamespace(),
+		Labels:          map[string]string{managedByLabel: managedBy},
+		OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(workload, appsv1.SchemeGroupVersion.WithKind(kind))},
+	}
+
+	metric := &v1alpha1.ExternalMetric{
+		ObjectMeta: meta,
+		Spec: v1alpha1.MetricSeriesSpec{
+			SQS: &v1alpha1.SQSQuery{QueueName: queue},
+		},
+	}
+	if region := annotations[AnnotationRegion]; region != "" {
+		metric.Spec.Region = &region
+	}
+
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: *meta.DeepCopy(),
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				Kind:       kind,
+				Name:       workload.GetName(),
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: maxReplicas,
+			Metrics: []autoscalingv2beta2.MetricSpec{{
+				Type: autoscalingv2beta2.ExternalMetricSourceType,
+				External: &autoscalingv2beta2.ExternalMetricSource{
+					Metric: autoscalingv2beta2.MetricIdentifier{Name: workload.GetName()},
+					Target: autoscalingv2beta2.MetricTarget{
+						Type:         autoscalingv2beta2.AverageValueMetricType,
+						AverageValue: &target,
+					},
+				},
+			}},
+		},
+	}
+
+	return metric, hpa, nil
+}
+
+func replicasAnnotation(annotations map[string]string, name string, defaultValue int32) (int32, error) {
+	value, found := annotations[name]
+	if !found {
+		return defaultValue, nil
+	}
+
+	replicas, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || replicas < 1 {
+		return 0, fmt.Errorf("%s must be a number of replicas greater than zero, got %q", name, value)
+	}
+	return int32(replicas), nil
+}
+
+// applyExternalMetric creates or updates the ExternalMetric of a workload. An ExternalMetric of the
+// same name which the workload does not own is left unchanged.
+func (c *WorkloadController) applyExternalMetric(workload metav1.Object, obj kruntime.Object, metric *v1alpha1.ExternalMetric) error {
+	existing, err := c.externalMetrics.ExternalMetrics(metric.Namespace).Get(metric.Name)
+	if errors.IsNotFound(err) {
+		logging.ForMetric(metric.Namespace, metric.Name).V(2).Info("Creating ExternalMetric for the annotations of the workload", "workload", workload.GetName())
+		if _, err := c.metricClient.MetricsV1alpha1().ExternalMetrics(metric.Namespace).Create(metric); err != nil {
+			return err
+		}
+		c.recorder.Normalf(obj, events.ReasonGenerated, "Created ExternalMetric %s", metric.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !metav1.IsControlledBy(existing, workload) {
+		c.recorder.Warningf(obj, events.ReasonGeneratedConflict, "ExternalMetric %s already exists and is not owned by this workload", metric.Name)
+		return nil
+	}
+	if equality.Semantic.DeepEqual(existing.Spec, metric.Spec) && existing.Labels[managedByLabel] == managedBy {
+		return nil
+	}
+
+	updated := existing.DeepCopy()
+	updated.Spec = metric.Spec
+	updated.Labels = mergeLabels(updated.Labels, metric.Labels)
+	_, err = c.metricClient.MetricsV1alpha1().ExternalMetrics(metric.Namespace).Update(updated)
+	return err
+}
+
+// applyHPA creates or updates the HorizontalPodAutoscaler of a workload. An autoscaler of the same
+// name which the workload does not own is left unchanged.
+func (c *WorkloadController) applyHPA(workload metav1.Object, obj kruntime.Object, hpa *autoscalingv2beta2.HorizontalPodAutoscaler) error {
+	existing, err := c.hpas.HorizontalPodAutoscalers(hpa.Namespace).Get(hpa.Name)
+	if errors.IsNotFound(err) {
+		logging.V(2).Info("Creating HorizontalPodAutoscaler for the annotations of the workload", "namespace", hpa.Namespace, "name", hpa.Name, "workload", workload.GetName())
+		if _, err := c.kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).Create(hpa); err != nil {
+			return err
+		}
+		c.recorder.Normalf(obj, events.ReasonGenerated, "Created HorizontalPodAutoscaler %s", hpa.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !metav1.IsControlledBy(existing, workload) {
+		c.recorder.Warningf(obj, events.ReasonGeneratedConflict, "HorizontalPodAutoscaler %s already exists and is not owned by this workload", hpa.Name)
+		return nil
+	}
+	if equality.Semantic.DeepEqual(existing.Spec, hpa.Spec) && existing.Labels[managedByLabel] == managedBy {
+		return nil
+	}
+
+	updated := existing.DeepCopy()
+	updated.Spec = hpa.Spec
+	updated.Labels = mergeLabels(updated.Labels, hpa.Labels)
+	_, err = c.kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).Update(updated)
+	return err
+}
+
+// deleteGenerated deletes the objects generated for a workload which is no longer annotated.
+func (c *WorkloadController) deleteGenerated(workload metav1.Object, obj kruntime.Object) error {
+	namespace, name := workload.GetNamespace(), workload.GetName()
+
+	if metric, err := c.externalMetrics.ExternalMetrics(namespace).Get(name); err == nil && metav1.IsControlledBy(metric, workload) {
+		logging.ForMetric(namespace, name).V(2).Info("Deleting ExternalMetric, the workload is no longer annotated")
+		if err := c.metricClient.MetricsV1alpha1().ExternalMetrics(namespace).Delete(name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		c.recorder.Normalf(obj, events.ReasonGenerated, "Deleted ExternalMetric %s", name)
+	}
+
+	if hpa, err := c.hpas.HorizontalPodAutoscalers(namespace).Get(name); err == nil && metav1.IsControlledBy(hpa, workload) {
+		logging.V(2).Info("Deleting HorizontalPodAutoscaler, the workload is no longer annotated", "namespace", namespace, "name", name)
+		if err := c.kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace).Delete(name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		c.recorder.Normalf(obj, events.ReasonGenerated, "Deleted HorizontalPodAutoscaler %s", name)
+	}
+
+	return nil
+}
+
+func mergeLabels(labels, added map[string]string) map[string]string {
+	merged := make(map[string]string, len(labels)+len(added))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range added {
+		merged[k] = v
+	}
+	return merged
+}
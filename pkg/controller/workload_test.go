@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	api "github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/clientset/versioned/fake"
+	informers "github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/informers/externalversions"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
+)
+
+type workloadTest struct {
+	controller   *WorkloadController
+	kubeClient   *kubefake.Clientset
+	metricClient *fake.Clientset
+	recorder     *record.FakeRecorder
+}
+
+// newWorkloadController returns a controller whose listers hold the given objects.
+func newWorkloadController(objects ...runtime.Object) workloadTest {
+	var kubeObjects, metricObjects []runtime.Object
+	for _, obj := range objects {
+		if _, ok := obj.(*api.ExternalMetric); ok {
+			metricObjects = append(metricObjects, obj)
+		} else {
+			kubeObjects = append(kubeObjects, obj)
+		}
+	}
+
+	kubeClient := kubefake.NewSimpleClientset(kubeObjects...)
+	metricClient := fake.NewSimpleClientset(metricObjects...)
+	kubeInformers := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	metricInformers := informers.NewSharedInformerFactory(metricClient, 0)
+	recorder := record.NewFakeRecorder(10)
+
+	c := NewWorkloadController(kubeClient, metricClient, kubeInformers, metricInformers, events.NewRecorder(recorder, time.Minute))
+	for _, obj := range objects {
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			kubeInformers.Apps().V1().Deployments().Informer().GetIndexer().Add(o)
+		case *appsv1.StatefulSet:
+			kubeInformers.Apps().V1().StatefulSets().Informer().GetIndexer().Add(o)
+		case *autoscalingv2beta2.HorizontalPodAutoscaler:
+			kubeInformers.Autoscaling().V2beta2().HorizontalPodAutoscalers().Informer().GetIndexer().Add(o)
+		case *api.ExternalMetric:
+			metricInformers.Metrics().V1alpha1().ExternalMetrics().Informer().GetIndexer().Add(o)
+		}
+	}
+
+	return workloadTest{controller: c, kubeClient: kubeClient, metricClient: metricClient, recorder: recorder}
+}
+
+func newAnnotatedDeployment(annotations map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "worker",
+			Namespace:   metav1.NamespaceDefault,
+			UID:         "1234",
+			Annotations: annotations,
+		},
+	}
+}
+
+var deploymentItem = workloadItem{kind: "Deployment", namespace: metav1.NamespaceDefault, name: "worker"}
+
+func TestAnnotatedWorkloadIsAutoscaled(t *testing.T) {
+	deployment := newAnnotatedDeployment(map[string]string{
+		AnnotationSQSQueue:    "orders",
+		AnnotationTarget:      "30",
+		AnnotationMaxReplicas: "5",
+		AnnotationRegion:      "eu-west-1",
+		// a role may not be chosen by the editors of the workload
+		"cloudwatch.metrics.aws/role-arn": "arn:aws:iam::123456789012:role/admin",
+	})
+	test := newWorkloadController(deployment)
+
+	if err := test.controller.sync(deploymentItem); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+
+	metric, err := test.metricClient.MetricsV1alpha1().ExternalMetrics(metav1.NamespaceDefault).Get("worker", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("ExternalMetric not created: %v", err)
+	}
+	if metric.Spec.SQS == nil || metric.Spec.SQS.QueueName != "orders" || metric.Spec.Region == nil || *metric.Spec.Region != "eu-west-1" {
+		t.Errorf("ExternalMetric spec = %+v, want the orders queue in eu-west-1", metric.Spec)
+	}
+	if metric.Spec.RoleARN != nil {
+		t.Errorf("ExternalMetric role = %s, want the role of the adapter", *metric.Spec.RoleARN)
+	}
+	if !metav1.IsControlledBy(metric, deployment) {
+		t.Errorf("ExternalMetric owners = %v, want the deployment", metric.OwnerReferences)
+	}
+
+	hpa, err := test.kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(metav1.NamespaceDefault).Get("worker", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("HorizontalPodAutoscaler not created: %v", err)
+	}
+	if *hpa.Spec.MinReplicas != 1 || hpa.Spec.MaxReplicas != 5 {
+		t.Errorf("replicas = %d-%d, want 1-5", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	}
+	external := hpa.Spec.Metrics[0].External
+	if external.Metric.Name != "worker" || external.Target.AverageValue.Value() != 30 {
+		t.Errorf("external metric = %+v, want worker with an average value of 30", external)
+	}
+	if ref := hpa.Spec.ScaleTargetRef; ref.Kind != "Deployment" || ref.Name != "worker" {
+		t.Errorf("scale target = %+v, want the deployment", ref)
+	}
+	if !hasEvent(test.recorder, events.ReasonGenerated) {
+		t.Errorf("no %s event recorded", events.ReasonGenerated)
+	}
+}
+
+func TestChangedAnnotationsUpdateGeneratedObjects(t *testing.T) {
+	deployment := newAnnotatedDeployment(map[string]string{AnnotationSQSQueue: "orders", AnnotationTarget: "30"})
+	metric, hpa, err := generateObjects("Deployment", deployment)
+	if err != nil {
+		t.Fatalf("generateObjects() error = %v", err)
+	}
+
+	deployment.Annotations[AnnotationSQSQueue] = "payments"
+	test := newWorkloadController(deployment, metric, hpa)
+	if err := test.controller.sync(deploymentItem); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+
+	updated, err := test.metricClient.MetricsV1alpha1().ExternalMetrics(metav1.NamespaceDefault).Get("worker", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("ExternalMetric not found: %v", err)
+	}
+	if updated.Spec.SQS.QueueName != "payments" {
+		t.Errorf("queue = %s, want payments", updated.Spec.SQS.QueueName)
+	}
+	// the autoscaler did not change
+	for _, action := range test.kubeClient.Actions() {
+		if action.GetVerb() != "get" && action.GetVerb() != "list" && action.GetVerb() != "watch" {
+			t.Errorf("unexpected action %v", action)
+		}
+	}
+}
+
+func TestRemovedAnnotationDeletesGeneratedObjects(t *testing.T) {
+	deployment := newAnnotatedDeployment(map[string]string{AnnotationSQSQueue: "orders", AnnotationTarget: "30"})
+	metric, hpa, err := generateObjects("Deployment", deployment)
+	if err != nil {
+		t.Fatalf("generateObjects() error = %v", err)
+	}
+
+	deployment.Annotations = nil
+	test := newWorkloadController(deployment, metric, hpa)
+	if err := test.controller.sync(deploymentItem); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+
+	if _, err := test.metricClient.MetricsV1alpha1().ExternalMetrics(metav1.NamespaceDefault).Get("worker", metav1.GetOptions{}); err == nil {
+		t.Errorf("ExternalMetric not deleted")
+	}
+	if _, err := test.kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(metav1.NamespaceDefault).Get("worker", metav1.GetOptions{}); err == nil {
+		t.Errorf("HorizontalPodAutoscaler not deleted")
+	}
+}
+
+func TestObjectsNotOwnedByWorkloadAreLeftUnchanged(t *testing.T) {
+	deployment := newAnnotatedDeployment(map[string]string{AnnotationSQSQueue: "orders", AnnotationTarget: "30"})
+	existing := newExternalMetric()
+	existing.Name = "worker"
+
+	test := newWorkloadController(deployment, existing)
+	if err := test.controller.sync(deploymentItem); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+
+	metric, err := test.metricClient.MetricsV1alpha1().ExternalMetrics(metav1.NamespaceDefault).Get("worker", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("ExternalMetric not found: %v", err)
+	}
+	if metric.Spec.SQS != nil {
+		t.Errorf("ExternalMetric spec = %+v, want it unchanged", metric.Spec)
+	}
+	if !hasEvent(test.recorder, events.ReasonGeneratedConflict) {
+		t.Errorf("no %s event recorded", events.ReasonGeneratedConflict)
+	}
+
+	// removing the annotation does not delete an object the workload does not own
+	deployment.Annotations = nil
+	if err := test.controller.sync(deploymentItem); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+	if _, err := test.metricClient.MetricsV1alpha1().ExternalMetrics(metav1.NamespaceDefault).Get("worker", metav1.GetOptions{}); err != nil {
+		t.Errorf("ExternalMetric deleted: %v", err)
+	}
+}
+
+func TestInvalidAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+	}{
+		{name: "missing target", annotations: map[string]string{AnnotationSQSQueue: "orders"}},
+		{name: "negative target", annotations: map[string]string{AnnotationSQSQueue: "orders", AnnotationTarget: "-1"}},
+		{name: "zero min replicas", annotations: map[string]string{AnnotationSQSQueue: "orders", AnnotationTarget: "30", AnnotationMinReplicas: "0"}},
+		{name: "max below min", annotations: map[string]string{AnnotationSQSQueue: "orders", AnnotationTarget: "30", AnnotationMinReplicas: "3", AnnotationMaxReplicas: "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := newWorkloadController(newAnnotatedDeployment(tt.annotations))
+			if err := test.controller.sync(deploymentItem); err != nil {
+				t.Fatalf("sync() error = %v, want invalid annotations not to be retried", err)
+			}
+			if !hasEvent(test.recorder, events.ReasonInvalidAnnotations) {
+				t.Errorf("no %s event recorded", events.ReasonInvalidAnnotations)
+			}
+			if actions := test.metricClient.Actions(); len(actions) != 0 {
+				t.Errorf("actions = %v, want none", actions)
+			}
+		})
+	}
+}
+
+func TestWorkloadsAreSyncedInEachRun(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset(newAnnotatedDeployment(map[string]string{AnnotationSQSQueue: "orders", AnnotationTarget: "30"}))
+	metricClient := fake.NewSimpleClientset()
+	kubeInformers := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	metricInformers := informers.NewSharedInformerFactory(metricClient, 0)
+	c := NewWorkloadController(kubeClient, metricClient, kubeInformers, metricInformers, events.NewRecorder(record.NewFakeRecorder(10), time.Minute))
+
+	informersStopCh := make(chan struct{})
+	defer close(informersStopCh)
+	kubeInformers.Start(informersStopCh)
+	metricInformers.Start(informersStopCh)
+
+	// like a replica leading twice, the workloads annotated before each term are synced
+	for term := 1; term <= 2; term++ {
+		stopCh := make(chan struct{})
+		errCh := make(chan error)
+		go func() {
+			errCh <- c.Run(1, stopCh)
+		}()
+
+		if err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+			_, err := metricClient.MetricsV1alpha1().ExternalMetrics(metav1.NamespaceDefault).Get("worker", metav1.GetOptions{})
+			return err == nil, nil
+		}); err != nil {
+			t.Fatalf("ExternalMetric not created in term %d: %v", term, err)
+		}
+
+		close(stopCh)
+		if err := <-errCh; err != nil {
+			t.Fatalf("Run() = %v, want nil", err)
+		}
+		if err := metricClient.MetricsV1alpha1().ExternalMetrics(metav1.NamespaceDefault).Delete("worker", &metav1.DeleteOptions{}); err != nil {
+			t.Fatalf("unable to delete ExternalMetric: %v", err)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Package debug keeps the last queries sent for each metric and the values served for it, and
+// serves them on the debug endpoint of the adapter.
+package debug
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/metriccache"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// maxQueries is the number of queries of each kind kept for each metric. A metric sends several
+// queries when it queries several regions or roles, or when it falls back to other queries.
+const maxQueries = 10
+
+// SourceQuery is a query of a metric sent to a metric source, such as CloudWatch, Amazon Managed
+// Service for Prometheus or SQS, and the samples it returned.
+type SourceQuery struct {
+	// Time is when the query was sent.
+	Time metav1.Time `json:"time"`
+	// Source is the name of the source the query was sent to.
+	Source string `json:"source"`
+	// Region is the region of the query, empty for the region of the adapter.
+	Region string `json:"region,omitempty"`
+	// RoleARN is the role of the query, empty for the role of the adapter.
+	RoleARN string `json:"roleArn,omitempty"`
+	// Samples are the samples the source returned.
+	Samples []source.Sample `json:"samples,omitempty"`
+	// Latency is how long the query took.
+	Latency string `json:"latency"`
+	// Error is the error the query failed with.
+	Error string `json:"error,omitempty"`
+}
+
+// Query is a GetMetricData request sent for a metric and its response.
+type Query struct {
+	// Time is when the query was sent.
+	Time metav1.Time `json:"time"`
+	// Region is the region the query was sent to.
+	Region string `json:"region"`
+	// Credentials describes where the credentials of the query came from.
+	Credentials string `json:"credentials"`
+	// Input is the GetMetricData input translated from the metric.
+	Input *cloudwatch.GetMetricDataInput `json:"input"`
+	// Results are the raw results of the query.
+	Results []*cloudwatch.MetricDataResult `json:"results,omitempty"`
+	// Latency is how long the query took.
+	Latency string `json:"latency"`
+	// Error is the error the query failed with.
+	Error string `json:"error,omitempty"`
+}
+
+// Served describes the last values served to the HPA for a metric.
+type Served struct {
+	// Time is when the values were served.
+	Time metav1.Time `json:"time"`
+	// Values are the values served, empty when the request failed.
+	Values []ServedValue `json:"values,omitempty"`
+	// Cached is true when the values were refreshed in the background rather than queried.
+	Cached bool `json:"cached"`
+	// Latency is how long serving the request took.
+	Latency string `json:"latency"`
+	// Error is the error the request failed with.
+	Error string `json:"error,omitempty"`
+}
+
+// ServedValue is a value served to the HPA.
+type ServedValue struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  string            `json:"value"`
+}
+
+// Entry is what is known of a metric, it is keyed by the key of the metric in the metric cache.
+type Entry struct {
+	Key       string `json:"key"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// MetricName is the name the metric is served under.
+	MetricName string `json:"metricName"`
+	// SourceQueries are the last queries sent to any metric source for the metric, the latest
+	// first.
+	SourceQueries []SourceQuery `json:"sourceQueries,omitempty"`
+	// Queries are the last CloudWatch GetMetricData queries sent for the metric, the latest first.
+	Queries []Query `json:"queries,omitempty"`
+	// Served are the last values served for the metric.
+	Served *Served `json:"served,omitempty"`
+}
+
+// Store keeps the last queries and served values of each metric. A nil Store records nothing.
+type Store struct {
+	lock          sync.RWMutex
+	sourceQueries map[string][]SourceQuery
+	queries       map[string][]Query
+	served        map[string]Served
+	now           func() time.Time
+}
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{
+		sourceQueries: make(map[string][]SourceQuery),
+		queries:       make(map[string][]Query),
+		served:        make(map[string]Served),
+		now:           time.Now,
+	}
+}
+
+// Key returns the key in the metric cache of a metric request, which is a ClusterExternalMetric
+// when it has no namespace.
+func Key(request v1alpha1.ExternalMetric) string {
+	if request.Namespace == "" {
+		return metriccache.ClusterExternalMetricKey(request.Name)
+	}
+	return metriccache.ExternalMetricKey(request.Namespace, request.Name)
+}
+
+// RecordSourceQuery records a query of a metric request sent to a source, it implements
+// source.QueryRecorder.
+func (s *Store) RecordSourceQuery(request v1alpha1.ExternalMetric, sourceName string, start time.Time, latency time.Duration, samples []source.Sample, err error) {
+	if s == nil {
+		return
+	}
+
+	query := SourceQuery{
+		Time:    metav1.NewTime(start),
+		Source:  sourceName,
+		Region:  stringValue(request.Spec.Region),
+		RoleARN: stringValue(request.Spec.RoleARN),
+		Samples: samples,
+		Latency: latency.String(),
+	}
+	if err != nil {
+		query.Error = err.Error()
+	}
+
+	key := Key(request)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	queries := append([]SourceQuery{query}, s.sourceQueries[key]...)
+	if len(queries) > maxQueries {
+		queries = queries[:maxQueries]
+	}
+	s.sourceQueries[key] = queries
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// RecordQuery records a CloudWatch query sent for a metric request.
+func (s *Store) RecordQuery(request v1alpha1.ExternalMetric, query Query) {
+	if s == nil {
+		return
+	}
+
+	key := Key(request)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	queries := append([]Query{query}, s.queries[key]...)
+	if len(queries) > maxQueries {
+		queries = queries[:maxQueries]
+	}
+	s.queries[key] = queries
+}
+
+// RecordServed records the values served for the metric with the given key.
+func (s *Store) RecordServed(key string, served Served) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.served[key] = served
+}
+
+// Forget drops what is recorded for the metric with the given key, which was removed from the
+// metric cache.
+func (s *Store) Forget(key string) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.sourceQueries, key)
+	delete(s.queries, key)
+	delete(s.served, key)
+}
+
+// Now returns the time recorded with queries and values.
+func (s *Store) Now() time.Time {
+	if s == nil {
+		return time.Now()
+	}
+	return s.now()
+}
+
+// Entries returns the entries of the given metric requests, keyed by their key in the metric
+// cache. What is recorded for the metrics removed from the cache is dropped by Forget.
+func (s *Store) Entries(requests map[string]interface{}) []Entry {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	entries := make([]Entry, 0, len(requests))
+	for key, request := range requests {
+		entry := Entry{Key: key}
+		switch r := request.(type) {
+		case v1alpha1.ExternalMetric:
+			entry.Kind, entry.Namespace, entry.Name, entry.MetricName = "ExternalMetric", r.Namespace, r.Name, r.Spec.Name
+		case v1alpha1.ClusterExternalMetric:
+			entry.Kind, entry.Name, entry.MetricName = "ClusterExternalMetric", r.Name, r.Spec.Name
+		default:
+			continue
+		}
+		if entry.MetricName == "" {
+			entry.MetricName = entry.Name
+		}
+
+		entry.SourceQueries = append([]SourceQuery(nil), s.sourceQueries[key]...)
+		entry.Queries = append([]Query(nil), s.queries[key]...)
+		if served, found := s.served[key]; found {
+			entry.Served = &served
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,125 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/metriccache"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+func newExternalMetric(namespace, name string) v1alpha1.ExternalMetric {
+	return v1alpha1.ExternalMetric{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+}
+
+func TestRecordQueryKeepsLatestQueries(t *testing.T) {
+	store := NewStore()
+	request := newExternalMetric("default", "queue")
+	for i := 0; i < maxQueries+2; i++ {
+		store.RecordQuery(request, Query{Region: fmt.Sprintf("region-%d", i)})
+	}
+
+	key := metriccache.ExternalMetricKey("default", "queue")
+	entries := store.Entries(map[string]interface{}{key: request})
+	if len(entries) != 1 {
+		t.Fatalf("entries = %+v, want 1", entries)
+	}
+	queries := entries[0].Queries
+	if len(queries) != maxQueries {
+		t.Fatalf("queries = %d, want %d", len(queries), maxQueries)
+	}
+	if want := fmt.Sprintf("region-%d", maxQueries+1); queries[0].Region != want {
+		t.Errorf("latest query region = %s, want %s", queries[0].Region, want)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	store := NewStore()
+	external := newExternalMetric("default", "queue")
+	external.Spec.Name = "backlog"
+	cluster := v1alpha1.ClusterExternalMetric{ObjectMeta: metav1.ObjectMeta{Name: "shared"}}
+
+	store.RecordQuery(external, Query{Region: "us-east-1"})
+	store.RecordQuery(newExternalMetric("", "shared"), Query{Region: "eu-west-1"})
+	store.RecordServed(metriccache.ClusterExternalMetricKey("shared"), Served{Values: []ServedValue{{Value: "3"}}})
+	store.RecordQuery(newExternalMetric("default", "removed"), Query{})
+
+	entries := store.Entries(map[string]interface{}{
+		metriccache.ExternalMetricKey("default", "queue"): external,
+		metriccache.ClusterExternalMetricKey("shared"):    cluster,
+	})
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v, want 2", entries)
+	}
+	for _, entry := range entries {
+		switch entry.Kind {
+		case "ExternalMetric":
+			if entry.MetricName != "backlog" || len(entry.Queries) != 1 || entry.Served != nil {
+				t.Errorf("external metric entry = %+v, want one query served as backlog", entry)
+			}
+		case "ClusterExternalMetric":
+			if entry.MetricName != "shared" || len(entry.Queries) != 1 || entry.Served == nil || entry.Served.Values[0].Value != "3" {
+				t.Errorf("cluster metric entry = %+v, want one query and the served value", entry)
+			}
+		}
+	}
+
+	// reading the entries leaves what is recorded unchanged, removed metrics are forgotten by Forget
+	if _, found := store.queries[metriccache.ExternalMetricKey("default", "removed")]; !found {
+		t.Errorf("queries of a metric missing from the entries were dropped by Entries()")
+	}
+}
+
+func TestRecordSourceQuery(t *testing.T) {
+	store := NewStore()
+	request := newExternalMetric("default", "queue")
+	region := "eu-west-1"
+	request.Spec.Region = &region
+	start := time.Unix(1000, 0)
+
+	store.RecordSourceQuery(request, "sqs", start, time.Second, []source.Sample{{Value: 3}}, nil)
+	store.RecordSourceQuery(request, "sqs", start.Add(time.Minute), time.Second, nil, errors.New("access denied"))
+
+	key := metriccache.ExternalMetricKey("default", "queue")
+	entries := store.Entries(map[string]interface{}{key: request})
+	if len(entries) != 1 || len(entries[0].SourceQueries) != 2 {
+		t.Fatalf("entries = %+v, want one entry with two source queries", entries)
+	}
+	latest, first := entries[0].SourceQueries[0], entries[0].SourceQueries[1]
+	if latest.Error != "access denied" || len(latest.Samples) != 0 {
+		t.Errorf("latest query = %+v, want the failed query", latest)
+	}
+	if first.Source != "sqs" || first.Region != region || first.Latency != "1s" || first.Samples[0].Value != 3 {
+		t.Errorf("first query = %+v, want the sqs query in %s", first, region)
+	}
+}
+
+func TestForget(t *testing.T) {
+	store := NewStore()
+	request := newExternalMetric("default", "queue")
+	key := metriccache.ExternalMetricKey("default", "queue")
+	store.RecordSourceQuery(request, "cloudwatch", time.Now(), time.Second, nil, nil)
+	store.RecordQuery(request, Query{})
+	store.RecordServed(key, Served{})
+
+	store.Forget(key)
+	if len(store.sourceQueries) != 0 || len(store.queries) != 0 || len(store.served) != 0 {
+		t.Errorf("store = %+v, want what was recorded for the metric dropped", store)
+	}
+}
+
+func TestNilStoreRecordsNothing(t *testing.T) {
+	var store *Store
+	store.RecordQuery(newExternalMetric("default", "queue"), Query{})
+	store.RecordServed("ExternalMetric/default/queue", Served{})
+	store.RecordSourceQuery(newExternalMetric("default", "queue"), "cloudwatch", time.Now(), time.Second, nil, nil)
+	store.Forget("ExternalMetric/default/queue")
+	if store.Now().IsZero() {
+		t.Errorf("Now() of a nil store is zero")
+	}
+}
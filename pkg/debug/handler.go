@@ -0,0 +1,59 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/metriccache"
+)
+
+// Path is the path of the debug endpoint on the secure port of the adapter.
+const Path = "/debug/externalmetrics"
+
+// List is the response of the debug endpoint.
+type List struct {
+	Metrics []Entry `json:"metrics"`
+}
+
+type handler struct {
+	cache *metriccache.MetricCache
+	store *Store
+}
+
+// NewHandler returns the handler of the debug endpoint, listing the metrics of the cache with what
+// the store recorded for them. The namespace and name query parameters filter the metrics by the
+// namespace and name of their object.
+func NewHandler(cache *metriccache.MetricCache, store *Store) http.Handler {
+	return &handler{cache: cache, store: store}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	namespace, namespaceSet := r.URL.Query()["namespace"]
+	name, nameSet := r.URL.Query()["name"]
+
+	list := List{Metrics: []Entry{}}
+	for _, entry := range h.store.Entries(h.cache.ListMetricRequests()) {
+		if namespaceSet && entry.Namespace != namespace[0] {
+			continue
+		}
+		if nameSet && entry.Name != name[0] {
+			continue
+		}
+		list.Metrics = append(list.Metrics, entry)
+	}
+	sort.Slice(list.Metrics, func(i, j int) bool { return list.Metrics[i].Key < list.Metrics[j].Key })
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(list); err != nil {
+		logging.Error(err, "Unable to write debug response")
+	}
+}
@@ -0,0 +1,63 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/metriccache"
+)
+
+func TestHandlerFiltersMetrics(t *testing.T) {
+	cache := metriccache.NewMetricCache()
+	for _, m := range []struct{ namespace, name string }{{"default", "queue"}, {"default", "stream"}, {"jobs", "queue"}} {
+		cache.Update(metriccache.ExternalMetricKey(m.namespace, m.name), m.name, newExternalMetric(m.namespace, m.name))
+	}
+	handler := NewHandler(cache, NewStore())
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"ExternalMetric/default/queue", "ExternalMetric/default/stream", "ExternalMetric/jobs/queue"}},
+		{query: "?namespace=default", want: []string{"ExternalMetric/default/queue", "ExternalMetric/default/stream"}},
+		{query: "?name=queue", want: []string{"ExternalMetric/default/queue", "ExternalMetric/jobs/queue"}},
+		{query: "?namespace=jobs&name=stream", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, Path+tt.query, nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+			}
+
+			var list List
+			if err := json.Unmarshal(recorder.Body.Bytes(), &list); err != nil {
+				t.Fatalf("unable to decode response: %v", err)
+			}
+			keys := []string{}
+			for _, entry := range list.Metrics {
+				keys = append(keys, entry.Key)
+			}
+			if len(keys) != len(tt.want) {
+				t.Fatalf("keys = %v, want %v", keys, tt.want)
+			}
+			for i := range keys {
+				if keys[i] != tt.want[i] {
+					t.Errorf("keys = %v, want %v", keys, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerOnlyServesGet(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	NewHandler(metriccache.NewMetricCache(), NewStore()).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,221 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+)
+
+// Event reasons recorded on metric objects.
+const (
+	// ReasonRegistered is recorded when a metric object is accepted and served.
+	ReasonRegistered = "Registered"
+	// ReasonInvalidSpec is recorded when a metric object fails validation and is not served.
+	ReasonInvalidSpec = "InvalidSpec"
+	// ReasonTemplateFailed is recorded when the templates of a metric object can't be resolved and
+	// it is not served.
+	ReasonTemplateFailed = "TemplateFailed"
+	// ReasonMetricNameConflict is recorded when another object already serves the metric name
+	// claimed by an object.
+	ReasonMetricNameConflict = "MetricNameConflict"
+	// ReasonAccessDenied is recorded when the metric query is not authorized.
+	ReasonAccessDenied = "AccessDenied"
+	// ReasonThrottled is recorded when the metric query is throttled.
+	ReasonThrottled = "Throttled"
+	// ReasonQueryFailed is recorded when the metric query fails for any other reason.
+	ReasonQueryFailed = "QueryFailed"
+	// ReasonNoData is recorded when the metric query succeeds but returns no data points.
+	ReasonNoData = "NoData"
+	// ReasonFallback is recorded when the values served are retrieved by a fallback of the metric
+	// query.
+	ReasonFallback = "Fallback"
+	// ReasonRecovered is recorded when a metric query succeeds after a warning was recorded.
+	ReasonRecovered = "Recovered"
+)
+
+// Event reasons recorded on workloads annotated for autoscaling.
+const (
+	// ReasonGenerated is recorded when an object is created or deleted for the annotations of a
+	// workload.
+	ReasonGenerated = "Generated"
+	// ReasonInvalidAnnotations is recorded when the annotations of a workload are invalid and no
+	// objects are generated for it.
+	ReasonInvalidAnnotations = "InvalidAnnotations"
+	// ReasonGeneratedConflict is recorded when an object which would be generated for a workload
+	// already exists and is not owned by it.
+	ReasonGeneratedConflict = "GeneratedConflict"
+	// ReasonActivated is recorded when a workload is scaled from zero to one replica.
+	ReasonActivated = "Activated"
+	// ReasonDeactivated is recorded when a workload is scaled from one to zero replicas.
+	ReasonDeactivated = "Deactivated"
+)
+
+// Recorder records events on metric objects. It suppresses repeated events so that a metric
+// which keeps failing on every poll does not flood the API server:
+//   - a warning is only recorded again once the interval has passed since the last warning of the
+//     same reason for the object, so a metric alternating between failure reasons records each
+//     reason at most once per interval.
+//   - a normal event is only recorded again when its reason or message differs from the last event
+//     for the object.
+//   - a Recovered event is only recorded once a warning was recorded since the last one, and at most
+//     once per interval, so a metric flapping between failing and succeeding records one pair of
+//     events per interval.
+//
+// Recording can be disabled, such as on the replicas of the adapter which are not the leader.
+type Recorder struct {
+	recorder record.EventRecorder
+	interval time.Duration
+
+	lock     sync.Mutex
+	objects  map[string]*objectEvents
+	disabled bool
+	now      func() time.Time
+}
+
+// objectEvents holds the events recorded for an object.
+type objectEvents struct {
+	last lastEvent
+	// warnings holds when the last warning of each reason was recorded.
+	warnings map[string]time.Time
+	// recovered is when the last Recovered event was recorded.
+	recovered time.Time
+	// failing is set once a warning is recorded, until a Recovered event is recorded.
+	failing bool
+}
+
+type lastEvent struct {
+	eventType string
+	reason    string
+	message   string
+	timestamp time.Time
+}
+
+// NewRecorder creates a Recorder which records events through the given EventRecorder.
+func NewRecorder(recorder record.EventRecorder, interval time.Duration) *Recorder {
+	return &Recorder{
+		recorder: recorder,
+		interval: interval,
+		objects:  make(map[string]*objectEvents),
+		now:      time.Now,
+	}
+}
+
+// SetEnabled enables or disables recording events. Events are dropped while recording is
+// disabled, as if they were recorded by another replica.
+func (r *Recorder) SetEnabled(enabled bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.disabled = !enabled
+}
+
+// Normalf records a normal event on the object.
+func (r *Recorder) Normalf(obj runtime.Object, reason, messageFmt string, args ...interface{}) {
+	key := objectKey(obj)
+	message := fmt.Sprintf(messageFmt, args...)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.disabled {
+		return
+	}
+	events := r.objectEvents(key)
+	if events.last.reason == reason && events.last.message == message {
+		logging.V(4).Info("Suppressing repeated event", "reason", reason, "object", key)
+		return
+	}
+
+	r.record(obj, events, corev1.EventTypeNormal, reason, message)
+}
+
+// Warningf records a warning event on the object.
+func (r *Recorder) Warningf(obj runtime.Object, reason, messageFmt string, args ...interface{}) {
+	key := objectKey(obj)
+	message := fmt.Sprintf(messageFmt, args...)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.disabled {
+		return
+	}
+	events := r.objectEvents(key)
+	if last, found := events.warnings[reason]; found && r.now().Sub(last) < r.interval {
+		logging.V(4).Info("Suppressing repeated event", "reason", reason, "object", key)
+		return
+	}
+
+	r.record(obj, events, corev1.EventTypeWarning, reason, message)
+	events.warnings[reason] = events.last.timestamp
+	events.failing = true
+}
+
+// Recoveredf records a normal Recovered event on the object if a warning was recorded for it since
+// the last Recovered event.
+func (r *Recorder) Recoveredf(obj runtime.Object, messageFmt string, args ...interface{}) {
+	key := objectKey(obj)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	events, exists := r.objects[key]
+	if r.disabled || !exists || !events.failing {
+		return
+	}
+	if !events.recovered.IsZero() && r.now().Sub(events.recovered) < r.interval {
+		logging.V(4).Info("Suppressing repeated event", "reason", ReasonRecovered, "object", key)
+		return
+	}
+
+	r.record(obj, events, corev1.EventTypeNormal, ReasonRecovered, fmt.Sprintf(messageFmt, args...))
+	events.recovered = events.last.timestamp
+	events.failing = false
+}
+
+// Forget drops the state kept for the object, it should be called once the object is deleted.
+func (r *Recorder) Forget(obj runtime.Object) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.objects, objectKey(obj))
+}
+
+// objectEvents returns the events recorded for the object with the given key. It must be called
+// with the lock held.
+func (r *Recorder) objectEvents(key string) *objectEvents {
+	events, exists := r.objects[key]
+	if !exists {
+		events = &objectEvents{warnings: make(map[string]time.Time)}
+		r.objects[key] = events
+	}
+	return events
+}
+
+// record records an event on the object. It is called with the lock held so that concurrent calls
+// decide and record their events in order.
+func (r *Recorder) record(obj runtime.Object, events *objectEvents, eventType, reason, message string) {
+	events.last = lastEvent{
+		eventType: eventType,
+		reason:    reason,
+		message:   message,
+		timestamp: r.now(),
+	}
+	r.recorder.Event(obj, eventType, reason, message)
+}
+
+func objectKey(obj runtime.Object) string {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return fmt.Sprintf("%T", obj)
+	}
+
+	return fmt.Sprintf("%T/%s/%s", obj, accessor.GetNamespace(), accessor.GetName())
+}
@@ -0,0 +1,179 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	api "github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+)
+
+func TestRepeatedWarningsAreSuppressed(t *testing.T) {
+	recorder, fake, clock := newTestRecorder()
+	obj := newExternalMetric("test")
+
+	recorder.Warningf(obj, ReasonThrottled, "request %d throttled", 1)
+	recorder.Warningf(obj, ReasonThrottled, "request %d throttled", 2)
+
+	if got := len(fake.Events); got != 1 {
+		t.Errorf("events = %v, want %v", got, 1)
+	}
+
+	// a different reason is recorded straight away
+	recorder.Warningf(obj, ReasonNoData, "no data")
+
+	if got := len(fake.Events); got != 2 {
+		t.Errorf("events = %v, want %v", got, 2)
+	}
+
+	// the same reason is recorded again once the interval passed
+	*clock = clock.Add(time.Minute)
+	recorder.Warningf(obj, ReasonNoData, "no data")
+
+	if got := len(fake.Events); got != 3 {
+		t.Errorf("events = %v, want %v", got, 3)
+	}
+}
+
+func TestAlternatingWarningsAreSuppressed(t *testing.T) {
+	recorder, fake, clock := newTestRecorder()
+	obj := newExternalMetric("test")
+
+	// a metric alternating between two failure reasons on every poll
+	for i := 0; i < 5; i++ {
+		recorder.Warningf(obj, ReasonThrottled, "throttled")
+		recorder.Warningf(obj, ReasonQueryFailed, "query failed")
+		*clock = clock.Add(time.Second)
+	}
+	if got := len(fake.Events); got != 2 {
+		t.Errorf("events = %v, want one per reason", got)
+	}
+
+	*clock = clock.Add(time.Minute)
+	recorder.Warningf(obj, ReasonThrottled, "throttled")
+	recorder.Warningf(obj, ReasonQueryFailed, "query failed")
+	if got := len(fake.Events); got != 4 {
+		t.Errorf("events = %v after the interval, want %v", got, 4)
+	}
+}
+
+func TestRepeatedNormalEventsAreSuppressed(t *testing.T) {
+	recorder, fake, clock := newTestRecorder()
+	obj := newExternalMetric("test")
+
+	recorder.Normalf(obj, ReasonRegistered, "generation %d", 1)
+	*clock = clock.Add(time.Hour)
+	recorder.Normalf(obj, ReasonRegistered, "generation %d", 1)
+
+	if got := len(fake.Events); got != 1 {
+		t.Errorf("events = %v, want %v", got, 1)
+	}
+
+	recorder.Normalf(obj, ReasonRegistered, "generation %d", 2)
+
+	if got := len(fake.Events); got != 2 {
+		t.Errorf("events = %v, want %v", got, 2)
+	}
+}
+
+func TestRecoveredOnlyAfterWarning(t *testing.T) {
+	recorder, fake, _ := newTestRecorder()
+	obj := newExternalMetric("test")
+	other := newExternalMetric("other")
+
+	recorder.Recoveredf(obj, "recovered")
+
+	if got := len(fake.Events); got != 0 {
+		t.Errorf("events = %v, want %v", got, 0)
+	}
+
+	recorder.Warningf(obj, ReasonAccessDenied, "denied")
+	recorder.Recoveredf(other, "recovered")
+	recorder.Recoveredf(obj, "recovered")
+	recorder.Recoveredf(obj, "recovered")
+
+	if got := len(fake.Events); got != 2 {
+		t.Errorf("events = %v, want %v", got, 2)
+	}
+
+	// the warning is recorded again after the object was forgotten
+	recorder.Forget(obj)
+	recorder.Warningf(obj, ReasonAccessDenied, "denied")
+
+	if got := len(fake.Events); got != 3 {
+		t.Errorf("events = %v, want %v", got, 3)
+	}
+}
+
+func TestFlappingMetricRecordsOnePairPerInterval(t *testing.T) {
+	recorder, fake, clock := newTestRecorder()
+	obj := newExternalMetric("test")
+
+	for i := 0; i < 5; i++ {
+		recorder.Warningf(obj, ReasonNoData, "no data")
+		recorder.Recoveredf(obj, "recovered")
+		*clock = clock.Add(time.Second)
+	}
+
+	if got := len(fake.Events); got != 2 {
+		t.Errorf("events = %v, want %v", got, 2)
+	}
+
+	// a warning of another reason is recorded, but the recovery waits for the interval
+	recorder.Warningf(obj, ReasonThrottled, "throttled")
+	recorder.Recoveredf(obj, "recovered")
+
+	if got := len(fake.Events); got != 3 {
+		t.Errorf("events = %v, want %v", got, 3)
+	}
+
+	*clock = clock.Add(time.Minute)
+	recorder.Recoveredf(obj, "recovered")
+
+	if got := len(fake.Events); got != 4 {
+		t.Errorf("events = %v, want %v", got, 4)
+	}
+}
+
+func TestDisabledRecorderDropsEvents(t *testing.T) {
+	recorder, fake, _ := newTestRecorder()
+	obj := newExternalMetric("test")
+
+	recorder.SetEnabled(false)
+	recorder.Warningf(obj, ReasonNoData, "no data")
+	recorder.Normalf(obj, ReasonRegistered, "registered")
+
+	if got := len(fake.Events); got != 0 {
+		t.Errorf("events = %v, want %v", got, 0)
+	}
+
+	// the events dropped do not suppress the events recorded once enabled
+	recorder.SetEnabled(true)
+	recorder.Warningf(obj, ReasonNoData, "no data")
+	recorder.Normalf(obj, ReasonRegistered, "registered")
+
+	if got := len(fake.Events); got != 2 {
+		t.Errorf("events = %v, want %v", got, 2)
+	}
+}
+
+func newTestRecorder() (*Recorder, *record.FakeRecorder, *time.Time) {
+	fake := record.NewFakeRecorder(10)
+	recorder := NewRecorder(fake, time.Minute)
+
+	clock := time.Unix(0, 0)
+	recorder.now = func() time.Time { return clock }
+
+	return recorder, fake, &clock
+}
+
+func newExternalMetric(name string) *api.ExternalMetric {
+	return &api.ExternalMetric{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: metav1.NamespaceDefault,
+		},
+	}
+}
@@ -0,0 +1,443 @@
+// Package expression evaluates arithmetic expressions over the values of metric queries, such as
+// east + west, locally in the adapter.
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrNoValue is returned when a variable of an expression has no value, such as a query which
+// returned no data. FILL replaces a missing value.
+var ErrNoValue = errors.New("no value")
+
+// functions are the functions an expression can call, with their number of arguments, -1 for one
+// or more.
+var functions = map[string]int{
+	"MIN":  -1,
+	"MAX":  -1,
+	"AVG":  -1,
+	"SUM":  -1,
+	"IF":   3,
+	"FILL": 2,
+}
+
+// Expression is a parsed expression.
+type Expression struct {
+	root node
+}
+
+// node is a node of the syntax tree of an expression.
+type node interface {
+	eval(vars map[string]float64) (float64, error)
+	// variables adds the variables the node references to vars
+	variables(vars map[string]bool)
+}
+
+// Parse parses an expression of numbers, variables, the operators +, -, * and /, the comparisons
+// <, <=, >, >=, == and !=, parentheses and calls of the functions MIN, MAX, AVG, SUM, IF and FILL.
+// Variables are identifiers such as the ID of a query.
+func Parse(s string) (*Expression, error) {
+	p := &parser{input: s}
+	p.next()
+
+	root, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenEnd {
+		return nil, p.errorf("unexpected %q", p.token.text)
+	}
+	return &Expression{root: root}, nil
+}
+
+// Evaluate returns the value of the expression with the values of its variables.
+func (e *Expression) Evaluate(vars map[string]float64) (float64, error) {
+	return e.root.eval(vars)
+}
+
+// Variables returns the sorted names of the variables the expression references.
+func (e *Expression) Variables() []string {
+	set := map[string]bool{}
+	e.root.variables(set)
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type number float64
+
+func (n number) eval(vars map[string]float64) (float64, error) {
+	return float64(n), nil
+}
+
+func (n number) variables(vars map[string]bool) {}
+
+type variable string
+
+func (v variable) eval(vars map[string]float64) (float64, error) {
+	value, found := vars[string(v)]
+	if !found {
+		return 0, fmt.Errorf("%s: %w", string(v), ErrNoValue)
+	}
+	return value, nil
+}
+
+func (v variable) variables(vars map[string]bool) {
+	vars[string(v)] = true
+}
+
+type negation struct {
+	operand node
+}
+
+func (n negation) eval(vars map[string]float64) (float64, error) {
+	value, err := n.operand.eval(vars)
+	return -value, err
+}
+
+func (n negation) variables(vars map[string]bool) {
+	n.operand.variables(vars)
+}
+
+type binary struct {
+	operator    string
+	left, right node
+}
+
+func (b binary) eval(vars map[string]float64) (float64, error) {
+	left, err := b.left.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	right, err := b.right.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+
+	switch b.operator {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return left / right, nil
+	case "<":
+		return truth(left < right), nil
+	case "<=":
+		return truth(left <= right), nil
+	case ">":
+		return truth(left > right), nil
+	case ">=":
+		return truth(left >= right), nil
+	case "==":
+		return truth(left == right), nil
+	default:
+		return truth(left != right), nil
+	}
+}
+
+func (b binary) variables(vars map[string]bool) {
+	b.left.variables(vars)
+	b.right.variables(vars)
+}
+
+// call is a function call. The arguments of IF and FILL are only evaluated when they are used.
+type call struct {
+	function string
+	args     []node
+}
+
+func (c call) eval(vars map[string]float64) (float64, error) {
+	switch c.function {
+	case "IF":
+		condition, err := c.args[0].eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		if condition != 0 {
+			return c.args[1].eval(vars)
+		}
+		return c.args[2].eval(vars)
+
+	case "FILL":
+		value, err := c.args[0].eval(vars)
+		if errors.Is(err, ErrNoValue) {
+			return c.args[1].eval(vars)
+		}
+		return value, err
+	}
+
+	values := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		value, err := arg.eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		values[i] = value
+	}
+
+	result := values[0]
+	for _, value := range values[1:] {
+		switch c.function {
+		case "MIN":
+			if value < result {
+				result = value
+			}
+		case "MAX":
+			if value > result {
+				result = value
+			}
+		default:
+			result += value
+		}
+	}
+	if c.function == "AVG" {
+		result /= float64(len(values))
+	}
+	return result, nil
+}
+
+func (c call) variables(vars map[string]bool) {
+	for _, arg := range c.args {
+		arg.variables(vars)
+	}
+}
+
+// truth converts the result of a comparison to 1 or 0.
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenIdentifier
+	tokenOperator
+	tokenInvalid
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// parser is a recursive descent parser of expressions.
+type parser struct {
+	input string
+	pos   int
+	token token
+}
+
+// next reads the next token of the input.
+func (p *parser) next() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.input) {
+		p.token = token{kind: tokenEnd, pos: start}
+		return
+	}
+
+	c := p.input[p.pos]
+	switch {
+	case isDigit(c) || c == '.':
+		for p.pos < len(p.input) && (isDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		p.token = token{kind: tokenNumber, text: p.input[start:p.pos], pos: start}
+	case isLetter(c):
+		for p.pos < len(p.input) && (isLetter(p.input[p.pos]) || isDigit(p.input[p.pos])) {
+			p.pos++
+		}
+		p.token = token{kind: tokenIdentifier, text: p.input[start:p.pos], pos: start}
+	case strings.IndexByte("<>=!", c) >= 0:
+		p.pos++
+		if p.pos < len(p.input) && p.input[p.pos] == '=' {
+			p.pos++
+		}
+		kind := tokenOperator
+		if text := p.input[start:p.pos]; text == "=" || text == "!" {
+			kind = tokenInvalid
+		}
+		p.token = token{kind: kind, text: p.input[start:p.pos], pos: start}
+	case strings.IndexByte("+-*/(),", c) >= 0:
+		p.pos++
+		p.token = token{kind: tokenOperator, text: string(c), pos: start}
+	default:
+		p.pos++
+		p.token = token{kind: tokenInvalid, text: string(c), pos: start}
+	}
+}
+
+// parseComparison parses a sum, optionally compared to another sum.
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	for _, operator := range []string{"<", "<=", ">", ">=", "==", "!="} {
+		if p.isOperator(operator) {
+			p.next()
+			right, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			return binary{operator: operator, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+// parseSum parses terms separated by + and -.
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+") || p.isOperator("-") {
+		operator := p.token.text
+		p.next()
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseProduct parses factors separated by * and /.
+func (p *parser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*") || p.isOperator("/") {
+		operator := p.token.text
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses a factor, optionally negated.
+func (p *parser) parseUnary() (node, error) {
+	if p.isOperator("-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negation{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses a number, a variable, a function call or an expression in parentheses.
+func (p *parser) parsePrimary() (node, error) {
+	switch t := p.token; {
+	case t.kind == tokenNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", t.text)
+		}
+		p.next()
+		return number(value), nil
+
+	case t.kind == tokenIdentifier:
+		p.next()
+		if p.isOperator("(") {
+			return p.parseCall(t)
+		}
+		return variable(t.text), nil
+
+	case p.isOperator("("):
+		p.next()
+		inner, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOperator(")") {
+			return nil, p.errorf("missing )")
+		}
+		p.next()
+		return inner, nil
+
+	case t.kind == tokenEnd:
+		return nil, p.errorf("unexpected end of expression")
+	default:
+		return nil, p.errorf("unexpected %q", t.text)
+	}
+}
+
+// parseCall parses the arguments of a call of a function, starting at the opening parenthesis.
+func (p *parser) parseCall(name token) (node, error) {
+	function := strings.ToUpper(name.text)
+	arity, found := functions[function]
+	if !found {
+		return nil, fmt.Errorf("at position %d: unknown function %s", name.pos+1, name.text)
+	}
+
+	var args []node
+	p.next()
+	for !p.isOperator(")") {
+		if len(args) > 0 {
+			if !p.isOperator(",") {
+				return nil, p.errorf("missing , or )")
+			}
+			p.next()
+		}
+		arg, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+
+	if (arity < 0 && len(args) == 0) || (arity >= 0 && len(args) != arity) {
+		return nil, fmt.Errorf("at position %d: wrong number of arguments to %s", name.pos+1, function)
+	}
+	return call{function: function, args: args}, nil
+}
+
+func (p *parser) isOperator(text string) bool {
+	return p.token.kind == tokenOperator && p.token.text == text
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at position %d: %s", p.token.pos+1, fmt.Sprintf(format, args...))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
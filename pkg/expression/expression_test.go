@@ -0,0 +1,71 @@
+package expression
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	vars := map[string]float64{"east": 10, "west": 30, "pods_2": 4, "zero": 0}
+	tests := []struct {
+		expression string
+		want       float64
+		wantErr    bool
+	}{
+		{expression: "east + west", want: 40},
+		{expression: "east + west * 2", want: 70},
+		{expression: "(east + west) / pods_2", want: 10},
+		{expression: "-east - -west", want: 20},
+		{expression: "west / 4 - 0.5", want: 7},
+		{expression: "east / zero", wantErr: true},
+		{expression: "north + east", wantErr: true},
+		{expression: "MAX(east, west, pods_2)", want: 30},
+		{expression: "min(east, west) + 1", want: 11},
+		{expression: "AVG(east, west)", want: 20},
+		{expression: "SUM(east, west, -pods_2)", want: 36},
+		{expression: "east < west", want: 1},
+		{expression: "east >= west", want: 0},
+		{expression: "east + 20 == west", want: 1},
+		{expression: "IF(zero > 0, east / zero, east)", want: 10},
+		{expression: "IF(pods_2 != 0, west / pods_2, 0)", want: 7.5},
+		{expression: "FILL(north, 5) * 2", want: 10},
+		{expression: "FILL(east, 5)", want: 10},
+		{expression: "FILL(east / zero, 5)", wantErr: true},
+		{expression: "MAX(east, north)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			e, err := Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := e.Evaluate(vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Evaluate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{"", "east +", "(east", "east west", "east % 2", "1.2.3", ")",
+		"MEDIAN(east)", "MAX()", "IF(east, west)", "FILL(east 1)", "east = west", "east < west < 1"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) error = nil, want an error", s)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	e, err := Parse("west + east * (west - 1)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got, want := e.Variables(), []string{"east", "west"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Variables() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,275 @@
+// Package logging writes structured log lines made of a message and key/value pairs, such as the
+// namespace and name of the metric a line is about.
+//
+// Lines are written through klog in the text format, so the klog flags apply to them:
+//
+//	I1019 10:00:00.000000       1 client.go:190] "Queried CloudWatch" namespace="default" metric="queue" duration="25ms"
+//
+// In the JSON format each line is a JSON object written to stderr, only the verbosity of klog
+// applies to them:
+//
+//	{"ts":"2026-10-19T10:00:00.000Z","level":"info","v":4,"caller":"client.go:190","msg":"Queried CloudWatch","namespace":"default","metric":"queue","duration":"25ms"}
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// The formats of the log lines.
+const (
+	// FormatText writes the lines through klog.
+	FormatText = "text"
+	// FormatJSON writes each line as a JSON object.
+	FormatJSON = "json"
+)
+
+var (
+	jsonFormat int32
+
+	outputLock sync.Mutex
+	output     io.Writer = os.Stderr
+	now                  = time.Now
+	exit                 = os.Exit
+)
+
+// SetFormat sets the format of the following lines, FormatText when empty.
+func SetFormat(format string) error {
+	switch format {
+	case "", FormatText:
+		atomic.StoreInt32(&jsonFormat, 0)
+	case FormatJSON:
+		atomic.StoreInt32(&jsonFormat, 1)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+type severity string
+
+const (
+	severityInfo    severity = "info"
+	severityWarning severity = "warning"
+	severityError   severity = "error"
+)
+
+// Logger writes log lines with the key/value pairs it was created with. The zero Logger has no
+// key/value pairs.
+type Logger struct {
+	values []interface{}
+}
+
+// WithValues returns a Logger adding the key/value pairs to the lines it writes.
+func WithValues(keysAndValues ...interface{}) Logger {
+	return Logger{}.WithValues(keysAndValues...)
+}
+
+// ForMetric returns a Logger adding the namespace and name of a metric object to the lines it
+// writes. A ClusterExternalMetric has no namespace.
+func ForMetric(namespace, name string) Logger {
+	if namespace == "" {
+		return WithValues("metric", name)
+	}
+	return WithValues("namespace", namespace, "metric", name)
+}
+
+// WithValues returns a Logger adding the key/value pairs to the pairs of this Logger.
+func (l Logger) WithValues(keysAndValues ...interface{}) Logger {
+	values := make([]interface{}, 0, len(l.values)+len(keysAndValues))
+	values = append(values, l.values...)
+	return Logger{values: append(values, keysAndValues...)}
+}
+
+// Info writes an informational line, whatever the verbosity.
+func (l Logger) Info(msg string, keysAndValues ...interface{}) {
+	l.write(severityInfo, -1, msg, nil, keysAndValues)
+}
+
+// Warning writes a warning line.
+func (l Logger) Warning(msg string, keysAndValues ...interface{}) {
+	l.write(severityWarning, -1, msg, nil, keysAndValues)
+}
+
+// Error writes an error line with the error under the err key.
+func (l Logger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.write(severityError, -1, msg, err, keysAndValues)
+}
+
+// V returns a Verbose writing informational lines only when the verbosity is at least level.
+func (l Logger) V(level klog.Level) Verbose {
+	return Verbose{logger: l, level: level, enabled: bool(klog.V(level))}
+}
+
+// Info writes an informational line with the key/value pairs.
+func Info(msg string, keysAndValues ...interface{}) {
+	Logger{}.write(severityInfo, -1, msg, nil, keysAndValues)
+}
+
+// Warning writes a warning line with the key/value pairs.
+func Warning(msg string, keysAndValues ...interface{}) {
+	Logger{}.write(severityWarning, -1, msg, nil, keysAndValues)
+}
+
+// Error writes an error line with the error under the err key.
+func Error(err error, msg string, keysAndValues ...interface{}) {
+	Logger{}.write(severityError, -1, msg, err, keysAndValues)
+}
+
+// Fatal writes an error line with the error under the err key, flushes the lines and exits with
+// the exit code of klog.Fatal.
+func Fatal(err error, msg string, keysAndValues ...interface{}) {
+	Logger{}.write(severityError, -1, msg, err, keysAndValues)
+	klog.Flush()
+	exit(255)
+}
+
+// V returns a Verbose writing informational lines only when the verbosity is at least level.
+func V(level klog.Level) Verbose {
+	return Verbose{level: level, enabled: bool(klog.V(level))}
+}
+
+// Verbose writes informational lines when the verbosity is high enough.
+type Verbose struct {
+	logger  Logger
+	level   klog.Level
+	enabled bool
+}
+
+// Enabled returns whether lines are written, to avoid computing expensive values otherwise.
+func (v Verbose) Enabled() bool {
+	return v.enabled
+}
+
+// Info writes an informational line if the verbosity is high enough.
+func (v Verbose) Info(msg string, keysAndValues ...interface{}) {
+	if v.enabled {
+		v.logger.write(severityInfo, v.level, msg, nil, keysAndValues)
+	}
+}
+
+// callerDepth is the number of frames between the caller of a Logger method and write.
+const callerDepth = 2
+
+func (l Logger) write(s severity, level klog.Level, msg string, err error, keysAndValues []interface{}) {
+	values := l.values
+	if len(keysAndValues) > 0 {
+		values = append(append([]interface{}{}, l.values...), keysAndValues...)
+	}
+	if err != nil {
+		values = append([]interface{}{"err", err}, values...)
+	}
+
+	if atomic.LoadInt32(&jsonFormat) == 1 {
+		line := formatJSON(now(), s, level, caller(callerDepth+1), msg, values)
+		outputLock.Lock()
+		output.Write(line)
+		outputLock.Unlock()
+		return
+	}
+
+	line := formatText(msg, values)
+	switch s {
+	case severityError:
+		klog.ErrorDepth(callerDepth, line)
+	case severityWarning:
+		klog.WarningDepth(callerDepth, line)
+	default:
+		klog.InfoDepth(callerDepth, line)
+	}
+}
+
+func caller(depth int) string {
+	_, file, line, ok := runtime.Caller(depth)
+	if !ok {
+		return "???"
+	}
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+}
+
+// formatText returns the message and the key/value pairs as a klog line, with the strings quoted.
+func formatText(msg string, keysAndValues []interface{}) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%q", msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, value := pair(keysAndValues, i)
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		switch v := value.(type) {
+		case string:
+			fmt.Fprintf(&b, "%q", v)
+		default:
+			fmt.Fprintf(&b, "%+v", v)
+		}
+	}
+	return b.String()
+}
+
+// formatJSON returns a line as a JSON object, with the key/value pairs after the message.
+func formatJSON(ts time.Time, s severity, level klog.Level, caller, msg string, keysAndValues []interface{}) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"ts":`)
+	writeJSON(&b, ts.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+	b.WriteString(`,"level":`)
+	writeJSON(&b, string(s))
+	if level >= 0 {
+		fmt.Fprintf(&b, `,"v":%d`, level)
+	}
+	b.WriteString(`,"caller":`)
+	writeJSON(&b, caller)
+	b.WriteString(`,"msg":`)
+	writeJSON(&b, msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, value := pair(keysAndValues, i)
+		b.WriteByte(',')
+		writeJSON(&b, key)
+		b.WriteByte(':')
+		writeJSON(&b, value)
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+func writeJSON(b *bytes.Buffer, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	b.Write(data)
+}
+
+// pair returns the key/value pair at index i, with values rendered for logging: errors,
+// stringers and durations as strings and pointers to strings dereferenced.
+func pair(keysAndValues []interface{}, i int) (string, interface{}) {
+	key := fmt.Sprint(keysAndValues[i])
+	if i+1 >= len(keysAndValues) {
+		return key, "(MISSING)"
+	}
+
+	switch v := keysAndValues[i+1].(type) {
+	case error:
+		return key, v.Error()
+	case *string:
+		if v == nil {
+			return key, nil
+		}
+		return key, *v
+	case time.Duration:
+		return key, v.String()
+	case fmt.Stringer:
+		return key, v.String()
+	default:
+		return key, v
+	}
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestFormatText(t *testing.T) {
+	got := formatText("Queried CloudWatch", []interface{}{
+		"namespace", "default",
+		"region", aws.String("eu-west-1"),
+		"duration", 1500 * time.Millisecond,
+		"queries", 2,
+		"err", fmt.Errorf("throttled"),
+		"odd",
+	})
+	want := `"Queried CloudWatch" namespace="default" region="eu-west-1" duration="1.5s" queries=2 err="throttled" odd="(MISSING)"`
+	if got != want {
+		t.Errorf("formatText() = %s, want %s", got, want)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	ts := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	line := formatJSON(ts, severityInfo, 4, "client.go:190", "Queried CloudWatch", []interface{}{"metric", "queue", "duration", 25 * time.Millisecond})
+
+	want := `{"ts":"2026-10-19T10:00:00.000Z","level":"info","v":4,"caller":"client.go:190","msg":"Queried CloudWatch","metric":"queue","duration":"25ms"}` + "\n"
+	if string(line) != want {
+		t.Errorf("formatJSON() = %s, want %s", line, want)
+	}
+
+	line = formatJSON(ts, severityError, -1, "client.go:190", "Query failed", []interface{}{"err", fmt.Errorf("denied")})
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		t.Fatalf("invalid JSON %s: %v", line, err)
+	}
+	if _, found := decoded["v"]; found || decoded["err"] != "denied" || decoded["level"] != "error" {
+		t.Errorf("formatJSON() = %s, want an error line without verbosity", line)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	var buf bytes.Buffer
+	output = &buf
+	if err := SetFormat(FormatJSON); err != nil {
+		t.Fatalf("SetFormat() error = %v", err)
+	}
+	defer func() {
+		SetFormat(FormatText)
+		output = os.Stderr
+	}()
+
+	ForMetric("default", "queue").WithValues("region", "us-east-1").Error(fmt.Errorf("denied"), "Query failed", "requestID", "1234")
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON %s: %v", buf.String(), err)
+	}
+	for key, want := range map[string]string{"namespace": "default", "metric": "queue", "region": "us-east-1", "requestID": "1234", "err": "denied"} {
+		if decoded[key] != want {
+			t.Errorf("%s = %v, want %s", key, decoded[key], want)
+		}
+	}
+
+	if caller, _ := decoded["caller"].(string); !strings.HasPrefix(caller, "logging_test.go:") {
+		t.Errorf("caller = %s, want the caller of the logger", caller)
+	}
+
+	if err := SetFormat("yaml"); err == nil {
+		t.Errorf("SetFormat() error = nil, want an error for an unknown format")
+	}
+}
+
+func TestFatalExits(t *testing.T) {
+	var buf bytes.Buffer
+	output = &buf
+	var code int
+	exit = func(c int) { code = c }
+	if err := SetFormat(FormatJSON); err != nil {
+		t.Fatalf("SetFormat() error = %v", err)
+	}
+	defer func() {
+		SetFormat(FormatText)
+		output = os.Stderr
+		exit = os.Exit
+	}()
+
+	Fatal(fmt.Errorf("no config"), "Unable to load configuration", "path", "/etc/adapter/config.yaml")
+
+	if code != 255 {
+		t.Errorf("exit code = %d, want 255", code)
+	}
+	if !strings.Contains(buf.String(), `"level":"error"`) || !strings.Contains(buf.String(), `"err":"no config"`) {
+		t.Errorf("line = %s, want an error line", buf.String())
+	}
+}
@@ -0,0 +1,48 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/client/clientset/versioned/scheme"
+)
+
+// Decode reads the ExternalMetric and ClusterExternalMetric objects from a YAML or JSON stream,
+// which may hold several documents separated by "---".
+func Decode(r io.Reader) ([]runtime.Object, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	decoder := scheme.Codecs.UniversalDeserializer()
+
+	var objects []runtime.Object
+	for i := 0; ; i++ {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read document %d", i)
+		}
+
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to decode document %d", i)
+		}
+
+		switch obj.(type) {
+		case *v1alpha1.ExternalMetric, *v1alpha1.ClusterExternalMetric:
+			objects = append(objects, obj)
+		default:
+			return nil, errors.Errorf("document %d is a %s, expected an ExternalMetric or ClusterExternalMetric", i, obj.GetObjectKind().GroupVersionKind().Kind)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+)
+
+func TestDecode(t *testing.T) {
+	objects, err := Decode(strings.NewReader(`
+apiVersion: metrics.aws/v1alpha1
+kind: ExternalMetric
+metadata:
+  name: sqs-length
+  namespace: default
+spec:
+  name: sqs-length
+  queries:
+  - id: sqs_length
+    metricStat:
+      metric:
+        namespace: AWS/SQS
+        metricName: ApproximateNumberOfMessagesVisible
+      period: 60
+      stat: Average
+---
+---
+apiVersion: metrics.aws/v1alpha1
+kind: ClusterExternalMetric
+metadata:
+  name: shared-length
+spec:
+  queries:
+  - id: shared_length
+    expression: "SUM(METRICS())"
+`))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if len(objects) != 2 {
+		t.Fatalf("len(objects) = %v, want %v", len(objects), 2)
+	}
+	if m, ok := objects[0].(*v1alpha1.ExternalMetric); !ok || m.Spec.Queries[0].MetricStat.Period != 60 {
+		t.Errorf("objects[0] = %#v, want an ExternalMetric with period 60", objects[0])
+	}
+	if m, ok := objects[1].(*v1alpha1.ClusterExternalMetric); !ok || m.Spec.Queries[0].Expression != "SUM(METRICS())" {
+		t.Errorf("objects[1] = %#v, want a ClusterExternalMetric with an expression", objects[1])
+	}
+}
+
+func TestDecodeRejectsOtherKinds(t *testing.T) {
+	_, err := Decode(strings.NewReader(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`))
+	if err == nil {
+		t.Errorf("Decode() error = nil, want an error")
+	}
+}
@@ -2,11 +2,13 @@ package metriccache
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
 
-	"k8s.io/klog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // MetricCache holds the loaded metric request info in the system
@@ -14,6 +16,16 @@ type MetricCache struct {
 	metricMutex    sync.RWMutex
 	metricRequests map[string]interface{}
 	metricNames    map[string]string
+
+	// servedMetrics maps the key of a served metric name to the key of the metric request
+	// serving it.
+	servedMetrics map[string]string
+
+	// onDisplaced is called with the key of a metric request which stopped being served because
+	// an older request claimed its metric name.
+	onDisplaced func(key string)
+	// onRemoved is called with the key of a metric request removed from the cache.
+	onRemoved func(key string)
 }
 
 // NewMetricCache creates the cache
@@ -21,16 +33,48 @@ func NewMetricCache() *MetricCache {
 	return &MetricCache{
 		metricRequests: make(map[string]interface{}),
 		metricNames:    make(map[string]string),
+		servedMetrics:  make(map[string]string),
 	}
 }
 
-// Update sets a metric request in the cache
-func (mc *MetricCache) Update(key string, name string, metricRequest interface{}) {
+// OnDisplaced sets the function called with the key of a metric request which stopped being
+// served because another request took over its metric name, so the conflict can be reported.
+func (mc *MetricCache) OnDisplaced(f func(key string)) {
 	mc.metricMutex.Lock()
 	defer mc.metricMutex.Unlock()
 
+	mc.onDisplaced = f
+}
+
+// OnRemoved sets the function called with the key of a metric request removed from the cache, so
+// what is kept for it elsewhere can be dropped.
+func (mc *MetricCache) OnRemoved(f func(key string)) {
+	mc.metricMutex.Lock()
+	defer mc.metricMutex.Unlock()
+
+	mc.onRemoved = f
+}
+
+// Update sets a metric request in the cache, served under the given metric name
+func (mc *MetricCache) Update(key string, name string, metricRequest interface{}) {
+	mc.metricMutex.Lock()
+
+	oldName, exists := mc.metricNames[key]
+
 	mc.metricRequests[key] = metricRequest
 	mc.metricNames[key] = name
+
+	if exists && oldName != name {
+		mc.electServer(servedKey(key, oldName))
+	}
+	displaced := mc.electServer(servedKey(key, name))
+	onDisplaced := mc.onDisplaced
+	mc.metricMutex.Unlock()
+
+	// called without holding the lock, the callback may read the cache
+	if displaced != "" && onDisplaced != nil {
+		onDisplaced(displaced)
+	}
 }
 
 // GetExternalMetric retrieves an external metric request from the cache
@@ -38,35 +82,164 @@ func (mc *MetricCache) GetExternalMetric(namespace, name string) (v1alpha1.Exter
 	mc.metricMutex.RLock()
 	defer mc.metricMutex.RUnlock()
 
-	key := externalMetricKey(namespace, name)
-	metricRequest, exists := mc.metricRequests[key]
+	key := ExternalMetricKey(namespace, name)
+	metricRequest, exists := mc.metricRequests[mc.servedMetrics[key]]
 	if !exists {
-		klog.V(2).Infof("metric not found %s", key)
+		logging.V(2).Info("Metric not found", "key", key)
 		return v1alpha1.ExternalMetric{}, false
 	}
 
 	return metricRequest.(v1alpha1.ExternalMetric), true
 }
 
+// GetClusterExternalMetric retrieves a cluster-scoped external metric request from the cache
+func (mc *MetricCache) GetClusterExternalMetric(name string) (v1alpha1.ClusterExternalMetric, bool) {
+	mc.metricMutex.RLock()
+	defer mc.metricMutex.RUnlock()
+
+	key := ClusterExternalMetricKey(name)
+	metricRequest, exists := mc.metricRequests[mc.servedMetrics[key]]
+	if !exists {
+		logging.V(2).Info("Metric not found", "key", key)
+		return v1alpha1.ClusterExternalMetric{}, false
+	}
+
+	return metricRequest.(v1alpha1.ClusterExternalMetric), true
+}
+
+// GetConflict returns the key of the metric request serving the metric name claimed by the
+// request stored under key, if that is a different request.
+func (mc *MetricCache) GetConflict(key string) (string, bool) {
+	mc.metricMutex.RLock()
+	defer mc.metricMutex.RUnlock()
+
+	name, exists := mc.metricNames[key]
+	if !exists {
+		return "", false
+	}
+
+	servingKey := mc.servedMetrics[servedKey(key, name)]
+	return servingKey, servingKey != key
+}
+
 // Remove removes a metric request from the cache
 func (mc *MetricCache) Remove(key string) {
 	mc.metricMutex.Lock()
-	defer mc.metricMutex.Unlock()
+
+	name, exists := mc.metricNames[key]
 
 	delete(mc.metricRequests, key)
 	delete(mc.metricNames, key)
+
+	if exists {
+		mc.electServer(servedKey(key, name))
+	}
+	onRemoved := mc.onRemoved
+	mc.metricMutex.Unlock()
+
+	// called without holding the lock, the callback may read the cache
+	if onRemoved != nil {
+		onRemoved(key)
+	}
 }
 
 // ListMetricNames retrieves a list of metric names from the cache.
 func (mc *MetricCache) ListMetricNames() []string {
-	keys := make([]string, len(mc.metricNames))
-	for k := range mc.metricNames {
-		keys = append(keys, mc.metricNames[k])
+	mc.metricMutex.RLock()
+	defer mc.metricMutex.RUnlock()
+
+	seen := make(map[string]bool, len(mc.servedMetrics))
+	names := make([]string, 0, len(mc.servedMetrics))
+	for _, key := range mc.servedMetrics {
+		name := mc.metricNames[key]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// ListMetricRequests retrieves the metric requests which are served, keyed by their key in the
+// cache.
+func (mc *MetricCache) ListMetricRequests() map[string]interface{} {
+	mc.metricMutex.RLock()
+	defer mc.metricMutex.RUnlock()
+
+	requests := make(map[string]interface{}, len(mc.servedMetrics))
+	for _, key := range mc.servedMetrics {
+		requests[key] = mc.metricRequests[key]
 	}
 
-	return keys
+	return requests
 }
 
-func externalMetricKey(namespace string, name string) string {
+// electServer picks which of the metric requests claiming the served metric key is used to
+// serve it. The oldest request wins so a newly created duplicate cannot take over a metric
+// which is already in use; ties are broken by key to keep the choice stable. It returns the key
+// of the request which served the metric before if it still claims it but lost.
+func (mc *MetricCache) electServer(served string) string {
+	previous := mc.servedMetrics[served]
+
+	var winner string
+	var winnerCreated metav1.Time
+	for key, name := range mc.metricNames {
+		if servedKey(key, name) != served {
+			continue
+		}
+
+		created := creationTimestamp(mc.metricRequests[key])
+		if winner == "" || created.Before(&winnerCreated) || (created.Equal(&winnerCreated) && key < winner) {
+			winner = key
+			winnerCreated = created
+		}
+	}
+
+	if winner == "" {
+		delete(mc.servedMetrics, served)
+		return ""
+	}
+
+	mc.servedMetrics[served] = winner
+
+	if previous == "" || previous == winner {
+		return ""
+	}
+	if name, exists := mc.metricNames[previous]; !exists || servedKey(previous, name) != served {
+		return ""
+	}
+	return previous
+}
+
+func creationTimestamp(metricRequest interface{}) metav1.Time {
+	switch r := metricRequest.(type) {
+	case v1alpha1.ExternalMetric:
+		return r.CreationTimestamp
+	case v1alpha1.ClusterExternalMetric:
+		return r.CreationTimestamp
+	default:
+		return metav1.Time{}
+	}
+}
+
+// servedKey replaces the object name in a metric request key with the served metric name, so
+// requests of the same kind and namespace claiming the same name share a served key.
+func servedKey(key string, name string) string {
+	i := strings.LastIndex(key, "/")
+	if i < 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s/%s", key[:i], name)
+}
+
+// ExternalMetricKey returns the key of an ExternalMetric in the cache
+func ExternalMetricKey(namespace string, name string) string {
 	return fmt.Sprintf("ExternalMetric/%s/%s", namespace, name)
 }
+
+// ClusterExternalMetricKey returns the key of a ClusterExternalMetric in the cache
+func ClusterExternalMetricKey(name string) string {
+	return fmt.Sprintf("ClusterExternalMetric/%s", name)
+}
@@ -0,0 +1,75 @@
+package metriccache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// MetricValues holds the results of the latest query for a metric request.
+type MetricValues struct {
+	Samples   []source.Sample `json:"samples"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// ValueCache holds the latest values retrieved for each metric request, keyed by the key of the
+// request in the MetricCache.
+type ValueCache struct {
+	valuesMutex sync.RWMutex
+	values      map[string]MetricValues
+	maxAge      time.Duration
+}
+
+// NewValueCache creates the cache, values older than maxAge are not returned.
+func NewValueCache(maxAge time.Duration) *ValueCache {
+	return &ValueCache{
+		values: make(map[string]MetricValues),
+		maxAge: maxAge,
+	}
+}
+
+// Get retrieves the values of a metric request if they are recent enough to be served
+func (vc *ValueCache) Get(key string) (MetricValues, bool) {
+	vc.valuesMutex.RLock()
+	defer vc.valuesMutex.RUnlock()
+
+	values, exists := vc.values[key]
+	if !exists || time.Since(values.Timestamp) > vc.maxAge {
+		return MetricValues{}, false
+	}
+
+	return values, true
+}
+
+// Set stores the values of a metric request
+func (vc *ValueCache) Set(key string, values MetricValues) {
+	vc.valuesMutex.Lock()
+	defer vc.valuesMutex.Unlock()
+
+	vc.values[key] = values
+}
+
+// Replace replaces all the values in the cache.
+func (vc *ValueCache) Replace(values map[string]MetricValues) {
+	vc.valuesMutex.Lock()
+	defer vc.valuesMutex.Unlock()
+
+	vc.values = make(map[string]MetricValues, len(values))
+	for key, v := range values {
+		vc.values[key] = v
+	}
+}
+
+// List returns a copy of all the values in the cache.
+func (vc *ValueCache) List() map[string]MetricValues {
+	vc.valuesMutex.RLock()
+	defer vc.valuesMutex.RUnlock()
+
+	values := make(map[string]MetricValues, len(vc.values))
+	for key, v := range vc.values {
+		values[key] = v
+	}
+
+	return values
+}
@@ -0,0 +1,184 @@
+package metriccache
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	valuesKey = "values.json"
+	shardsKey = "shards"
+
+	// maxShardSize is the size of the values saved to one ConfigMap, below the 1MiB limit of the
+	// objects stored by the API server.
+	maxShardSize = 768 * 1024
+)
+
+// ValueStore shares metric values between replicas of the adapter through ConfigMaps. The leader
+// saves the values it retrieved and the other replicas load them to serve requests. The values are
+// split across as many ConfigMaps as needed to stay below the size limit of an object: the named
+// ConfigMap holds the first shard and the number of shards, the others are suffixed with their
+// index.
+type ValueStore struct {
+	client    corev1client.ConfigMapsGetter
+	namespace string
+	name      string
+	maxSize   int
+}
+
+// NewValueStore creates a store backed by the named ConfigMaps.
+func NewValueStore(client corev1client.ConfigMapsGetter, namespace, name string) *ValueStore {
+	return &ValueStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		maxSize:   maxShardSize,
+	}
+}
+
+// Save writes the values to the ConfigMaps, creating them if needed. The shards are written last
+// to first, so the number of shards in the named ConfigMap never refers to shards not written yet.
+func (s *ValueStore) Save(values map[string]MetricValues) error {
+	shards, err := s.split(values)
+	if err != nil {
+		return err
+	}
+
+	for i := len(shards) - 1; i >= 0; i-- {
+		data := map[string]string{valuesKey: string(shards[i])}
+		if i == 0 {
+			data[shardsKey] = strconv.Itoa(len(shards))
+		}
+		if err := s.save(s.shardName(i), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// split encodes the values into shards of at most the maximum size, unless a single value
+// exceeds it.
+func (s *ValueStore) split(values map[string]MetricValues) ([][]byte, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// an encoded shard is its entries separated by commas between braces
+	const bracesSize = 2
+
+	var shards [][]byte
+	shard := make(map[string]json.RawMessage)
+	size := bracesSize
+	for _, key := range keys {
+		data, err := json.Marshal(values[key])
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to encode metric values")
+		}
+		quotedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to encode metric values")
+		}
+
+		// each entry adds its quoted key, a colon and its values, and a comma after the first
+		entrySize := len(quotedKey) + 1 + len(data)
+		if len(shard) > 0 && size+1+entrySize > s.maxSize {
+			encoded, err := json.Marshal(shard)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to encode metric values")
+			}
+			shards = append(shards, encoded)
+			shard = make(map[string]json.RawMessage)
+			size = bracesSize
+		}
+		if len(shard) > 0 {
+			size++
+		}
+		shard[key] = data
+		size += entrySize
+	}
+
+	encoded, err := json.Marshal(shard)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode metric values")
+	}
+	return append(shards, encoded), nil
+}
+
+// save writes the data to the named ConfigMap, creating it if needed.
+func (s *ValueStore) save(name string, data map[string]string) error {
+	configMaps := s.client.ConfigMaps(s.namespace)
+	cm, err := configMaps.Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: s.namespace,
+			},
+			Data: data,
+		}
+		_, err = configMaps.Create(cm)
+		return errors.Wrap(err, "unable to create metric values ConfigMap")
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to get metric values ConfigMap")
+	}
+
+	cm = cm.DeepCopy()
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	for key, value := range data {
+		cm.Data[key] = value
+	}
+	_, err = configMaps.Update(cm)
+	return errors.Wrap(err, "unable to update metric values ConfigMap")
+}
+
+// Load reads the values from the ConfigMaps.
+func (s *ValueStore) Load() (map[string]MetricValues, error) {
+	values := make(map[string]MetricValues)
+	shards := 1
+	for i := 0; i < shards; i++ {
+		cm, err := s.client.ConfigMaps(s.namespace).Get(s.shardName(i), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) && i == 0 {
+			return values, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to get metric values ConfigMap")
+		}
+
+		if i == 0 {
+			if n, ok := cm.Data[shardsKey]; ok {
+				if shards, err = strconv.Atoi(n); err != nil {
+					return nil, errors.Wrap(err, "unable to decode the number of metric values shards")
+				}
+			}
+		}
+
+		if data, ok := cm.Data[valuesKey]; ok {
+			if err := json.Unmarshal([]byte(data), &values); err != nil {
+				return nil, errors.Wrap(err, "unable to decode metric values")
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// shardName returns the name of the ConfigMap holding the shard with the given index.
+func (s *ValueStore) shardName(i int) string {
+	if i == 0 {
+		return s.name
+	}
+	return fmt.Sprintf("%s-%d", s.name, i)
+}
@@ -0,0 +1,146 @@
+package metriccache
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+func TestValueStoreRoundTrip(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := NewValueStore(client.CoreV1(), "custom-metrics", "values")
+
+	values, err := store.Load()
+	if err != nil {
+		t.Errorf("error loading missing values = %v, want nil", err)
+	}
+	if len(values) != 0 {
+		t.Errorf("values = %v, want none", values)
+	}
+
+	want := map[string]MetricValues{
+		ExternalMetricKey("default", "test"): newMetricValues(42, time.Now()),
+	}
+
+	// save twice to exercise both creating and updating the ConfigMap
+	for i := 0; i < 2; i++ {
+		if err := store.Save(want); err != nil {
+			t.Errorf("error saving values = %v, want nil", err)
+		}
+	}
+
+	values, err = store.Load()
+	if err != nil {
+		t.Errorf("error loading values = %v, want nil", err)
+	}
+
+	got, exists := values[ExternalMetricKey("default", "test")]
+	if !exists {
+		t.Fatalf("exist = %v, want %v", exists, true)
+	}
+
+	if value := got.Samples[0].Value; value != 42 {
+		t.Errorf("value = %v, want %v", value, 42)
+	}
+}
+
+func TestValueStoreSplitsLargeValues(t *testing.T) {
+	timestamp := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	want := make(map[string]MetricValues)
+	for i := 0; i < 4; i++ {
+		want[ExternalMetricKey("default", fmt.Sprintf("test-%d", i))] = newMetricValues(float64(i), timestamp)
+	}
+
+	// every entry has the same size, the quoted key, a colon and the values
+	encoded, err := json.Marshal(map[string]MetricValues{ExternalMetricKey("default", "test-0"): want[ExternalMetricKey("default", "test-0")]})
+	if err != nil {
+		t.Fatalf("error encoding values = %v", err)
+	}
+	entrySize := len(encoded) - 2
+
+	tests := []struct {
+		name       string
+		maxSize    int
+		wantShards int
+	}{
+		// two entries, a comma and the braces fit exactly
+		{name: "two entries per shard", maxSize: 2*entrySize + 3, wantShards: 2},
+		// one byte short of two entries
+		{name: "one entry per shard", maxSize: 2*entrySize + 2, wantShards: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			store := NewValueStore(client.CoreV1(), "custom-metrics", "values")
+			store.maxSize = tt.maxSize
+
+			if err := store.Save(want); err != nil {
+				t.Fatalf("error saving values = %v, want nil", err)
+			}
+
+			configMaps, err := client.CoreV1().ConfigMaps("custom-metrics").List(metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("error listing ConfigMaps = %v, want nil", err)
+			}
+			if len(configMaps.Items) != tt.wantShards {
+				t.Errorf("ConfigMaps = %v, want %v", len(configMaps.Items), tt.wantShards)
+			}
+			for _, cm := range configMaps.Items {
+				if size := len(cm.Data[valuesKey]); size > store.maxSize {
+					t.Errorf("size of %s = %v, want at most %v", cm.Name, size, store.maxSize)
+				}
+			}
+
+			values, err := store.Load()
+			if err != nil {
+				t.Fatalf("error loading values = %v, want nil", err)
+			}
+			if len(values) != len(want) {
+				t.Errorf("values = %v, want %v", len(values), len(want))
+			}
+			for key, value := range want {
+				if got := values[key].Samples[0].Value; got != value.Samples[0].Value {
+					t.Errorf("value of %s = %v, want %v", key, got, value.Samples[0].Value)
+				}
+			}
+		})
+	}
+}
+
+func TestValueCacheDropsStaleValues(t *testing.T) {
+	cache := NewValueCache(time.Minute)
+	cache.Replace(map[string]MetricValues{
+		"fresh": newMetricValues(1, time.Now()),
+		"stale": newMetricValues(2, time.Now().Add(-2*time.Minute)),
+	})
+
+	if _, exists := cache.Get("fresh"); !exists {
+		t.Errorf("fresh exist = %v, want %v", exists, true)
+	}
+
+	if _, exists := cache.Get("stale"); exists {
+		t.Errorf("stale exist = %v, want %v", exists, false)
+	}
+
+	if got := len(cache.List()); got != 2 {
+		t.Errorf("values = %v, want %v", got, 2)
+	}
+}
+
+func newMetricValues(value float64, timestamp time.Time) MetricValues {
+	return MetricValues{
+		Samples: []source.Sample{{
+			Value:     value,
+			Timestamp: timestamp,
+			Labels:    map[string]string{"id": "query"},
+		}},
+		Timestamp: timestamp,
+	}
+}
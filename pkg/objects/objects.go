@@ -0,0 +1,161 @@
+// Package objects reads the Kubernetes objects referenced by metric series, such as the object
+// the templates of a metric are resolved with or the fields of a math expression.
+package objects
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+)
+
+// syncTimeout bounds how long a read waits for the cache of a kind read for the first time.
+const syncTimeout = 10 * time.Second
+
+// supportedKinds are the kinds metric series may reference, which the adapter is allowed to
+// read by its cluster role.
+var supportedKinds = map[schema.GroupKind]bool{
+	{Kind: "ConfigMap"}:                  true,
+	{Group: "apps", Kind: "Deployment"}:  true,
+	{Group: "apps", Kind: "StatefulSet"}: true,
+}
+
+// ValidateKind checks that objects of the API version and kind may be referenced.
+func ValidateKind(apiVersion, kind string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil || apiVersion == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("apiVersion"), apiVersion, "must be an API version such as apps/v1"))
+	}
+	if kind == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("kind"), ""))
+	} else if err == nil && !supportedKinds[gv.WithKind(kind).GroupKind()] {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("kind"), kind, supported()))
+	}
+	return allErrs
+}
+
+func supported() []string {
+	kinds := make([]string, 0, len(supportedKinds))
+	for gk := range supportedKinds {
+		kinds = append(kinds, gk.String())
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Namespace returns the namespace of an object referenced by a metric, which is the namespace of
+// the metric unless the reference sets one. ExternalMetrics may only reference objects in their
+// own namespace, ClusterExternalMetrics, which have no namespace, must set the namespace of the
+// objects they reference.
+func Namespace(metricNamespace, refNamespace string) (string, error) {
+	switch {
+	case refNamespace == "" && metricNamespace == "":
+		return "", fmt.Errorf("a namespace is required to reference an object from a cluster metric")
+	case refNamespace == "":
+		return metricNamespace, nil
+	case metricNamespace != "" && refNamespace != metricNamespace:
+		return "", fmt.Errorf("an ExternalMetric may not reference objects in namespace %s, only in its own namespace %s", refNamespace, metricNamespace)
+	}
+	return refNamespace, nil
+}
+
+// Reader reads the objects referenced by metric series from the caches of shared informers. The
+// informer of a resource is started when an object of the resource is first read.
+type Reader struct {
+	mapper  apimeta.RESTMapper
+	factory dynamicinformer.DynamicSharedInformerFactory
+
+	lock   sync.Mutex
+	stopCh <-chan struct{}
+}
+
+// NewReader returns a Reader watching objects with the client, with informers resynced at the
+// given period.
+func NewReader(client dynamic.Interface, mapper apimeta.RESTMapper, resync time.Duration) *Reader {
+	return &Reader{
+		mapper:  mapper,
+		factory: dynamicinformer.NewDynamicSharedInformerFactory(client, resync),
+	}
+}
+
+// Run runs the informers of the resources read until stopCh is closed.
+func (r *Reader) Run(stopCh <-chan struct{}) {
+	r.lock.Lock()
+	r.stopCh = stopCh
+	r.factory.Start(stopCh)
+	r.lock.Unlock()
+
+	<-stopCh
+}
+
+// Mapping returns the resource of a supported kind.
+func (r *Reader) Mapping(apiVersion, kind string) (*apimeta.RESTMapping, error) {
+	if errs := ValidateKind(apiVersion, kind, field.NewPath("")); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, err
+	}
+	return r.mapper.RESTMapping(gv.WithKind(kind).GroupKind(), gv.Version)
+}
+
+// Informer returns the informer of a resource, which is started if the reader runs.
+func (r *Reader) Informer(resource schema.GroupVersionResource) informers.GenericInformer {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	informer := r.factory.ForResource(resource)
+	// register the informer before starting it, starting the informers already running is a no-op
+	informer.Informer()
+	if r.stopCh != nil {
+		r.factory.Start(r.stopCh)
+	}
+	return informer
+}
+
+// Get returns an object of a resource from the cache of its informer, waiting for the cache to
+// sync when the resource is first read. The namespace is ignored for cluster-scoped resources.
+func (r *Reader) Get(ctx context.Context, mapping *apimeta.RESTMapping, namespace, name string) (*unstructured.Unstructured, error) {
+	informer := r.Informer(mapping.Resource)
+	if !informer.Informer().HasSynced() {
+		logging.V(2).Info("Waiting for the cache of objects referenced by metrics", "resource", mapping.Resource.String())
+		ctx, cancel := context.WithTimeout(ctx, syncTimeout)
+		defer cancel()
+		if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+			return nil, fmt.Errorf("the cache of %s has not synced", mapping.Resource.Resource)
+		}
+	}
+
+	var obj runtime.Object
+	var err error
+	if mapping.Scope.Name() == apimeta.RESTScopeNameNamespace {
+		obj, err = informer.Lister().ByNamespace(namespace).Get(name)
+	} else {
+		obj, err = informer.Lister().Get(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T in the cache of %s", obj, mapping.Resource.Resource)
+	}
+	return u, nil
+}
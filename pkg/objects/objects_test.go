@@ -0,0 +1,59 @@
+package objects
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateKind(t *testing.T) {
+	tests := []struct {
+		apiVersion string
+		kind       string
+		wantErrs   int
+	}{
+		{apiVersion: "apps/v1", kind: "Deployment"},
+		{apiVersion: "apps/v1", kind: "StatefulSet"},
+		{apiVersion: "v1", kind: "ConfigMap"},
+		{apiVersion: "v1", kind: "Secret", wantErrs: 1},
+		{apiVersion: "apps/v1", kind: "DaemonSet", wantErrs: 1},
+		{apiVersion: "apps/v1/beta", kind: "Deployment", wantErrs: 1},
+		{apiVersion: "apps/v1", wantErrs: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.apiVersion+" "+tt.kind, func(t *testing.T) {
+			if errs := ValidateKind(tt.apiVersion, tt.kind, field.NewPath("kubernetes")); len(errs) != tt.wantErrs {
+				t.Errorf("ValidateKind() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	tests := []struct {
+		name            string
+		metricNamespace string
+		refNamespace    string
+		want            string
+		wantErr         bool
+	}{
+		{name: "namespace of the metric", metricNamespace: "default", want: "default"},
+		{name: "same namespace", metricNamespace: "default", refNamespace: "default", want: "default"},
+		{name: "other namespace", metricNamespace: "default", refNamespace: "kube-system", wantErr: true},
+		{name: "cluster metric", refNamespace: "kube-system", want: "kube-system"},
+		{name: "cluster metric without namespace", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Namespace(tt.metricNamespace, tt.refNamespace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Namespace() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Namespace() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
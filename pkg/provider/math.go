@@ -0,0 +1,229 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/expression"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/objects"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/transform"
+)
+
+// mathID is the id label of the sample of a math expression.
+const mathID = "math"
+
+var mathSourceIDRegexp = regexp.MustCompile(`^[a-z][a-zA-Z0-9_]*$`)
+
+// mathSource evaluates math expressions over the values of the queries of the other sources and
+// of fields of Kubernetes objects.
+type mathSource struct {
+	sources *source.Registry
+	objects *objects.Reader
+	now     func() time.Time
+}
+
+// NewMathSource returns a MetricsSource evaluating math expressions, querying the sources of the
+// registry and reading Kubernetes objects with the reader. The reader is optional, without it
+// Kubernetes values can't be read.
+func NewMathSource(sources *source.Registry, reader *objects.Reader) source.MetricsSource {
+	return &mathSource{
+		sources: sources,
+		objects: reader,
+		now:     time.Now,
+	}
+}
+
+func (s *mathSource) Name() string {
+	return "math"
+}
+
+func (s *mathSource) Handles(spec v1alpha1.MetricSeriesSpec) bool {
+	return spec.Math != nil
+}
+
+// Validate checks the expression and the sources of a math query. The queries of the sources are
+// validated by the registry.
+func (s *mathSource) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	mathPath := fldPath.Child("math")
+
+	ids := map[string]bool{}
+	sourcesPath := mathPath.Child("sources")
+	if len(spec.Math.Sources) == 0 {
+		allErrs = append(allErrs, field.Required(sourcesPath, "at least one source is required"))
+	}
+	for i, mathSource := range spec.Math.Sources {
+		sourcePath := sourcesPath.Index(i)
+		switch {
+		case !mathSourceIDRegexp.MatchString(mathSource.ID):
+			allErrs = append(allErrs, field.Invalid(sourcePath.Child("id"), mathSource.ID, "must start with a lowercase letter and contain only letters, numbers and underscores"))
+		case ids[mathSource.ID]:
+			allErrs = append(allErrs, field.Duplicate(sourcePath.Child("id"), mathSource.ID))
+		}
+		ids[mathSource.ID] = true
+
+		hasQuery := source.HasQuery(mathSource.SeriesQuery)
+		switch {
+		case mathSource.Kubernetes != nil && (hasQuery || mathSource.RoleARN != nil || mathSource.Region != nil):
+			allErrs = append(allErrs, field.Forbidden(sourcePath.Child("kubernetes"), "may not be specified with a query, a region or a role"))
+		case mathSource.Kubernetes != nil:
+			allErrs = append(allErrs, validateKubernetesValue(mathSource.Kubernetes, sourcePath.Child("kubernetes"))...)
+		case !hasQuery:
+			allErrs = append(allErrs, field.Required(sourcePath, "a query or a Kubernetes value is required"))
+		}
+	}
+
+	expressionPath := mathPath.Child("expression")
+	e, err := expression.Parse(spec.Math.Expression)
+	if err != nil {
+		return append(allErrs, field.Invalid(expressionPath, spec.Math.Expression, err.Error()))
+	}
+	for _, id := range e.Variables() {
+		if !ids[id] {
+			allErrs = append(allErrs, field.Invalid(expressionPath, spec.Math.Expression, fmt.Sprintf("references %s, which is not the id of a source", id)))
+		}
+	}
+
+	return allErrs
+}
+
+func validateKubernetesValue(k *v1alpha1.KubernetesValue, fldPath *field.Path) field.ErrorList {
+	allErrs := objects.ValidateKind(k.APIVersion, k.Kind, fldPath)
+	if k.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), ""))
+	}
+	if k.FieldPath == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("fieldPath"), ""))
+	} else if strings.HasPrefix(k.FieldPath, ".") || strings.HasSuffix(k.FieldPath, ".") || strings.Contains(k.FieldPath, "..") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("fieldPath"), k.FieldPath, "must be a path of fields separated by dots, such as status.readyReplicas"))
+	}
+	return allErrs
+}
+
+// Query retrieves the values of the sources concurrently and returns the value of the expression
+// with the timestamp of the oldest value. No sample is returned when a value the expression needs
+// has no data.
+func (s *mathSource) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]source.Sample, error) {
+	math := request.Spec.Math
+	e, err := expression.Parse(math.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]*source.Sample, len(math.Sources))
+	errs := make([]error, len(math.Sources))
+
+	var wg sync.WaitGroup
+	for i := range math.Sources {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			samples[i], errs[i] = s.sourceValue(ctx, request, math.Sources[i])
+		}(i)
+	}
+	wg.Wait()
+
+	vars := map[string]float64{}
+	timestamp := s.now()
+	for i, mathSource := range math.Sources {
+		if errs[i] != nil {
+			return nil, errors.Wrapf(errs[i], "source %s", mathSource.ID)
+		}
+		if samples[i] == nil {
+			continue
+		}
+		vars[mathSource.ID] = samples[i].Value
+		if samples[i].Timestamp.Before(timestamp) {
+			timestamp = samples[i].Timestamp
+		}
+	}
+
+	value, err := e.Evaluate(vars)
+	if errors.Is(err, expression.ErrNoValue) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return []source.Sample{{
+		Value:     value,
+		Timestamp: timestamp,
+		Labels:    map[string]string{"id": mathID},
+	}}, nil
+}
+
+// sourceValue returns the value of a source of a math expression, nil when it has no data.
+func (s *mathSource) sourceValue(ctx context.Context, request v1alpha1.ExternalMetric, mathSource v1alpha1.MathSource) (*source.Sample, error) {
+	if mathSource.Kubernetes != nil {
+		return s.kubernetesValue(ctx, request.Namespace, mathSource.Kubernetes)
+	}
+
+	samples, err := s.sources.Query(ctx, source.QueryRequest(request, mathSource.SeriesQuery))
+	if err != nil || len(samples) == 0 {
+		return nil, err
+	}
+	return &samples[0], nil
+}
+
+// kubernetesValue reads a numeric field of a Kubernetes object from the cache of the reader, in
+// the namespace of the metric if the value sets no namespace. Fields may be numbers or quantities
+// such as 500m.
+func (s *mathSource) kubernetesValue(ctx context.Context, namespace string, k *v1alpha1.KubernetesValue) (*source.Sample, error) {
+	if s.objects == nil {
+		return nil, errors.New("no Kubernetes client to read objects with")
+	}
+
+	mapping, err := s.objects.Mapping(k.APIVersion, k.Kind)
+	if err != nil {
+		return nil, err
+	}
+	namespace, err = objects.Namespace(namespace, k.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := s.objects.Get(ctx, mapping, namespace, k.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	value, found, err := fieldValue(obj, k.FieldPath)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &source.Sample{Value: value, Timestamp: s.now()}, nil
+}
+
+// fieldValue returns the value of a numeric field of an object.
+func fieldValue(obj *unstructured.Unstructured, fieldPath string) (float64, bool, error) {
+	v, found, err := unstructured.NestedFieldNoCopy(obj.Object, strings.Split(fieldPath, ".")...)
+	if err != nil || !found {
+		return 0, false, err
+	}
+
+	switch value := v.(type) {
+	case int64:
+		return float64(value), true, nil
+	case float64:
+		return value, true, nil
+	case string:
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return 0, false, errors.Errorf("%s is not a number: %q", fieldPath, value)
+		}
+		return transform.Float64(q), true, nil
+	default:
+		return 0, false, errors.Errorf("%s is not a number: %v", fieldPath, v)
+	}
+}
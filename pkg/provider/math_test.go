@@ -0,0 +1,270 @@
+package provider
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/objects"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// queueSource returns the number of messages of the SQS queues it knows.
+type queueSource struct {
+	messages  map[string]float64
+	timestamp time.Time
+}
+
+func (s *queueSource) Name() string { return "sqs" }
+
+func (s *queueSource) Handles(spec v1alpha1.MetricSeriesSpec) bool { return spec.SQS != nil }
+
+func (s *queueSource) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	if spec.SQS.QueueName == "" {
+		return field.ErrorList{field.Required(fldPath.Child("sqs", "queueName"), "")}
+	}
+	return nil
+}
+
+func (s *queueSource) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]source.Sample, error) {
+	messages, found := s.messages[request.Spec.SQS.QueueName]
+	if !found {
+		return nil, nil
+	}
+	return []source.Sample{{Value: messages, Timestamp: s.timestamp}}, nil
+}
+
+func newTestMathSource(now time.Time, stopCh <-chan struct{}) source.MetricsSource {
+	sources := source.NewRegistry(&queueSource{messages: map[string]float64{"jobs": 100}, timestamp: now.Add(-time.Minute)})
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "worker", "namespace": "default"},
+		"status":     map[string]interface{}{"readyReplicas": int64(4), "ratio": "500m", "share": "0.0005"},
+	}}
+	client := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), deployment)
+
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{{Group: "apps", Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, apimeta.RESTScopeNamespace)
+
+	reader := objects.NewReader(client, mapper, 0)
+	go reader.Run(stopCh)
+
+	s := NewMathSource(sources, reader)
+	s.(*mathSource).now = func() time.Time { return now }
+	sources.Register(s)
+	return s
+}
+
+func TestMathSourceQuery(t *testing.T) {
+	now := time.Now()
+	jobs := v1alpha1.MathSource{ID: "messages", SeriesQuery: v1alpha1.SeriesQuery{SQS: &v1alpha1.SQSQuery{QueueName: "jobs"}}}
+	empty := v1alpha1.MathSource{ID: "messages", SeriesQuery: v1alpha1.SeriesQuery{SQS: &v1alpha1.SQSQuery{QueueName: "empty"}}}
+	deployment := func(id, fieldPath string) v1alpha1.MathSource {
+		return v1alpha1.MathSource{ID: id, Kubernetes: &v1alpha1.KubernetesValue{APIVersion: "apps/v1", Kind: "Deployment", Name: "worker", FieldPath: fieldPath}}
+	}
+	inNamespace := func(mathSource v1alpha1.MathSource, namespace string) v1alpha1.MathSource {
+		k := *mathSource.Kubernetes
+		k.Namespace = namespace
+		mathSource.Kubernetes = &k
+		return mathSource
+	}
+
+	tests := []struct {
+		name       string
+		namespace  string
+		expression string
+		sources    []v1alpha1.MathSource
+		want       []float64
+		wantErr    bool
+	}{
+		{
+			name:       "query and kubernetes values",
+			namespace:  "default",
+			expression: "messages / pods",
+			sources:    []v1alpha1.MathSource{jobs, deployment("pods", "status.readyReplicas")},
+			want:       []float64{25},
+		},
+		{
+			name:       "quantity field",
+			namespace:  "default",
+			expression: "messages * ratio",
+			sources:    []v1alpha1.MathSource{jobs, deployment("ratio", "status.ratio")},
+			want:       []float64{50},
+		},
+		{
+			name:       "quantity field finer than a thousandth",
+			namespace:  "default",
+			expression: "messages * share",
+			sources:    []v1alpha1.MathSource{jobs, deployment("share", "status.share")},
+			want:       []float64{0.05},
+		},
+		{
+			name:       "unset field filled",
+			namespace:  "default",
+			expression: "IF(FILL(pods, 0) > 0, messages / pods, messages)",
+			sources:    []v1alpha1.MathSource{jobs, deployment("pods", "status.availableReplicas")},
+			want:       []float64{100},
+		},
+		{
+			name:       "no data",
+			namespace:  "default",
+			expression: "messages / pods",
+			sources:    []v1alpha1.MathSource{empty, deployment("pods", "status.readyReplicas")},
+		},
+		{
+			name:       "object not found",
+			namespace:  "other",
+			expression: "messages / pods",
+			sources:    []v1alpha1.MathSource{jobs, deployment("pods", "status.readyReplicas")},
+			wantErr:    true,
+		},
+		{
+			name:       "cluster metric without namespace",
+			expression: "messages / pods",
+			sources:    []v1alpha1.MathSource{jobs, deployment("pods", "status.readyReplicas")},
+			wantErr:    true,
+		},
+		{
+			name:       "cluster metric reading another namespace",
+			expression: "messages / pods",
+			sources:    []v1alpha1.MathSource{jobs, inNamespace(deployment("pods", "status.readyReplicas"), "default")},
+			want:       []float64{25},
+		},
+		{
+			name:       "metric reading another namespace",
+			namespace:  "other",
+			expression: "messages / pods",
+			sources:    []v1alpha1.MathSource{jobs, inNamespace(deployment("pods", "status.readyReplicas"), "default")},
+			wantErr:    true,
+		},
+		{
+			name:       "field is not a number",
+			namespace:  "default",
+			expression: "name",
+			sources:    []v1alpha1.MathSource{deployment("name", "metadata.name")},
+			wantErr:    true,
+		},
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestMathSource(now, stopCh)
+			request := v1alpha1.ExternalMetric{
+				ObjectMeta: metav1.ObjectMeta{Name: "jobs-per-pod", Namespace: tt.namespace},
+				Spec:       v1alpha1.MetricSeriesSpec{Math: &v1alpha1.MathQuery{Expression: tt.expression, Sources: tt.sources}},
+			}
+
+			samples, err := s.Query(context.Background(), request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Query() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(samples) != len(tt.want) {
+				t.Fatalf("Query() = %+v, want values %v", samples, tt.want)
+			}
+			for i, sample := range samples {
+				if math.Abs(sample.Value-tt.want[i]) > 1e-9 {
+					t.Errorf("value = %v, want %v", sample.Value, tt.want[i])
+				}
+				if !sample.Timestamp.Equal(now.Add(-time.Minute)) && len(tt.sources) > 1 {
+					t.Errorf("timestamp = %v, want the timestamp of the oldest value", sample.Timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestMathSourceValidate(t *testing.T) {
+	pods := v1alpha1.MathSource{ID: "pods", Kubernetes: &v1alpha1.KubernetesValue{APIVersion: "apps/v1", Kind: "Deployment", Name: "worker", FieldPath: "status.readyReplicas"}}
+	jobs := v1alpha1.MathSource{ID: "messages", SeriesQuery: v1alpha1.SeriesQuery{SQS: &v1alpha1.SQSQuery{QueueName: "jobs"}}}
+	tests := []struct {
+		name     string
+		math     v1alpha1.MathQuery
+		wantErrs int
+	}{
+		{
+			name: "valid",
+			math: v1alpha1.MathQuery{Expression: "MAX(messages / FILL(pods, 1), 1)", Sources: []v1alpha1.MathSource{jobs, pods}},
+		},
+		{
+			name:     "no sources",
+			math:     v1alpha1.MathQuery{Expression: "1"},
+			wantErrs: 1,
+		},
+		{
+			name:     "unknown id",
+			math:     v1alpha1.MathQuery{Expression: "messages / replicas", Sources: []v1alpha1.MathSource{jobs, pods}},
+			wantErrs: 1,
+		},
+		{
+			name:     "invalid expression",
+			math:     v1alpha1.MathQuery{Expression: "messages /", Sources: []v1alpha1.MathSource{jobs}},
+			wantErrs: 1,
+		},
+		{
+			name:     "duplicate and invalid ids",
+			math:     v1alpha1.MathQuery{Expression: "pods", Sources: []v1alpha1.MathSource{pods, pods, {ID: "Pods", Kubernetes: pods.Kubernetes}}},
+			wantErrs: 2,
+		},
+		{
+			name:     "no query",
+			math:     v1alpha1.MathQuery{Expression: "pods", Sources: []v1alpha1.MathSource{{ID: "pods"}}},
+			wantErrs: 1,
+		},
+		{
+			name: "query and kubernetes value",
+			math: v1alpha1.MathQuery{Expression: "pods", Sources: []v1alpha1.MathSource{
+				{ID: "pods", SeriesQuery: jobs.SeriesQuery, Kubernetes: pods.Kubernetes},
+			}},
+			wantErrs: 1,
+		},
+		{
+			name: "invalid kubernetes value",
+			math: v1alpha1.MathQuery{Expression: "pods", Sources: []v1alpha1.MathSource{
+				{ID: "pods", Kubernetes: &v1alpha1.KubernetesValue{APIVersion: "apps/v1/beta", FieldPath: "status..replicas"}},
+			}},
+			wantErrs: 4,
+		},
+		{
+			name: "unsupported kind",
+			math: v1alpha1.MathQuery{Expression: "pods", Sources: []v1alpha1.MathSource{
+				{ID: "pods", Kubernetes: &v1alpha1.KubernetesValue{APIVersion: "v1", Kind: "Secret", Name: "aws-auth", FieldPath: "data.count"}},
+			}},
+			wantErrs: 1,
+		},
+		{
+			name: "invalid query",
+			math: v1alpha1.MathQuery{Expression: "messages", Sources: []v1alpha1.MathSource{
+				{ID: "messages", SeriesQuery: v1alpha1.SeriesQuery{SQS: &v1alpha1.SQSQuery{}}},
+			}},
+			wantErrs: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := source.NewRegistry(&queueSource{})
+			sources.Register(NewMathSource(sources, nil))
+
+			math := tt.math
+			errs := sources.Validate(v1alpha1.MetricSeriesSpec{Math: &math}, field.NewPath("spec"))
+			if len(errs) != tt.wantErrs {
+				t.Errorf("Validate() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
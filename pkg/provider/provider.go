@@ -5,28 +5,47 @@ import (
 
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/client-go/dynamic"
+	corelisters "k8s.io/client-go/listers/core/v1"
 
-	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/aws"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/debug"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
 	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/metriccache"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/smoothing"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
 	"github.com/kubernetes-incubator/custom-metrics-apiserver/pkg/provider"
 )
 
-// cloudwatchProvider is a implementation of provider.MetricsProvider for CloudWatch
+// cloudwatchProvider is a implementation of provider.MetricsProvider for CloudWatch and the other
+// metric sources
 type cloudwatchProvider struct {
-	client    dynamic.Interface
-	mapper    apimeta.RESTMapper
-	cwManager aws.CloudWatchManager
+	client        dynamic.Interface
+	mapper        apimeta.RESTMapper
+	namespaces    corelisters.NamespaceLister
+	metricsSource source.MetricsSource
+	recorder      *events.Recorder
+	debug         *debug.Store
 
 	valuesLock  sync.RWMutex
 	metricCache *metriccache.MetricCache
+	valueCache  *metriccache.ValueCache
+	smoothing   *smoothing.State
 }
 
-// NewCloudWatchProvider returns an instance of cloudwatchProvider
-func NewCloudWatchProvider(client dynamic.Interface, mapper apimeta.RESTMapper, cwManager aws.CloudWatchManager, metricCache *metriccache.MetricCache) provider.ExternalMetricsProvider {
+// NewCloudWatchProvider returns an instance of cloudwatchProvider querying the metrics source. The
+// value cache is optional, when set values refreshed in the background are served instead of
+// querying the source. Values queried are smoothed with the smoothing state. The values served are
+// recorded to the debug store, which is optional. The namespace lister is used to match namespaces
+// against the namespace selectors of cluster metrics.
+func NewCloudWatchProvider(client dynamic.Interface, mapper apimeta.RESTMapper, namespaces corelisters.NamespaceLister, metricsSource source.MetricsSource, metricCache *metriccache.MetricCache, valueCache *metriccache.ValueCache, smoothingState *smoothing.State, recorder *events.Recorder, debugStore *debug.Store) provider.ExternalMetricsProvider {
 	return &cloudwatchProvider{
-		client:      client,
-		mapper:      mapper,
-		cwManager:   cwManager,
-		metricCache: metricCache,
+		client:        client,
+		mapper:        mapper,
+		namespaces:    namespaces,
+		metricsSource: metricsSource,
+		recorder:      recorder,
+		debug:         debugStore,
+		metricCache:   metricCache,
+		valueCache:    valueCache,
+		smoothing:     smoothingState,
 	}
 }
@@ -1,21 +1,31 @@
 package provider
 
 import (
-	"github.com/aws/aws-sdk-go/aws"
+	"context"
+	"time"
+
 	"github.com/kubernetes-incubator/custom-metrics-apiserver/pkg/provider"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/klog"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/metrics/pkg/apis/external_metrics"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/debug"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/metriccache"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/transform"
 )
 
 func (p *cloudwatchProvider) GetExternalMetric(namespace string, metricSelector labels.Selector, info provider.ExternalMetricInfo) (*external_metrics.ExternalMetricValueList, error) {
 	// Note:
 	//		metric name and namespace is used to lookup for the CRD which contains configuration to
 	//		call cloudwatch if not found then ignored and label selector is parsed for all the metrics
-	klog.V(0).Infof("Received request for namespace: %s, metric name: %s, metric selectors: %s", namespace, info.Metric, metricSelector.String())
+	log := logging.WithValues("namespace", namespace, "metric", info.Metric, "selector", metricSelector.String())
+	log.V(4).Info("Received metric request")
 
 	_, selectable := metricSelector.Requirements()
 	if !selectable {
@@ -23,33 +33,166 @@ func (p *cloudwatchProvider) GetExternalMetric(namespace string, metricSelector
 	}
 
 	externalRequest, found := p.metricCache.GetExternalMetric(namespace, info.Metric)
+	key := metriccache.ExternalMetricKey(externalRequest.Namespace, externalRequest.Name)
+	// events are recorded on the object the query came from
+	var eventObject runtime.Object = &externalRequest
+	if !found {
+		// fall back to a cluster-scoped metric shared with this namespace
+		clusterRequest, clusterFound, err := p.getClusterExternalMetric(namespace, info.Metric)
+		if err != nil {
+			log.Error(err, "Unable to look up cluster external metric")
+			return nil, errors.NewInternalError(err)
+		}
+
+		if clusterFound {
+			externalRequest = ToExternalMetric(clusterRequest)
+			key = metriccache.ClusterExternalMetricKey(clusterRequest.Name)
+			eventObject = &clusterRequest
+			found = true
+		}
+	}
 	if !found {
+		log.V(4).Info("No metric query found")
 		return nil, errors.NewBadRequest("no metric query found")
 	}
 
-	metricValue, err := p.cwManager.QueryCloudWatch(externalRequest)
+	log = log.WithValues("key", key)
+	start := p.debug.Now()
+	samples, cached, err := p.getMetricValues(key, externalRequest, eventObject)
 	if err != nil {
-		klog.Errorf("bad request: %v", err)
+		log.Error(err, "Unable to get metric values", "duration", p.debug.Now().Sub(start))
+		p.recordServed(key, start, nil, cached, err)
 		return nil, errors.NewBadRequest(err.Error())
 	}
 
-	var quantity resource.Quantity
-	if len(metricValue) == 0 || len(metricValue[0].Values) == 0 {
-		quantity = *resource.NewMilliQuantity(0, resource.DecimalSI)
-	} else {
-		quantity = *resource.NewQuantity(int64(aws.Float64Value(metricValue[0].Values[0])), resource.DecimalSI)
+	values := metricValues(info.Metric, samples, metricSelector, externalRequest.Spec.Transform)
+	log.V(4).Info("Served metric values", "values", len(values), "cached", cached, "duration", p.debug.Now().Sub(start))
+	p.recordServed(key, start, values, cached, nil)
+	return &external_metrics.ExternalMetricValueList{
+		Items: values,
+	}, nil
+}
+
+// recordServed records the values served for a metric to the debug store.
+func (p *cloudwatchProvider) recordServed(key string, start time.Time, values []external_metrics.ExternalMetricValue, cached bool, err error) {
+	if p.debug == nil {
+		return
+	}
+
+	served := debug.Served{
+		Time:    metav1.NewTime(start),
+		Cached:  cached,
+		Latency: p.debug.Now().Sub(start).String(),
 	}
-	externalMetricValue := external_metrics.ExternalMetricValue{
-		MetricName: info.Metric,
-		Value:      quantity,
-		Timestamp:  metav1.Now(),
+	for _, v := range values {
+		served.Values = append(served.Values, debug.ServedValue{Labels: v.MetricLabels, Value: v.Value.String()})
+	}
+	if err != nil {
+		served.Error = err.Error()
+	}
+	p.debug.RecordServed(key, served)
+}
+
+// metricValues returns the values served for the samples of a query, converted by the transform
+// of the series and labelled with the labels of the samples. When the samples are grouped every
+// sample whose labels match the selector is served, every sample without a selector, the HPA
+// acting on the sum of their values. Otherwise, such as for CloudWatch queries without GROUP BY,
+// the value of the first sample is served and the selector is ignored, as the HPAs of these
+// metrics may set a selector which the adapter never applied.
+func metricValues(metricName string, samples []source.Sample, selector labels.Selector, t *v1alpha1.ValueTransform) []external_metrics.ExternalMetricValue {
+	now := metav1.Now()
+	if !grouped(samples) {
+		value := external_metrics.ExternalMetricValue{
+			MetricName: metricName,
+			Value:      MetricQuantity(samples, t),
+			Timestamp:  now,
+		}
+		if len(samples) > 0 {
+			value.MetricLabels = samples[0].Labels
+		}
+		return []external_metrics.ExternalMetricValue{value}
 	}
 
-	matchingMetrics := []external_metrics.ExternalMetricValue{externalMetricValue}
+	values := []external_metrics.ExternalMetricValue{}
+	for _, sample := range samples {
+		if !selector.Matches(labels.Set(sample.Labels)) {
+			continue
+		}
+		values = append(values, external_metrics.ExternalMetricValue{
+			MetricName:   metricName,
+			MetricLabels: sample.Labels,
+			Value:        transform.Quantity(t, transform.Apply(t, sample.Value)),
+			Timestamp:    now,
+		})
+	}
+	return values
+}
 
-	return &external_metrics.ExternalMetricValueList{
-		Items: matchingMetrics,
-	}, nil
+// grouped returns true if a sample is labelled with more than the id and label of the CloudWatch
+// query it was returned by.
+func grouped(samples []source.Sample) bool {
+	for _, sample := range samples {
+		for name := range sample.Labels {
+			if name != "id" && name != "label" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MetricQuantity returns the value reported to the HPA for the samples of a query, which is the
+// value of the first sample converted by the transform of the series, or zero when there is no
+// data.
+func MetricQuantity(samples []source.Sample, t *v1alpha1.ValueTransform) resource.Quantity {
+	if len(samples) == 0 {
+		return *resource.NewMilliQuantity(0, resource.DecimalSI)
+	}
+
+	return transform.Quantity(t, transform.Apply(t, samples[0].Value))
+}
+
+// getMetricValues returns the values of a metric request, from the value cache if they were
+// refreshed recently or by querying the metrics source otherwise, and whether they were cached.
+func (p *cloudwatchProvider) getMetricValues(key string, request v1alpha1.ExternalMetric, eventObject runtime.Object) ([]source.Sample, bool, error) {
+	if p.valueCache != nil {
+		if values, found := p.valueCache.Get(key); found {
+			logging.V(5).Info("Serving cached values", "key", key, "timestamp", values.Timestamp)
+			return values.Samples, true, nil
+		}
+	}
+
+	// the provider is not given the context of the HPA request
+	samples, err := queryMetric(context.Background(), p.metricsSource, p.smoothing, p.recorder, key, request, eventObject)
+	return samples, false, err
+}
+
+// getClusterExternalMetric looks up a ClusterExternalMetric by name and returns it if its
+// namespace selector allows the given namespace to use it.
+func (p *cloudwatchProvider) getClusterExternalMetric(namespace, name string) (v1alpha1.ClusterExternalMetric, bool, error) {
+	clusterRequest, found := p.metricCache.GetClusterExternalMetric(name)
+	if !found {
+		return v1alpha1.ClusterExternalMetric{}, false, nil
+	}
+
+	if clusterRequest.Spec.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(clusterRequest.Spec.NamespaceSelector)
+		if err != nil {
+			return v1alpha1.ClusterExternalMetric{}, false, err
+		}
+
+		ns, err := p.namespaces.Get(namespace)
+		if err != nil {
+			return v1alpha1.ClusterExternalMetric{}, false, err
+		}
+
+		if !selector.Matches(labels.Set(ns.Labels)) {
+			logging.V(2).Info("Namespace is not allowed to use cluster metric", "namespace", namespace, "metric", name)
+			return v1alpha1.ClusterExternalMetric{}, false, nil
+		}
+	}
+
+	return clusterRequest, true, nil
 }
 
 func (p *cloudwatchProvider) ListAllExternalMetrics() []provider.ExternalMetricInfo {
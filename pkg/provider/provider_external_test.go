@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+func TestMetricValues(t *testing.T) {
+	now := time.Now()
+	samples := []source.Sample{
+		{Value: 10, Timestamp: now, Labels: map[string]string{"LoadBalancer": "web"}},
+		{Value: 20.5, Timestamp: now, Labels: map[string]string{"LoadBalancer": "api"}},
+	}
+
+	values := metricValues("requests", samples, labels.Everything(), nil)
+	if len(values) != 2 || values[0].Value.Value() != 10 || values[0].MetricLabels["LoadBalancer"] != "web" ||
+		values[1].Value.Value() != 20 || values[1].MetricLabels["LoadBalancer"] != "api" {
+		t.Errorf("values without a selector = %+v, want every group", values)
+	}
+
+	values = metricValues("requests", samples, labels.SelectorFromSet(labels.Set{"LoadBalancer": "api"}), nil)
+	if len(values) != 1 || values[0].Value.Value() != 20 || values[0].MetricLabels["LoadBalancer"] != "api" {
+		t.Errorf("values with a selector = %+v, want the api sample", values)
+	}
+
+	values = metricValues("requests", samples, labels.SelectorFromSet(labels.Set{"LoadBalancer": "none"}), nil)
+	if len(values) != 0 {
+		t.Errorf("values with a selector matching nothing = %+v, want none", values)
+	}
+
+	ungrouped := []source.Sample{
+		{Value: 10, Timestamp: now, Labels: map[string]string{"id": "requests", "label": "RequestCount"}},
+	}
+	values = metricValues("requests", ungrouped, labels.SelectorFromSet(labels.Set{"LoadBalancer": "api"}), nil)
+	if len(values) != 1 || values[0].Value.Value() != 10 {
+		t.Errorf("values of ungrouped samples with a selector = %+v, want the first sample", values)
+	}
+
+	ungrouped = append(ungrouped, source.Sample{Value: 30, Timestamp: now, Labels: map[string]string{"id": "errors", "label": "ErrorCount"}})
+	values = metricValues("requests", ungrouped, labels.Everything(), nil)
+	if len(values) != 1 || values[0].Value.Value() != 10 {
+		t.Errorf("values of ungrouped samples without a selector = %+v, want the first sample", values)
+	}
+
+	scale := resource.MustParse("0.1")
+	values = metricValues("requests", samples, labels.Everything(), &v1alpha1.ValueTransform{Scale: &scale})
+	if len(values) != 2 || values[0].Value.String() != "1" || values[1].Value.String() != "2050m" {
+		t.Errorf("transformed values = %+v, want every group scaled", values)
+	}
+}
@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/smoothing"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// queryMetric queries the metrics source for a metric request and records events describing the
+// outcome on the object the request came from. When the query fails or returns no data, the
+// fallbacks of the request are queried. The samples are smoothed with the state kept for the
+// metric cache key of the request.
+func queryMetric(ctx context.Context, metricsSource source.MetricsSource, state *smoothing.State, recorder *events.Recorder, key string, metricRequest v1alpha1.ExternalMetric, eventObject runtime.Object) ([]source.Sample, error) {
+	samples, err := metricsSource.Query(ctx, metricRequest)
+	if (err != nil || len(samples) == 0) && len(metricRequest.Spec.Fallbacks) > 0 {
+		if fallbackSamples, found := queryFallbacks(ctx, metricsSource, recorder, metricRequest, eventObject, err); found {
+			return smoothSamples(state, key, metricRequest.Spec, fallbackSamples), nil
+		}
+	}
+
+	if err != nil {
+		recordQueryError(recorder, eventObject, err)
+		return samples, err
+	}
+
+	if len(samples) == 0 {
+		recorder.Warningf(eventObject, events.ReasonNoData, "The metric source returned no data points, reporting 0")
+	} else {
+		recorder.Recoveredf(eventObject, "Retrieved data points from the metric source")
+	}
+
+	return smoothSamples(state, key, metricRequest.Spec, samples), nil
+}
+
+// queryFallbacks queries the fallbacks of a metric request in order, and returns the samples of
+// the first fallback returning data with the fallback as their source.
+func queryFallbacks(ctx context.Context, metricsSource source.MetricsSource, recorder *events.Recorder, metricRequest v1alpha1.ExternalMetric, eventObject runtime.Object, queryErr error) ([]source.Sample, bool) {
+	cause := "returned no data points"
+	if queryErr != nil {
+		cause = fmt.Sprintf("failed: %v", queryErr)
+	}
+
+	for i := range metricRequest.Spec.Fallbacks {
+		name := source.FallbackName(i)
+		samples, err := metricsSource.Query(ctx, source.FallbackRequest(metricRequest, i))
+		if err != nil {
+			logging.ForMetric(metricRequest.Namespace, metricRequest.Name).Warning("Fallback query failed", "fallback", name, "err", err)
+			continue
+		}
+		if len(samples) == 0 {
+			continue
+		}
+
+		for j := range samples {
+			samples[j].Source = name
+		}
+		recorder.Warningf(eventObject, events.ReasonFallback, "The metric query %s, serving the values of %s", cause, name)
+		return samples, true
+	}
+	return nil, false
+}
+
+// smoothSamples smooths and guards the samples of a metric request with the state kept for each
+// of its series, keeping the value returned by the source as the raw value of the samples.
+func smoothSamples(state *smoothing.State, key string, spec v1alpha1.MetricSeriesSpec, samples []source.Sample) []source.Sample {
+	if state == nil || (spec.Smoothing == nil && spec.Guard == nil) {
+		return samples
+	}
+
+	for i := range samples {
+		raw := samples[i].Value
+		id := key + "{" + labels.Set(samples[i].Labels).String() + "}"
+		samples[i].Raw = &raw
+		samples[i].Value = state.Update(id, spec.Smoothing, spec.Guard, raw, samples[i].Timestamp)
+		logging.V(5).Info("Smoothed metric value", "series", id, "value", samples[i].Value, "raw", raw)
+	}
+	return samples
+}
+
+// recordQueryError records a warning event on the metric object describing why the query failed.
+func recordQueryError(recorder *events.Recorder, obj runtime.Object, err error) {
+	reason := events.ReasonQueryFailed
+	if aerr, ok := errors.Cause(err).(awserr.Error); ok {
+		switch aerr.Code() {
+		case "AccessDenied", "AccessDeniedException":
+			reason = events.ReasonAccessDenied
+		}
+	}
+	if request.IsErrorThrottle(errors.Cause(err)) {
+		reason = events.ReasonThrottled
+	}
+
+	recorder.Warningf(obj, reason, "Unable to query the metric source: %v", err)
+}
+
+// ToExternalMetric returns the metric request of a ClusterExternalMetric as an ExternalMetric.
+func ToExternalMetric(clusterRequest v1alpha1.ClusterExternalMetric) v1alpha1.ExternalMetric {
+	return v1alpha1.ExternalMetric{
+		TypeMeta:   clusterRequest.TypeMeta,
+		ObjectMeta: clusterRequest.ObjectMeta,
+		Spec:       clusterRequest.Spec.MetricSeriesSpec,
+	}
+}
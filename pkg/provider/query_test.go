@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/smoothing"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+func TestSmoothSamples(t *testing.T) {
+	state := smoothing.NewState()
+	spec := v1alpha1.MetricSeriesSpec{Smoothing: &v1alpha1.Smoothing{Method: smoothing.EWMA}}
+
+	smoothSamples(state, "default/queue", spec, []source.Sample{{Value: 10, Labels: map[string]string{"queue": "a"}}})
+	samples := smoothSamples(state, "default/queue", spec, []source.Sample{
+		{Value: 20, Labels: map[string]string{"queue": "a"}},
+		{Value: 5, Labels: map[string]string{"queue": "b"}},
+	})
+
+	if samples[0].Value != 15 || samples[0].Raw == nil || *samples[0].Raw != 20 {
+		t.Errorf("sample = %+v, want a smoothed value of 15 and a raw value of 20", samples[0])
+	}
+	if samples[1].Value != 5 {
+		t.Errorf("sample = %+v, want the first value of series b", samples[1])
+	}
+
+	samples = smoothSamples(state, "default/other", v1alpha1.MetricSeriesSpec{}, []source.Sample{{Value: 3}})
+	if samples[0].Value != 3 || samples[0].Raw != nil {
+		t.Errorf("sample = %+v, want the value of a series without smoothing unchanged", samples[0])
+	}
+}
+
+// regionalSource returns a sample in the regions which are available.
+type regionalSource struct {
+	available map[string]bool
+}
+
+func (s *regionalSource) Name() string { return "regional" }
+
+func (s *regionalSource) Handles(spec v1alpha1.MetricSeriesSpec) bool { return true }
+
+func (s *regionalSource) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	return nil
+}
+
+func (s *regionalSource) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]source.Sample, error) {
+	region := aws.StringValue(request.Spec.Region)
+	if !s.available[region] {
+		return nil, fmt.Errorf("%s is unavailable", region)
+	}
+	return []source.Sample{{Value: 1, Labels: map[string]string{"region": region}}}, nil
+}
+
+func TestQueryMetricFallsBack(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	recorder := events.NewRecorder(fakeRecorder, time.Minute)
+	request := v1alpha1.ExternalMetric{
+		ObjectMeta: metav1.ObjectMeta{Name: "queue", Namespace: "default"},
+		Spec: v1alpha1.MetricSeriesSpec{
+			Region: aws.String("us-east-1"),
+			Fallbacks: []v1alpha1.SeriesQuery{
+				{Region: aws.String("eu-west-1")},
+				{Region: aws.String("us-west-2")},
+			},
+		},
+	}
+	metricsSource := &regionalSource{available: map[string]bool{"us-west-2": true}}
+
+	samples, err := queryMetric(context.Background(), metricsSource, nil, recorder, "default/queue", request, &request)
+	if err != nil {
+		t.Fatalf("queryMetric() error = %v", err)
+	}
+	if len(samples) != 1 || samples[0].Labels["region"] != "us-west-2" || samples[0].Source != "fallbacks[1]" {
+		t.Errorf("samples = %+v, want the sample of fallbacks[1]", samples)
+	}
+	if event := <-fakeRecorder.Events; !strings.Contains(event, events.ReasonFallback) || !strings.Contains(event, "us-east-1 is unavailable") {
+		t.Errorf("event = %q, want a Fallback event with the error of the query", event)
+	}
+
+	metricsSource.available = map[string]bool{}
+	if _, err := queryMetric(context.Background(), metricsSource, nil, recorder, "default/queue", request, &request); err == nil {
+		t.Errorf("queryMetric() error = nil, want the error of the query when every fallback fails")
+	}
+}
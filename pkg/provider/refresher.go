@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/events"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/metriccache"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/smoothing"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/source"
+)
+
+// Refresher periodically queries the metrics source for every served metric request and stores
+// the samples in the value cache, so the provider can answer requests without querying the source.
+//
+// When several replicas of the adapter run, only the leader refreshes the values and saves them
+// to the value store, the other replicas follow by loading them from the store.
+type Refresher struct {
+	metricsSource source.MetricsSource
+	metricCache   *metriccache.MetricCache
+	valueCache    *metriccache.ValueCache
+	valueStore    *metriccache.ValueStore
+	smoothing     *smoothing.State
+	recorder      *events.Recorder
+	interval      time.Duration
+}
+
+// NewRefresher returns a Refresher refreshing values at the given interval. The value store is
+// optional and only needed when values are shared between replicas. Values are smoothed with the
+// smoothing state, shared with the provider.
+func NewRefresher(metricsSource source.MetricsSource, metricCache *metriccache.MetricCache, valueCache *metriccache.ValueCache, valueStore *metriccache.ValueStore, smoothingState *smoothing.State, recorder *events.Recorder, interval time.Duration) *Refresher {
+	return &Refresher{
+		metricsSource: metricsSource,
+		metricCache:   metricCache,
+		valueCache:    valueCache,
+		valueStore:    valueStore,
+		smoothing:     smoothingState,
+		recorder:      recorder,
+		interval:      interval,
+	}
+}
+
+// Run refreshes the values until the context is done, which cancels the queries in flight.
+func (r *Refresher) Run(ctx context.Context) {
+	logging.Info("Refreshing metric values", "interval", r.interval)
+	wait.UntilWithContext(ctx, r.refresh, r.interval)
+	logging.Info("Stopped refreshing metric values")
+}
+
+// Follow loads the values saved by the leader until stopCh is closed. Nothing is loaded while
+// isLeader returns true.
+func (r *Refresher) Follow(isLeader func() bool, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if isLeader() || r.valueStore == nil {
+			return
+		}
+
+		values, err := r.valueStore.Load()
+		if err != nil {
+			logging.Error(err, "Unable to load metric values")
+			return
+		}
+
+		logging.V(4).Info("Loaded metric values", "values", len(values))
+		r.valueCache.Replace(values)
+	}, r.interval, stopCh)
+}
+
+func (r *Refresher) refresh(ctx context.Context) {
+	start := time.Now()
+	requests := r.metricCache.ListMetricRequests()
+	values := make(map[string]metriccache.MetricValues, len(requests))
+	for key, request := range requests {
+		var externalRequest v1alpha1.ExternalMetric
+		var eventObject runtime.Object
+		switch req := request.(type) {
+		case v1alpha1.ExternalMetric:
+			externalRequest = req
+			eventObject = &req
+		case v1alpha1.ClusterExternalMetric:
+			externalRequest = ToExternalMetric(req)
+			eventObject = &req
+		default:
+			continue
+		}
+
+		samples, err := queryMetric(ctx, r.metricsSource, r.smoothing, r.recorder, key, externalRequest, eventObject)
+		if err != nil {
+			logging.Error(err, "Unable to refresh metric values", "key", key)
+			continue
+		}
+
+		values[key] = metriccache.MetricValues{
+			Samples:   samples,
+			Timestamp: time.Now(),
+		}
+	}
+
+	logging.V(4).Info("Refreshed metric values", "refreshed", len(values), "metrics", len(requests), "duration", time.Since(start))
+	r.valueCache.Replace(values)
+
+	if r.valueStore != nil {
+		if err := r.valueStore.Save(values); err != nil {
+			logging.Error(err, "Unable to save metric values")
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package smoothing smooths and guards the values of metric series over the successive queries of
+// the metric source.
+package smoothing
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/transform"
+)
+
+// The smoothing methods.
+const (
+	EWMA         = "EWMA"
+	MovingMedian = "MovingMedian"
+)
+
+const (
+	defaultAlpha  = 0.5
+	defaultWindow = 3
+	// maxWindow bounds the values kept for a moving median.
+	maxWindow = 100
+	// maxIdle is how long the state of a series which is no longer updated is kept.
+	maxIdle = time.Hour
+)
+
+// series is the state of a series between queries.
+type series struct {
+	// accepted is true once a value of the series was accepted
+	accepted bool
+	// previous is the last accepted value, the guard compares new values against it
+	previous float64
+	// pending is a value held back by the guard until the next value confirms it
+	pending    float64
+	hasPending bool
+	// values are the last accepted values, for a moving median
+	values []float64
+	// average is the exponentially weighted moving average of the accepted values
+	average float64
+	// served is the last value returned
+	served float64
+	// timestamp is the timestamp of the last value recorded
+	timestamp time.Time
+	updated   time.Time
+}
+
+// State holds the state of the smoothed and guarded series, identified by the metric cache key
+// of their metric and their labels.
+type State struct {
+	lock      sync.Mutex
+	series    map[string]*series
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewState returns an empty State.
+func NewState() *State {
+	return &State{
+		series: map[string]*series{},
+		now:    time.Now,
+	}
+}
+
+// Update records a new value of a series and returns the value to serve, which is the value
+// smoothed over the previous values of the series. A value held back by the guard is not
+// recorded, the previously served value is returned instead. A value whose timestamp is not newer
+// than the last value recorded, such as the same data point returned by another query, is not
+// recorded either, so that the series advances once per data point however often it is queried.
+func (s *State) Update(id string, smoothing *v1alpha1.Smoothing, guard *v1alpha1.Guard, value float64, timestamp time.Time) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	s.prune(now)
+
+	ser, found := s.series[id]
+	if !found {
+		ser = &series{}
+		s.series[id] = ser
+	}
+	ser.updated = now
+
+	if found && !timestamp.IsZero() && !timestamp.After(ser.timestamp) {
+		return ser.served
+	}
+	ser.timestamp = timestamp
+
+	if ser.accepted && guard != nil && exceeds(ser.previous, value, guard.MaxChangePercent) {
+		confirmed := ser.hasPending && sameDirection(ser.pending-ser.previous, value-ser.previous)
+		if !confirmed {
+			ser.pending, ser.hasPending = value, true
+			return ser.served
+		}
+	}
+
+	first := !ser.accepted
+	ser.accepted, ser.previous, ser.hasPending = true, value, false
+	ser.served = smooth(ser, smoothing, value, first)
+	return ser.served
+}
+
+// prune removes the series which were not updated recently, such as the series of deleted
+// metrics.
+func (s *State) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < maxIdle {
+		return
+	}
+	s.lastPrune = now
+
+	for id, ser := range s.series {
+		if now.Sub(ser.updated) > maxIdle {
+			delete(s.series, id)
+		}
+	}
+}
+
+// smooth records an accepted value and returns the smoothed value of the series.
+func smooth(ser *series, smoothing *v1alpha1.Smoothing, value float64, first bool) float64 {
+	if smoothing == nil {
+		return value
+	}
+
+	switch smoothing.Method {
+	case EWMA:
+		alpha := defaultAlpha
+		if smoothing.Alpha != nil {
+			alpha = transform.Float64(*smoothing.Alpha)
+		}
+		if first {
+			ser.average = value
+		} else {
+			ser.average = alpha*value + (1-alpha)*ser.average
+		}
+		return ser.average
+
+	case MovingMedian:
+		window := defaultWindow
+		if smoothing.Window > 0 {
+			window = int(smoothing.Window)
+		}
+		ser.values = append(ser.values, value)
+		if len(ser.values) > window {
+			ser.values = ser.values[len(ser.values)-window:]
+		}
+		return median(ser.values)
+	}
+	return value
+}
+
+// exceeds returns true if value changes from previous by more than maxChangePercent. Any change
+// from zero exceeds the guard.
+func exceeds(previous, value float64, maxChangePercent int32) bool {
+	if previous == 0 {
+		return value != 0
+	}
+	return math.Abs(value-previous)/math.Abs(previous)*100 > float64(maxChangePercent)
+}
+
+func sameDirection(a, b float64) bool {
+	return (a > 0 && b > 0) || (a < 0 && b < 0)
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// Validate checks the smoothing and guard of a metric series.
+func Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if smoothing := spec.Smoothing; smoothing != nil {
+		smoothingPath := fldPath.Child("smoothing")
+		switch smoothing.Method {
+		case EWMA:
+			if smoothing.Window != 0 {
+				allErrs = append(allErrs, field.Forbidden(smoothingPath.Child("window"), "only supported for MovingMedian"))
+			}
+			if a := smoothing.Alpha; a != nil && (a.Sign() <= 0 || a.Cmp(*resource.NewQuantity(1, resource.DecimalSI)) > 0) {
+				allErrs = append(allErrs, field.Invalid(smoothingPath.Child("alpha"), a.String(), "must be greater than 0 and at most 1"))
+			}
+		case MovingMedian:
+			if smoothing.Alpha != nil {
+				allErrs = append(allErrs, field.Forbidden(smoothingPath.Child("alpha"), "only supported for EWMA"))
+			}
+			if smoothing.Window < 0 || smoothing.Window > maxWindow {
+				allErrs = append(allErrs, field.Invalid(smoothingPath.Child("window"), smoothing.Window, "must be between 1 and 100"))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(smoothingPath.Child("method"), smoothing.Method, []string{EWMA, MovingMedian}))
+		}
+	}
+
+	if spec.Guard != nil && spec.Guard.MaxChangePercent <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("guard", "maxChangePercent"), spec.Guard.MaxChangePercent, "must be greater than zero"))
+	}
+
+	return allErrs
+}
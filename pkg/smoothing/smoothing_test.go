@@ -0,0 +1,178 @@
+package smoothing
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+)
+
+func TestUpdate(t *testing.T) {
+	alpha := resource.MustParse("0.25")
+	fineAlpha := resource.MustParse("0.0001")
+	tests := []struct {
+		name      string
+		smoothing *v1alpha1.Smoothing
+		guard     *v1alpha1.Guard
+		values    []float64
+		want      []float64
+	}{
+		{
+			name:   "no smoothing",
+			values: []float64{1, 100, 3},
+			want:   []float64{1, 100, 3},
+		},
+		{
+			name:      "ewma",
+			smoothing: &v1alpha1.Smoothing{Method: EWMA},
+			values:    []float64{10, 20, 20},
+			want:      []float64{10, 15, 17.5},
+		},
+		{
+			name:      "ewma alpha",
+			smoothing: &v1alpha1.Smoothing{Method: EWMA, Alpha: &alpha},
+			values:    []float64{100, 0},
+			want:      []float64{100, 75},
+		},
+		{
+			name:      "ewma alpha finer than a thousandth",
+			smoothing: &v1alpha1.Smoothing{Method: EWMA, Alpha: &fineAlpha},
+			values:    []float64{100, 0},
+			want:      []float64{100, 99.99},
+		},
+		{
+			name:      "moving median",
+			smoothing: &v1alpha1.Smoothing{Method: MovingMedian},
+			values:    []float64{10, 500, 12, 11, 13},
+			want:      []float64{10, 255, 12, 12, 12},
+		},
+		{
+			name:   "guard holds back a spike",
+			guard:  &v1alpha1.Guard{MaxChangePercent: 50},
+			values: []float64{10, 100, 12},
+			want:   []float64{10, 10, 12},
+		},
+		{
+			name:   "guard accepts a confirmed change",
+			guard:  &v1alpha1.Guard{MaxChangePercent: 50},
+			values: []float64{10, 100, 90, 95},
+			want:   []float64{10, 10, 90, 95},
+		},
+		{
+			name:   "guard requires the same direction",
+			guard:  &v1alpha1.Guard{MaxChangePercent: 50},
+			values: []float64{10, 100, 1, 2},
+			want:   []float64{10, 10, 10, 2},
+		},
+		{
+			name:   "guard accepts small changes",
+			guard:  &v1alpha1.Guard{MaxChangePercent: 50},
+			values: []float64{10, 14, 20},
+			want:   []float64{10, 14, 20},
+		},
+		{
+			name:      "guarded values are not smoothed",
+			smoothing: &v1alpha1.Smoothing{Method: EWMA},
+			guard:     &v1alpha1.Guard{MaxChangePercent: 50},
+			values:    []float64{10, 1000, 10},
+			want:      []float64{10, 10, 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewState()
+			start := time.Now()
+			for i, value := range tt.values {
+				timestamp := start.Add(time.Duration(i) * time.Minute)
+				if got := s.Update("default/metric{}", tt.smoothing, tt.guard, value, timestamp); math.Abs(got-tt.want[i]) > 1e-9 {
+					t.Errorf("Update(%v) = %v, want %v", value, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateKeepsSeriesApart(t *testing.T) {
+	s := NewState()
+	smoothing := &v1alpha1.Smoothing{Method: EWMA}
+
+	s.Update("default/metric{queue=a}", smoothing, nil, 10, time.Now())
+	if got := s.Update("default/metric{queue=b}", smoothing, nil, 100, time.Now()); got != 100 {
+		t.Errorf("first value of another series = %v, want 100", got)
+	}
+}
+
+func TestUpdateRecordsEachDataPointOnce(t *testing.T) {
+	s := NewState()
+	smoothing := &v1alpha1.Smoothing{Method: EWMA}
+	guard := &v1alpha1.Guard{MaxChangePercent: 50}
+	timestamp := time.Now()
+
+	s.Update("default/metric{}", smoothing, guard, 10, timestamp)
+	// the refresher, an HPA request and the activation controller query the same data point
+	for i := 0; i < 3; i++ {
+		if got := s.Update("default/metric{}", smoothing, guard, 100, timestamp); got != 10 {
+			t.Errorf("value of a data point already recorded = %v, want 10", got)
+		}
+	}
+
+	// a held back spike is only confirmed by a newer data point
+	if got := s.Update("default/metric{}", smoothing, guard, 100, timestamp.Add(time.Minute)); got != 10 {
+		t.Errorf("spike = %v, want it held back", got)
+	}
+	if got := s.Update("default/metric{}", smoothing, guard, 100, timestamp.Add(time.Minute)); got != 10 {
+		t.Errorf("same spike queried again = %v, want it held back", got)
+	}
+	if got := s.Update("default/metric{}", smoothing, guard, 90, timestamp.Add(2*time.Minute)); got != 50 {
+		t.Errorf("confirmed change = %v, want 50", got)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	s := NewState()
+	s.now = func() time.Time { return now }
+
+	s.Update("default/deleted{}", nil, nil, 1, now)
+	now = now.Add(2 * maxIdle)
+	s.Update("default/metric{}", nil, nil, 1, now)
+
+	if _, found := s.series["default/deleted{}"]; found {
+		t.Errorf("idle series was not pruned")
+	}
+	if _, found := s.series["default/metric{}"]; !found {
+		t.Errorf("updated series was pruned")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	alpha := resource.MustParse("0.3")
+	tooLarge := resource.MustParse("1.5")
+	tests := []struct {
+		name     string
+		spec     v1alpha1.MetricSeriesSpec
+		wantErrs int
+	}{
+		{name: "none"},
+		{name: "ewma", spec: v1alpha1.MetricSeriesSpec{Smoothing: &v1alpha1.Smoothing{Method: EWMA, Alpha: &alpha}}},
+		{name: "moving median", spec: v1alpha1.MetricSeriesSpec{Smoothing: &v1alpha1.Smoothing{Method: MovingMedian, Window: 5}}},
+		{name: "guard", spec: v1alpha1.MetricSeriesSpec{Guard: &v1alpha1.Guard{MaxChangePercent: 200}}},
+		{name: "unknown method", spec: v1alpha1.MetricSeriesSpec{Smoothing: &v1alpha1.Smoothing{Method: "Mean"}}, wantErrs: 1},
+		{name: "invalid alpha", spec: v1alpha1.MetricSeriesSpec{Smoothing: &v1alpha1.Smoothing{Method: EWMA, Alpha: &tooLarge, Window: 3}}, wantErrs: 2},
+		{name: "invalid window", spec: v1alpha1.MetricSeriesSpec{Smoothing: &v1alpha1.Smoothing{Method: MovingMedian, Window: 1000, Alpha: &alpha}}, wantErrs: 2},
+		{name: "invalid guard", spec: v1alpha1.MetricSeriesSpec{Guard: &v1alpha1.Guard{}}, wantErrs: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := Validate(tt.spec, field.NewPath("spec")); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
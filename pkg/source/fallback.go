@@ -0,0 +1,48 @@
+package source
+
+import (
+	"fmt"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+)
+
+// FallbackRequest returns the request of a fallback of a metric request, which is the request with
+// the fields set by the fallback replaced.
+func FallbackRequest(request v1alpha1.ExternalMetric, i int) v1alpha1.ExternalMetric {
+	return QueryRequest(request, request.Spec.Fallbacks[i])
+}
+
+// QueryRequest returns a metric request with the fields set by a series query replaced, without
+// the fallbacks and math expression of the request.
+func QueryRequest(request v1alpha1.ExternalMetric, query v1alpha1.SeriesQuery) v1alpha1.ExternalMetric {
+	queryRequest := *request.DeepCopy()
+	spec := &queryRequest.Spec
+
+	if query.RoleARN != nil {
+		spec.RoleARN = query.RoleARN
+	}
+	if query.Region != nil {
+		spec.Region = query.Region
+	}
+	if HasQuery(query) {
+		spec.Queries = query.Queries
+		spec.PromQL = query.PromQL
+		spec.LogsInsights = query.LogsInsights
+		spec.SQS = query.SQS
+		spec.Stream = query.Stream
+	}
+	spec.Fallbacks = nil
+	spec.Math = nil
+
+	return queryRequest
+}
+
+// FallbackName identifies a fallback in events and samples.
+func FallbackName(i int) string {
+	return fmt.Sprintf("fallbacks[%d]", i)
+}
+
+// HasQuery returns true if a series query replaces the query of the series.
+func HasQuery(query v1alpha1.SeriesQuery) bool {
+	return len(query.Queries) > 0 || query.PromQL != nil || query.LogsInsights != nil || query.SQS != nil || query.Stream != nil
+}
@@ -0,0 +1,185 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/smoothing"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/transform"
+)
+
+// Sample is the latest value of a metric series retrieved from a source.
+type Sample struct {
+	// Value of the series.
+	Value float64 `json:"value"`
+	// Timestamp of the value.
+	Timestamp time.Time `json:"timestamp"`
+	// Labels identify the series the value belongs to.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Raw is the value returned by the source, set when Value was smoothed or guarded.
+	Raw *float64 `json:"raw,omitempty"`
+	// Source is the fallback of the metric series the value was retrieved from, empty when it was
+	// retrieved by the query of the series.
+	Source string `json:"source,omitempty"`
+}
+
+// MetricsSource retrieves metric values from a data source, such as CloudWatch.
+type MetricsSource interface {
+	// Name identifies the source in logs and events.
+	Name() string
+	// Handles returns true if the source queries the metric series described by the spec.
+	Handles(spec v1alpha1.MetricSeriesSpec) bool
+	// Validate checks that the source can query a metric series it handles.
+	Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList
+	// Query returns the latest sample of each series of a metric request. The first sample is the
+	// value reported to the HPA. The requests sent to the source are cancelled with the context.
+	Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]Sample, error)
+}
+
+// Configurable is implemented by the sources applying the adapter configuration.
+type Configurable interface {
+	// Configure applies a new adapter configuration to the following queries.
+	Configure(cfg *config.AdapterConfig)
+}
+
+// QueryRecorder records the queries sent to the sources, such as to serve them on the debug
+// endpoint.
+type QueryRecorder interface {
+	// RecordSourceQuery records a query of a metric request sent to a source, with the samples or
+	// the error it returned.
+	RecordSourceQuery(request v1alpha1.ExternalMetric, source string, start time.Time, latency time.Duration, samples []Sample, err error)
+}
+
+// Registry dispatches each metric request to the first registered source handling it.
+type Registry struct {
+	sources  []MetricsSource
+	recorder QueryRecorder
+}
+
+// NewRegistry returns a Registry of the given sources, in order of precedence.
+func NewRegistry(sources ...MetricsSource) *Registry {
+	return &Registry{sources: sources}
+}
+
+// Register adds a source with the lowest precedence, such as a source querying the registry
+// itself. Sources must be registered before the registry is used.
+func (r *Registry) Register(s MetricsSource) {
+	r.sources = append(r.sources, s)
+}
+
+// SetRecorder sets the recorder of the queries sent to the sources. It must be set before the
+// registry is used.
+func (r *Registry) SetRecorder(recorder QueryRecorder) {
+	r.recorder = recorder
+}
+
+// Name returns the names of the registered sources.
+func (r *Registry) Name() string {
+	names := make([]string, len(r.sources))
+	for i, s := range r.sources {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Handles returns true if a registered source handles the spec.
+func (r *Registry) Handles(spec v1alpha1.MetricSeriesSpec) bool {
+	_, found := r.For(spec)
+	return found
+}
+
+// For returns the source handling the spec.
+func (r *Registry) For(spec v1alpha1.MetricSeriesSpec) (MetricsSource, bool) {
+	for _, s := range r.sources {
+		if s.Handles(spec) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Validate checks that exactly one registered source handles the spec and each of its fallbacks
+// and math sources, that the sources can query them and that the transform and smoothing of its
+// values are valid.
+func (r *Registry) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := r.validateQuery(spec, fldPath)
+	allErrs = append(allErrs, transform.Validate(spec.Transform, fldPath.Child("transform"))...)
+	allErrs = append(allErrs, smoothing.Validate(spec, fldPath)...)
+
+	request := v1alpha1.ExternalMetric{Spec: spec}
+	for i, fallback := range spec.Fallbacks {
+		fallbackPath := fldPath.Child("fallbacks").Index(i)
+		switch {
+		case HasQuery(fallback):
+			allErrs = append(allErrs, r.validateQuery(FallbackRequest(request, i).Spec, fallbackPath)...)
+		case fallback.RoleARN == nil && fallback.Region == nil:
+			allErrs = append(allErrs, field.Required(fallbackPath, "a fallback must set a region, a role or a query"))
+		}
+	}
+
+	if spec.Math != nil {
+		for i, mathSource := range spec.Math.Sources {
+			if HasQuery(mathSource.SeriesQuery) {
+				allErrs = append(allErrs, r.validateQuery(QueryRequest(request, mathSource.SeriesQuery).Spec, fldPath.Child("math", "sources").Index(i))...)
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validateQuery checks that exactly one registered source handles the spec and that the source
+// can query it.
+func (r *Registry) validateQuery(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	var handling []MetricsSource
+	for _, s := range r.sources {
+		if s.Handles(spec) {
+			handling = append(handling, s)
+		}
+	}
+
+	switch len(handling) {
+	case 0:
+		return field.ErrorList{field.Required(fldPath, "a query is required")}
+	case 1:
+		return handling[0].Validate(spec, fldPath)
+	default:
+		names := make([]string, len(handling))
+		for i, s := range handling {
+			names[i] = s.Name()
+		}
+		return field.ErrorList{field.Forbidden(fldPath, fmt.Sprintf("only one kind of query may be specified, found queries for %s", strings.Join(names, ", ")))}
+	}
+}
+
+// Query queries the source handling the request, and records the query with the recorder. Errors
+// are prefixed with the name of the source.
+func (r *Registry) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]Sample, error) {
+	s, found := r.For(request.Spec)
+	if !found {
+		return nil, errors.New("no metric source handles the query")
+	}
+
+	start := time.Now()
+	samples, err := s.Query(ctx, request)
+	if r.recorder != nil {
+		r.recorder.RecordSourceQuery(request, s.Name(), start, time.Since(start), samples, err)
+	}
+	return samples, errors.Wrap(err, s.Name())
+}
+
+// Configure applies the configuration to the registered sources which are configurable.
+func (r *Registry) Configure(cfg *config.AdapterConfig) {
+	for _, s := range r.sources {
+		if c, ok := s.(Configurable); ok {
+			c.Configure(cfg)
+		}
+	}
+}
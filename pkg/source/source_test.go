@@ -0,0 +1,184 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/config"
+)
+
+// fakeSource handles the specs with the series name it was created for.
+type fakeSource struct {
+	name       string
+	seriesName string
+	err        error
+	configured bool
+}
+
+func (s *fakeSource) Name() string {
+	return s.name
+}
+
+func (s *fakeSource) Handles(spec v1alpha1.MetricSeriesSpec) bool {
+	return spec.Name == s.seriesName
+}
+
+func (s *fakeSource) Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	if spec.Region != nil {
+		return field.ErrorList{field.Forbidden(fldPath.Child("region"), "not supported")}
+	}
+	return nil
+}
+
+func (s *fakeSource) Query(ctx context.Context, request v1alpha1.ExternalMetric) ([]Sample, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []Sample{{Value: 1, Labels: map[string]string{"source": s.name}}}, nil
+}
+
+func (s *fakeSource) Configure(cfg *config.AdapterConfig) {
+	s.configured = true
+}
+
+func newRequest(seriesName string) v1alpha1.ExternalMetric {
+	return v1alpha1.ExternalMetric{Spec: v1alpha1.MetricSeriesSpec{Name: seriesName}}
+}
+
+func TestRegistryDispatchesToHandlingSource(t *testing.T) {
+	first := &fakeSource{name: "first", seriesName: "a"}
+	second := &fakeSource{name: "second", seriesName: "b"}
+	registry := NewRegistry(first, second)
+
+	samples, err := registry.Query(context.Background(), newRequest("b"))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if got := samples[0].Labels["source"]; got != "second" {
+		t.Errorf("source = %v, want %v", got, "second")
+	}
+
+	if registry.Handles(newRequest("c").Spec) {
+		t.Errorf("Handles() = true, want false")
+	}
+	if _, err := registry.Query(context.Background(), newRequest("c")); err == nil {
+		t.Errorf("Query() error = nil, want an error")
+	}
+
+	registry.Configure(config.NewDefaultConfig())
+	if !first.configured || !second.configured {
+		t.Errorf("configured = %v, %v, want true, true", first.configured, second.configured)
+	}
+}
+
+func TestRegistryPrefixesErrors(t *testing.T) {
+	registry := NewRegistry(&fakeSource{name: "first", seriesName: "a", err: errors.New("failed")})
+
+	_, err := registry.Query(context.Background(), newRequest("a"))
+	if err == nil || err.Error() != "first: failed" {
+		t.Errorf("Query() error = %v, want %v", err, "first: failed")
+	}
+}
+
+// fakeRecorder keeps the sources and errors of the recorded queries.
+type fakeRecorder struct {
+	queries []string
+}
+
+func (r *fakeRecorder) RecordSourceQuery(request v1alpha1.ExternalMetric, source string, start time.Time, latency time.Duration, samples []Sample, err error) {
+	r.queries = append(r.queries, fmt.Sprintf("%s %d %v", source, len(samples), err))
+}
+
+func TestRegistryRecordsQueries(t *testing.T) {
+	registry := NewRegistry(&fakeSource{name: "first", seriesName: "a"}, &fakeSource{name: "second", seriesName: "b", err: errors.New("failed")})
+	recorder := &fakeRecorder{}
+	registry.SetRecorder(recorder)
+
+	registry.Query(context.Background(), newRequest("a"))
+	registry.Query(context.Background(), newRequest("b"))
+	registry.Query(context.Background(), newRequest("c"))
+
+	if want := []string{"first 1 <nil>", "second 0 failed"}; !reflect.DeepEqual(recorder.queries, want) {
+		t.Errorf("recorded queries = %v, want %v", recorder.queries, want)
+	}
+}
+
+func TestRegistryValidate(t *testing.T) {
+	region := "us-west-2"
+	registry := NewRegistry(
+		&fakeSource{name: "first", seriesName: "a"},
+		&fakeSource{name: "second", seriesName: "b"},
+		&fakeSource{name: "third", seriesName: "b"},
+	)
+
+	tests := []struct {
+		name     string
+		spec     v1alpha1.MetricSeriesSpec
+		wantErrs int
+	}{
+		{name: "one source", spec: v1alpha1.MetricSeriesSpec{Name: "a"}},
+		{name: "invalid for the source", spec: v1alpha1.MetricSeriesSpec{Name: "a", Region: &region}, wantErrs: 1},
+		{name: "no source", spec: v1alpha1.MetricSeriesSpec{Name: "c"}, wantErrs: 1},
+		{name: "several sources", spec: v1alpha1.MetricSeriesSpec{Name: "b"}, wantErrs: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := registry.Validate(tt.spec, field.NewPath("spec"))
+			if len(errs) != tt.wantErrs {
+				t.Errorf("Validate() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestFallbackRequest(t *testing.T) {
+	primaryRegion, fallbackRegion := "us-east-1", "us-west-2"
+	request := v1alpha1.ExternalMetric{Spec: v1alpha1.MetricSeriesSpec{
+		Region:  &primaryRegion,
+		Queries: []v1alpha1.MetricDataQuery{{ID: "primary"}},
+		Fallbacks: []v1alpha1.SeriesQuery{
+			{Region: &fallbackRegion},
+			{PromQL: &v1alpha1.PromQLQuery{Query: "up"}},
+		},
+	}}
+
+	regional := FallbackRequest(request, 0).Spec
+	if *regional.Region != fallbackRegion || regional.Queries[0].ID != "primary" || regional.Fallbacks != nil {
+		t.Errorf("spec = %+v, want the query of the series in the fallback region", regional)
+	}
+
+	promql := FallbackRequest(request, 1).Spec
+	if *promql.Region != primaryRegion || promql.Queries != nil || promql.PromQL == nil {
+		t.Errorf("spec = %+v, want the query of the fallback in the region of the series", promql)
+	}
+
+	if *request.Spec.Region != primaryRegion {
+		t.Errorf("the fallback request modified the request")
+	}
+}
+
+func TestRegistryValidatesFallbacks(t *testing.T) {
+	region := "us-west-2"
+	registry := NewRegistry(&fakeSource{name: "first", seriesName: "a"})
+	spec := v1alpha1.MetricSeriesSpec{
+		Name: "a",
+		Fallbacks: []v1alpha1.SeriesQuery{
+			{RoleARN: &region},
+			{},
+			{Region: &region, Queries: []v1alpha1.MetricDataQuery{{ID: "fallback"}}},
+		},
+	}
+
+	errs := registry.Validate(spec, field.NewPath("spec"))
+	if len(errs) != 2 || errs[0].Field != "spec.fallbacks[1]" || errs[1].Field != "spec.fallbacks[2].region" {
+		t.Errorf("Validate() = %v, want errors for fallbacks[1] and fallbacks[2].region", errs)
+	}
+}
@@ -0,0 +1,165 @@
+package templating
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/logging"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/objects"
+)
+
+// Resolver resolves the templates of metric series with the objects they reference, and watches
+// the objects to report the metrics whose resolved series changed.
+type Resolver struct {
+	objects *objects.Reader
+
+	lock       sync.Mutex
+	watched    map[schema.GroupVersionResource]bool
+	references map[string]*reference
+	onChange   func(key string)
+}
+
+// reference is the object the templates of a metric are resolved with.
+type reference struct {
+	resource  schema.GroupVersionResource
+	namespace string
+	name      string
+	spec      v1alpha1.MetricSeriesSpec
+	// resolved is the last resolved series, nil when it could not be resolved.
+	resolved *v1alpha1.MetricSeriesSpec
+}
+
+// NewResolver returns a Resolver reading and watching objects with the reader.
+func NewResolver(reader *objects.Reader) *Resolver {
+	return &Resolver{
+		objects:    reader,
+		watched:    map[schema.GroupVersionResource]bool{},
+		references: map[string]*reference{},
+	}
+}
+
+// OnChange sets the function called with the key of a metric when the resolved series of the
+// metric changes, because the object it references changed.
+func (r *Resolver) OnChange(f func(key string)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onChange = f
+}
+
+// Resolve returns the metric series of a metric with its templates resolved with the object it
+// references, in the namespace of the metric if the reference sets no namespace. An ExternalMetric
+// may only reference objects in its own namespace. The object is read from the cache of the
+// reader and watched from then on, including when it can't be read yet.
+func (r *Resolver) Resolve(key, namespace string, spec v1alpha1.MetricSeriesSpec) (v1alpha1.MetricSeriesSpec, error) {
+	if errs := Validate(spec, field.NewPath("spec")); len(errs) > 0 {
+		return spec, errs.ToAggregate()
+	}
+
+	ref := spec.Template
+	mapping, err := r.objects.Mapping(ref.APIVersion, ref.Kind)
+	if err != nil {
+		return spec, err
+	}
+	namespace, err = objects.Namespace(namespace, ref.Namespace)
+	if err != nil {
+		return spec, err
+	}
+
+	// the object is watched once it was read, so that the events replayed to a new watch do not
+	// report the series resolved here as changed
+	var resolved *v1alpha1.MetricSeriesSpec
+	obj, err := r.objects.Get(context.Background(), mapping, namespace, ref.Name)
+	if err != nil {
+		err = fmt.Errorf("unable to read %s %s: %v", ref.Kind, ref.Name, err)
+	} else {
+		var executed v1alpha1.MetricSeriesSpec
+		if executed, err = Execute(spec, ObjectData(obj)); err == nil {
+			resolved = &executed
+		}
+	}
+	r.watch(key, &reference{resource: mapping.Resource, namespace: namespace, name: ref.Name, spec: spec, resolved: resolved})
+
+	if err != nil {
+		return spec, err
+	}
+	return *resolved, nil
+}
+
+// Forget stops resolving the templates of a metric, which was deleted or no longer references an
+// object.
+func (r *Resolver) Forget(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.references, key)
+}
+
+// watch records the object a metric references, and starts watching objects of its resource.
+func (r *Resolver) watch(key string, ref *reference) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.references[key] = ref
+	if r.watched[ref.resource] {
+		return
+	}
+
+	logging.V(2).Info("Watching objects referenced by metric templates", "resource", ref.resource.String())
+	r.watched[ref.resource] = true
+	resource := ref.resource
+	r.objects.Informer(resource).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { r.changed(resource, obj, false) },
+		UpdateFunc: func(old, obj interface{}) { r.changed(resource, obj, false) },
+		DeleteFunc: func(obj interface{}) { r.changed(resource, obj, true) },
+	})
+}
+
+// changed resolves the templates of the metrics referencing an object again, and reports the
+// metrics whose resolved series changed.
+func (r *Resolver) changed(resource schema.GroupVersionResource, obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	r.lock.Lock()
+	var changed []string
+	for key, ref := range r.references {
+		if ref.resource != resource || ref.namespace != u.GetNamespace() || ref.name != u.GetName() {
+			continue
+		}
+
+		var resolved *v1alpha1.MetricSeriesSpec
+		if !deleted {
+			if spec, err := Execute(ref.spec, ObjectData(u)); err == nil {
+				resolved = &spec
+			}
+		}
+
+		if (resolved == nil) != (ref.resolved == nil) || (resolved != nil && !equality.Semantic.DeepEqual(*resolved, *ref.resolved)) {
+			ref.resolved = resolved
+			changed = append(changed, key)
+		}
+	}
+	onChange := r.onChange
+	r.lock.Unlock()
+
+	for _, key := range changed {
+		logging.V(2).Info("Referenced object changed, resolving the templates again", "resource", resource.Resource, "namespace", u.GetNamespace(), "name", u.GetName(), "key", key)
+		if onChange != nil {
+			onChange(key)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package templating
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/objects"
+)
+
+var deploymentsResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+func newTestResolver(t *testing.T, objs ...runtime.Object) (*Resolver, *[]string) {
+	client := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), objs...)
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{{Group: "apps", Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, apimeta.RESTScopeNamespace)
+
+	reader := objects.NewReader(client, mapper, time.Minute)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	go reader.Run(stopCh)
+
+	var changed []string
+	r := NewResolver(reader)
+	r.OnChange(func(key string) { changed = append(changed, key) })
+	return r, &changed
+}
+
+func TestResolve(t *testing.T) {
+	r, _ := newTestResolver(t, newDeployment("orders"))
+
+	resolved, err := r.Resolve("ExternalMetric/default/queue", "default", newTemplatedSpec("{{ .Labels.queue }}"))
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got := resolved.Queries[0].MetricStat.Metric.Dimensions[0].Value; got != "orders" {
+		t.Errorf("dimension value = %q, want orders", got)
+	}
+
+	if _, err := r.Resolve("ExternalMetric/other/queue", "other", newTemplatedSpec("{{ .Labels.queue }}")); err == nil {
+		t.Errorf("Resolve() error = nil, want an error for a missing object")
+	}
+	if _, err := r.Resolve("ClusterExternalMetric/queue", "", newTemplatedSpec("{{ .Labels.queue }}")); err == nil {
+		t.Errorf("Resolve() error = nil, want an error for a cluster metric without a namespace")
+	}
+
+	otherNamespace := newTemplatedSpec("{{ .Labels.queue }}")
+	otherNamespace.Template.Namespace = "kube-system"
+	if _, err := r.Resolve("ExternalMetric/default/queue", "default", otherNamespace); err == nil {
+		t.Errorf("Resolve() error = nil, want an error for an object in another namespace")
+	}
+
+	secret := newTemplatedSpec("{{ .Labels.queue }}")
+	secret.Template = &v1alpha1.TemplateReference{APIVersion: "v1", Kind: "Secret", Name: "worker"}
+	if _, err := r.Resolve("ExternalMetric/default/queue", "default", secret); err == nil {
+		t.Errorf("Resolve() error = nil, want an error for an unsupported kind")
+	}
+}
+
+func TestChangedObjectIsReported(t *testing.T) {
+	r, changed := newTestResolver(t, newDeployment("orders"))
+	key := "ExternalMetric/default/queue"
+	if _, err := r.Resolve(key, "default", newTemplatedSpec("{{ .Labels.queue }}")); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	// an update which does not change the resolved series, such as a status update
+	unchanged := newDeployment("orders")
+	unchanged.Object["status"] = map[string]interface{}{"readyReplicas": int64(2)}
+	r.changed(deploymentsResource, unchanged, false)
+	if len(*changed) != 0 {
+		t.Errorf("changed = %v, want no change", *changed)
+	}
+
+	r.changed(deploymentsResource, newDeployment("payments"), false)
+	if want := []string{key}; !reflect.DeepEqual(*changed, want) {
+		t.Errorf("changed = %v, want %v", *changed, want)
+	}
+
+	r.changed(deploymentsResource, newDeployment("payments"), true)
+	if want := []string{key, key}; !reflect.DeepEqual(*changed, want) {
+		t.Errorf("changed = %v after deletion, want %v", *changed, want)
+	}
+
+	r.Forget(key)
+	r.changed(deploymentsResource, newDeployment("orders"), false)
+	if len(*changed) != 2 {
+		t.Errorf("changed = %v, want no change of a forgotten metric", *changed)
+	}
+}
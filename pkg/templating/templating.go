@@ -0,0 +1,159 @@
+// Package templating resolves the templates of metric series, such as a dimension value of
+// {{ .Labels.queue }}, with the fields of the Kubernetes object the series references.
+package templating
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/objects"
+)
+
+// Data is the data templates are executed with.
+type Data struct {
+	// Name of the object.
+	Name string
+	// Namespace of the object.
+	Namespace string
+	// Labels of the object.
+	Labels map[string]string
+	// Annotations of the object.
+	Annotations map[string]string
+	// Data holds the data of a ConfigMap.
+	Data map[string]string
+	// Object is the whole object, such as .Object.spec.replicas.
+	Object map[string]interface{}
+}
+
+// ObjectData returns the data of an object to execute templates with.
+func ObjectData(obj *unstructured.Unstructured) Data {
+	data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	return Data{
+		Name:        obj.GetName(),
+		Namespace:   obj.GetNamespace(),
+		Labels:      obj.GetLabels(),
+		Annotations: obj.GetAnnotations(),
+		Data:        data,
+		Object:      obj.Object,
+	}
+}
+
+// Execute resolves the templates in the string fields of a metric series with the data. Missing
+// labels, annotations or keys are an error. The template reference of the series is kept.
+func Execute(spec v1alpha1.MetricSeriesSpec, data Data) (v1alpha1.MetricSeriesSpec, error) {
+	fields, err := specFields(spec)
+	if err != nil {
+		return spec, err
+	}
+
+	resolved, err := walk(fields, field.NewPath("spec"), func(s string, fldPath *field.Path) (string, error) {
+		t, err := parse(s, fldPath)
+		if err != nil {
+			return "", err
+		}
+
+		var out bytes.Buffer
+		if err := t.Execute(&out, data); err != nil {
+			return "", err
+		}
+		return out.String(), nil
+	})
+	if err != nil {
+		return spec, err
+	}
+
+	raw, err := json.Marshal(resolved)
+	if err != nil {
+		return spec, err
+	}
+	var resolvedSpec v1alpha1.MetricSeriesSpec
+	if err := json.Unmarshal(raw, &resolvedSpec); err != nil {
+		return spec, err
+	}
+	resolvedSpec.Template = spec.Template
+	return resolvedSpec, nil
+}
+
+// Validate checks the template reference and the syntax of the templates of a metric series.
+func Validate(spec v1alpha1.MetricSeriesSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	ref := spec.Template
+	refPath := fldPath.Child("template")
+	allErrs = append(allErrs, objects.ValidateKind(ref.APIVersion, ref.Kind, refPath)...)
+	if ref.Name == "" {
+		allErrs = append(allErrs, field.Required(refPath.Child("name"), ""))
+	}
+
+	fields, err := specFields(spec)
+	if err != nil {
+		return append(allErrs, field.InternalError(fldPath, err))
+	}
+	walk(fields, fldPath, func(s string, fldPath *field.Path) (string, error) {
+		if _, err := parse(s, fldPath); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath, s, err.Error()))
+		}
+		return s, nil
+	})
+
+	return allErrs
+}
+
+// specFields returns the fields of a metric series as decoded JSON values, without its template
+// reference.
+func specFields(spec v1alpha1.MetricSeriesSpec) (interface{}, error) {
+	spec.Template = nil
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields interface{}
+	err = json.Unmarshal(raw, &fields)
+	return fields, err
+}
+
+// walk replaces the strings containing templates in decoded JSON values with the result of f. The
+// fields of objects are walked in order, so the first error reported is deterministic.
+func walk(v interface{}, fldPath *field.Path, f func(s string, fldPath *field.Path) (string, error)) (interface{}, error) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			resolved, err := walk(value[key], fldPath.Child(key), f)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = resolved
+		}
+	case []interface{}:
+		for i := range value {
+			resolved, err := walk(value[i], fldPath.Index(i), f)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = resolved
+		}
+	case string:
+		if strings.Contains(value, "{{") {
+			return f(value, fldPath)
+		}
+	}
+	return v, nil
+}
+
+// parse parses the template of a field, named after the field in errors.
+func parse(s string, fldPath *field.Path) (*template.Template, error) {
+	return template.New(fldPath.String()).Option("missingkey=error").Parse(s)
+}
@@ -0,0 +1,119 @@
+package templating
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+)
+
+func newDeployment(queue string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "worker", "namespace": "default"},
+		"spec":       map[string]interface{}{"replicas": int64(3)},
+	}}
+	obj.SetLabels(map[string]string{"queue": queue})
+	return obj
+}
+
+func newTemplatedSpec(dimension string) v1alpha1.MetricSeriesSpec {
+	return v1alpha1.MetricSeriesSpec{
+		Template: &v1alpha1.TemplateReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "worker"},
+		Queries: []v1alpha1.MetricDataQuery{
+			{
+				ID: "messages",
+				MetricStat: v1alpha1.MetricStat{
+					Metric: v1alpha1.Metric{
+						Namespace:  "AWS/SQS",
+						MetricName: "ApproximateNumberOfMessagesVisible",
+						Dimensions: []v1alpha1.Dimension{{Name: "QueueName", Value: dimension}},
+					},
+					Period: 60,
+					Stat:   "Sum",
+				},
+				ReturnData: aws.Bool(false),
+			},
+			{
+				ID:         "perReplica",
+				Expression: "messages / {{ .Object.spec.replicas }}",
+			},
+		},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	spec := newTemplatedSpec("{{ .Labels.queue }}-{{ .Namespace }}")
+
+	resolved, err := Execute(spec, ObjectData(newDeployment("orders")))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if got := resolved.Queries[0].MetricStat.Metric.Dimensions[0].Value; got != "orders-default" {
+		t.Errorf("dimension value = %q, want orders-default", got)
+	}
+	if got := resolved.Queries[1].Expression; got != "messages / 3" {
+		t.Errorf("expression = %q, want messages / 3", got)
+	}
+	if resolved.Template == nil || resolved.Queries[0].MetricStat.Period != 60 || aws.BoolValue(resolved.Queries[0].ReturnData) {
+		t.Errorf("resolved = %+v, want the other fields unchanged", resolved)
+	}
+	if got := spec.Queries[0].MetricStat.Metric.Dimensions[0].Value; got != "{{ .Labels.queue }}-{{ .Namespace }}" {
+		t.Errorf("template = %q, want the spec unchanged", got)
+	}
+}
+
+func TestExecuteConfigMapData(t *testing.T) {
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "queues"},
+		"data":       map[string]interface{}{"orders": "orders-prod"},
+	}}
+
+	spec := newTemplatedSpec(`{{ index .Data "orders" }}`)
+	spec.Queries = spec.Queries[:1]
+
+	resolved, err := Execute(spec, ObjectData(configMap))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got := resolved.Queries[0].MetricStat.Metric.Dimensions[0].Value; got != "orders-prod" {
+		t.Errorf("dimension value = %q, want orders-prod", got)
+	}
+}
+
+func TestExecuteMissingKey(t *testing.T) {
+	if _, err := Execute(newTemplatedSpec("{{ .Labels.topic }}"), ObjectData(newDeployment("orders"))); err == nil {
+		t.Errorf("Execute() error = nil, want an error for a missing label")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     v1alpha1.MetricSeriesSpec
+		wantErrs int
+	}{
+		{name: "valid", spec: newTemplatedSpec("{{ .Labels.queue }}")},
+		{name: "invalid template", spec: newTemplatedSpec("{{ .Labels.queue "), wantErrs: 1},
+		{
+			name:     "invalid reference",
+			spec:     v1alpha1.MetricSeriesSpec{Template: &v1alpha1.TemplateReference{APIVersion: "a/b/c"}},
+			wantErrs: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := Validate(tt.spec, field.NewPath("spec")); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package transform converts the values of metric series before they are served to the HPA.
+package transform
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+)
+
+// The rounding modes of a transform.
+const (
+	Floor   = "Floor"
+	Ceiling = "Ceiling"
+	Nearest = "Nearest"
+)
+
+// rateSuffix is the suffix of the CloudWatch rate units, such as Bytes/Second, which convert like
+// the unit they are a rate of.
+const rateSuffix = "/Second"
+
+// unit is a unit values can be converted from and to.
+type unit struct {
+	// kind groups the units which convert into each other
+	kind string
+	// factor converts a value in the unit into the base unit of its kind
+	factor float64
+}
+
+// units are the CloudWatch units, and the binary byte units, values can be converted between.
+var units = map[string]unit{
+	"Microseconds": {"time", 1e-6},
+	"Milliseconds": {"time", 1e-3},
+	"Seconds":      {"time", 1},
+	"Minutes":      {"time", 60},
+	"Hours":        {"time", 3600},
+
+	"Bytes":     {"bytes", 1},
+	"Kilobytes": {"bytes", 1e3},
+	"Megabytes": {"bytes", 1e6},
+	"Gigabytes": {"bytes", 1e9},
+	"Terabytes": {"bytes", 1e12},
+	"Kibibytes": {"bytes", 1 << 10},
+	"Mebibytes": {"bytes", 1 << 20},
+	"Gibibytes": {"bytes", 1 << 30},
+	"Tebibytes": {"bytes", 1 << 40},
+	"Bits":      {"bytes", 1.0 / 8},
+	"Kilobits":  {"bytes", 1e3 / 8},
+	"Megabits":  {"bytes", 1e6 / 8},
+	"Gigabits":  {"bytes", 1e9 / 8},
+	"Terabits":  {"bytes", 1e12 / 8},
+
+	"Percent": {"ratio", 1e-2},
+	"Ratio":   {"ratio", 1},
+}
+
+// lookupUnit returns a unit, rate units are returned with a kind of their own.
+func lookupUnit(name string) (unit, bool) {
+	if strings.HasSuffix(name, rateSuffix) {
+		u, found := units[strings.TrimSuffix(name, rateSuffix)]
+		u.kind += rateSuffix
+		return u, found
+	}
+	u, found := units[name]
+	return u, found
+}
+
+// Apply returns a value converted by a transform, a nil transform returns the value unchanged.
+func Apply(t *v1alpha1.ValueTransform, value float64) float64 {
+	if t == nil {
+		return value
+	}
+
+	if t.FromUnit != "" && t.ToUnit != "" {
+		from, _ := lookupUnit(t.FromUnit)
+		to, _ := lookupUnit(t.ToUnit)
+		if from.factor > 0 && to.factor > 0 {
+			value = value * from.factor / to.factor
+		}
+	}
+	if t.Scale != nil {
+		value *= Float64(*t.Scale)
+	}
+	if t.Offset != nil {
+		value += Float64(*t.Offset)
+	}
+	if t.Min != nil {
+		value = math.Max(value, Float64(*t.Min))
+	}
+	if t.Max != nil {
+		value = math.Min(value, Float64(*t.Max))
+	}
+
+	switch t.Round {
+	case Floor:
+		value = math.Floor(value)
+	case Ceiling:
+		value = math.Ceil(value)
+	case Nearest:
+		value = math.Round(value)
+	}
+	return value
+}
+
+// Validate checks that the units of a transform convert into each other and that its bounds and
+// rounding mode are valid.
+func Validate(t *v1alpha1.ValueTransform, fldPath *field.Path) field.ErrorList {
+	if t == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+
+	switch {
+	case t.FromUnit == "" && t.ToUnit == "":
+	case t.FromUnit == "" || t.ToUnit == "":
+		allErrs = append(allErrs, field.Required(fldPath, "fromUnit and toUnit must be specified together"))
+	default:
+		from, fromFound := lookupUnit(t.FromUnit)
+		to, toFound := lookupUnit(t.ToUnit)
+		if !fromFound {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("fromUnit"), t.FromUnit, supportedUnits()))
+		}
+		if !toFound {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("toUnit"), t.ToUnit, supportedUnits()))
+		}
+		if fromFound && toFound && from.kind != to.kind {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("toUnit"), t.ToUnit, "must be the same kind of unit as "+t.FromUnit))
+		}
+	}
+
+	if t.Min != nil && t.Max != nil && t.Min.Cmp(*t.Max) > 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("min"), t.Min.String(), "must not be greater than max"))
+	}
+
+	switch t.Round {
+	case "", Floor, Ceiling, Nearest:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("round"), t.Round, []string{Floor, Ceiling, Nearest}))
+	}
+
+	return allErrs
+}
+
+// Quantity returns the quantity served for a transformed value. Values of series without a
+// transform are truncated to an integer, transformed values keep a precision of a thousandth.
+func Quantity(t *v1alpha1.ValueTransform, value float64) resource.Quantity {
+	if t == nil {
+		return *resource.NewQuantity(int64(value), resource.DecimalSI)
+	}
+	return *resource.NewMilliQuantity(int64(math.Round(value*1000)), resource.DecimalSI)
+}
+
+// Float64 converts a quantity to the closest float64, without rounding it to a thousandth as
+// its MilliValue would.
+func Float64(q resource.Quantity) float64 {
+	value, err := strconv.ParseFloat(q.AsDec().String(), 64)
+	if err != nil {
+		// the decimal string of a quantity is always a valid float
+		return math.NaN()
+	}
+	return value
+}
+
+func supportedUnits() []string {
+	supported := make([]string, 0, len(units))
+	for name := range units {
+		supported = append(supported, name)
+	}
+	sort.Strings(supported)
+	return supported
+}
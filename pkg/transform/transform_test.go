@@ -0,0 +1,103 @@
+package transform
+
+import (
+	"math"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/awslabs/k8s-cloudwatch-adapter/pkg/apis/metrics/v1alpha1"
+)
+
+func quantity(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform *v1alpha1.ValueTransform
+		value     float64
+		want      float64
+	}{
+		{name: "no transform", value: 12.5, want: 12.5},
+		{name: "bytes to mebibytes", transform: &v1alpha1.ValueTransform{FromUnit: "Bytes", ToUnit: "Mebibytes"}, value: 3 << 20, want: 3},
+		{name: "milliseconds to seconds", transform: &v1alpha1.ValueTransform{FromUnit: "Milliseconds", ToUnit: "Seconds"}, value: 1500, want: 1.5},
+		{name: "rate", transform: &v1alpha1.ValueTransform{FromUnit: "Bits/Second", ToUnit: "Kilobytes/Second"}, value: 16000, want: 2},
+		{name: "percent to ratio", transform: &v1alpha1.ValueTransform{FromUnit: "Percent", ToUnit: "Ratio"}, value: 25, want: 0.25},
+		{name: "scale and offset", transform: &v1alpha1.ValueTransform{Scale: quantity("0.5"), Offset: quantity("-2")}, value: 10, want: 3},
+		{name: "sub-milli scale", transform: &v1alpha1.ValueTransform{Scale: quantity("0.0001")}, value: 25000, want: 2.5},
+		// quantities keep nine decimals, 1/1024 is parsed as 0.000976563
+		{name: "binary fraction scale", transform: &v1alpha1.ValueTransform{Scale: quantity("0.0009765625")}, value: 1024, want: 1.000000512},
+		{name: "sub-milli offset", transform: &v1alpha1.ValueTransform{Offset: quantity("0.0004")}, value: 1, want: 1.0004},
+		{name: "min", transform: &v1alpha1.ValueTransform{Min: quantity("1")}, value: 0.2, want: 1},
+		{name: "max", transform: &v1alpha1.ValueTransform{Max: quantity("100")}, value: 250, want: 100},
+		{name: "floor", transform: &v1alpha1.ValueTransform{Round: Floor}, value: 2.7, want: 2},
+		{name: "ceiling", transform: &v1alpha1.ValueTransform{Round: Ceiling}, value: 2.2, want: 3},
+		{name: "nearest", transform: &v1alpha1.ValueTransform{Round: Nearest}, value: 2.5, want: 3},
+		{
+			name:      "all steps in order",
+			transform: &v1alpha1.ValueTransform{FromUnit: "Milliseconds", ToUnit: "Seconds", Scale: quantity("2"), Offset: quantity("1"), Max: quantity("10"), Round: Ceiling},
+			value:     2100,
+			want:      6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Apply(tt.transform, tt.value); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantity(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform *v1alpha1.ValueTransform
+		value     float64
+		want      string
+	}{
+		{name: "no transform truncates", value: 2.7, want: "2"},
+		{name: "transform keeps thousandths", transform: &v1alpha1.ValueTransform{Scale: quantity("1")}, value: 2.7, want: "2700m"},
+		{name: "rounded", transform: &v1alpha1.ValueTransform{Round: Nearest}, value: 3, want: "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := Quantity(tt.transform, tt.value)
+			if got := q.String(); got != tt.want {
+				t.Errorf("Quantity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform *v1alpha1.ValueTransform
+		wantErrs  int
+	}{
+		{name: "no transform"},
+		{name: "units", transform: &v1alpha1.ValueTransform{FromUnit: "Bytes/Second", ToUnit: "Mebibytes/Second"}},
+		{name: "bounds", transform: &v1alpha1.ValueTransform{Min: quantity("1"), Max: quantity("1"), Round: Floor}},
+		{name: "missing unit", transform: &v1alpha1.ValueTransform{FromUnit: "Bytes"}, wantErrs: 1},
+		{name: "unknown units", transform: &v1alpha1.ValueTransform{FromUnit: "Bytez", ToUnit: "Parsecs"}, wantErrs: 2},
+		{name: "different kinds", transform: &v1alpha1.ValueTransform{FromUnit: "Bytes", ToUnit: "Seconds"}, wantErrs: 1},
+		{name: "rate and amount", transform: &v1alpha1.ValueTransform{FromUnit: "Bytes/Second", ToUnit: "Bytes"}, wantErrs: 1},
+		{name: "min above max", transform: &v1alpha1.ValueTransform{Min: quantity("10"), Max: quantity("1")}, wantErrs: 1},
+		{name: "unknown rounding", transform: &v1alpha1.ValueTransform{Round: "Up"}, wantErrs: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := Validate(tt.transform, field.NewPath("spec", "transform")); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}